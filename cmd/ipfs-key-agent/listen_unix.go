@@ -0,0 +1,17 @@
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listen creates the socket with no permissions for the group and others, so
+// that it is never reachable by other users, even between its creation and a
+// chmod
+func listen(socket string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socket)
+}
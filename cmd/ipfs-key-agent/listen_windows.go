@@ -0,0 +1,12 @@
+// +build windows
+
+package main
+
+import (
+	"net"
+)
+
+// listen creates the socket, whose access is set by the ACL of its directory
+func listen(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,95 @@
+// package main is the reference keystore agent. It holds the keys of a
+// keystore directory, and signs with them for the ipfs nodes whose
+// Keystore.AgentSocket config setting points to its socket, so that the keys
+// never are in the memory of the nodes.
+// Usage:
+//
+//	ipfs-key-agent -socket <socket path> -keystore <keystore directory>
+//
+// An encrypted keystore is unlocked with the passphrase in
+// $IPFS_KEYSTORE_PASSPHRASE, or entered on the terminal.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+)
+
+func main() {
+	socket := flag.String("socket", "", "path of the Unix socket to listen on")
+	dir := flag.String("keystore", "", "keystore directory holding the keys")
+	flag.Parse()
+	if *socket == "" || *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*socket, *dir); err != nil {
+		fmt.Fprintf(os.Stderr, "ipfs-key-agent: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func openKeystore(dir string) (keystore.Keystore, error) {
+	encrypted, err := keystore.IsEncryptedFSKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return keystore.NewFSKeystore(dir)
+	}
+
+	ks, err := keystore.NewEncryptedFSKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := keystore.ReadPassphrase(-1, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Unlock(pass); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func run(socket, dir string) error {
+	ks, err := openKeystore(dir)
+	if err != nil {
+		return err
+	}
+
+	// remove the socket left by a previous run
+	if fi, err := os.Stat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socket); err != nil {
+			return err
+		}
+	}
+	l, err := listen(socket)
+	if err != nil {
+		return err
+	}
+
+	closed := make(chan struct{})
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		close(closed)
+		l.Close()
+	}()
+
+	fmt.Printf("ipfs-key-agent listening on %s\n", socket)
+	err = keystore.NewAgent(ks).Serve(l)
+	select {
+	case <-closed:
+		return nil
+	default:
+		return err
+	}
+}
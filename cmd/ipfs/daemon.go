@@ -22,6 +22,7 @@ import (
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 
@@ -41,6 +42,7 @@ const (
 	initProfileOptionKwd      = "init-profile"
 	ipfsMountKwd              = "mount-ipfs"
 	ipnsMountKwd              = "mount-ipns"
+	keystorePassphraseFdKwd   = "keystore-passphrase-fd"
 	migrateKwd                = "migrate"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline" // global option
@@ -140,6 +142,15 @@ can be enabled by running the daemon as:
 This will later be transitioned into a config option once it gets out of the
 'experimental' stage.
 
+Encrypted keystore
+
+When the keystore was encrypted with 'ipfs repo encrypt-keystore', the daemon
+asks for its passphrase on start. The passphrase can be given in the
+IPFS_KEYSTORE_PASSPHRASE environment variable instead, or read from a file
+descriptor:
+
+  ipfs daemon --keystore-passphrase-fd=3 3<passphrase.txt
+
 DEPRECATION NOTICE
 
 Previously, ipfs used an environment variable as seen below:
@@ -168,6 +179,7 @@ Headers.
 		cmds.BoolOption(enablePubSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
 		cmds.BoolOption(enableIPNSPubSubKwd, "Enable IPNS record distribution through pubsub; enables pubsub."),
 		cmds.BoolOption(enableMultiplexKwd, "Add the experimental 'go-multiplex' stream muxer to libp2p on construction.").WithDefault(true),
+		cmds.IntOption(keystorePassphraseFdKwd, "Read the passphrase of the encrypted keystore from this file descriptor."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmds.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -283,6 +295,20 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// fail before we get to that. It can't hurt to close it twice.
 	defer repo.Close()
 
+	if ks, ok := repo.Keystore().(keystore.Lockable); ok && ks.Locked() {
+		fd, found := req.Options[keystorePassphraseFdKwd].(int)
+		if !found {
+			fd = -1
+		}
+		pass, err := keystore.ReadPassphrase(fd, false)
+		if err != nil {
+			return err
+		}
+		if err := ks.Unlock(pass); err != nil {
+			return fmt.Errorf("failed to unlock the keystore: %s", err)
+		}
+	}
+
 	cfg, err := cctx.GetConfig()
 	if err != nil {
 		return err
@@ -473,7 +499,7 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 	unrestricted, _ := req.Options[unrestrictedApiAccessKwd].(bool)
 	gatewayOpt := corehttp.GatewayOption(false, corehttp.WebUIPaths...)
 	if unrestricted {
-		gatewayOpt = corehttp.GatewayOption(true, "/ipfs", "/ipns")
+		gatewayOpt = corehttp.GatewayOption(true, corehttp.GatewayPaths()...)
 	}
 
 	var opts = []corehttp.ServeOption{
@@ -594,7 +620,7 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
 		corehttp.IPNSHostnameOption(),
-		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
+		corehttp.GatewayOption(writable, corehttp.GatewayPaths()...),
 		corehttp.VersionOption(),
 		corehttp.CheckVersionOption(),
 		corehttp.CommandsROOption(cmdctx),
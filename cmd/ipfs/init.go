@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
@@ -13,19 +15,25 @@ import (
 	assets "github.com/ipfs/go-ipfs/assets"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs-config"
 	"github.com/ipfs/go-ipfs-files"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 const (
-	nBitsForKeypairDefault = 2048
-	bitsOptionName         = "bits"
-	emptyRepoOptionName    = "empty-repo"
-	profileOptionName      = "profile"
+	nBitsForKeypairDefault   = 2048
+	bitsOptionName           = "bits"
+	emptyRepoOptionName      = "empty-repo"
+	profileOptionName        = "profile"
+	mnemonicOptionName       = "mnemonic"
+	newMnemonicOptionName    = "new-mnemonic"
+	derivationPathOptionName = "derivation-path"
 )
 
 var initCmd = &cmds.Command{
@@ -44,6 +52,18 @@ located at ~/.ipfs. To change the repo location, set the $IPFS_PATH
 environment variable:
 
     export IPFS_PATH=/path/to/ipfsrepo
+
+The keypair can instead be an ed25519 keypair derived from a mnemonic seed
+phrase, so that the repo can be recreated with the same peer identity from a
+backup of the phrase. With --new-mnemonic, a new phrase is generated and
+printed, to be written down. With --mnemonic=-, the phrase is read from
+$IPFS_MNEMONIC or from the terminal:
+
+    ipfs init --new-mnemonic
+    IPFS_MNEMONIC="<phrase>" ipfs init --mnemonic=-
+
+The identity is derived along the path given with --derivation-path. IPNS
+keys can be derived from the same phrase with 'ipfs key gen --mnemonic'.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -53,6 +73,9 @@ environment variable:
 		cmds.IntOption(bitsOptionName, "b", "Number of bits to use in the generated RSA private key.").WithDefault(nBitsForKeypairDefault),
 		cmds.BoolOption(emptyRepoOptionName, "e", "Don't add and pin help files to the local storage."),
 		cmds.StringOption(profileOptionName, "p", "Apply profile settings to config. Multiple profiles can be separated by ','"),
+		cmds.StringOption(mnemonicOptionName, "Derive the keypair from this mnemonic seed phrase, '-' reads it from $IPFS_MNEMONIC or the terminal."),
+		cmds.BoolOption(newMnemonicOptionName, "Derive the keypair from a new mnemonic seed phrase, which is printed."),
+		cmds.StringOption(derivationPathOptionName, "Derivation path of the keypair in the mnemonic seed phrase.").WithDefault(keystore.IdentityDerivationPath),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -109,7 +132,12 @@ environment variable:
 			profiles = strings.Split(profile, ",")
 		}
 
-		return doInit(os.Stdout, cctx.ConfigRoot, empty, nBitsForKeypair, profiles, conf)
+		identity, err := mnemonicIdentity(os.Stdout, req)
+		if err != nil {
+			return err
+		}
+
+		return doInit(os.Stdout, cctx.ConfigRoot, empty, nBitsForKeypair, profiles, conf, identity)
 	},
 }
 
@@ -123,10 +151,42 @@ func initWithDefaults(out io.Writer, repoRoot string, profile string) error {
 		profiles = strings.Split(profile, ",")
 	}
 
-	return doInit(out, repoRoot, false, nBitsForKeypairDefault, profiles, nil)
+	return doInit(out, repoRoot, false, nBitsForKeypairDefault, profiles, nil, nil)
+}
+
+// mnemonicIdentity derives the keypair from the mnemonic seed phrase given to
+// ipfs init, it returns nil when none was given
+func mnemonicIdentity(out io.Writer, req *cmds.Request) (ci.PrivKey, error) {
+	mnemonic, _ := req.Options[mnemonicOptionName].(string)
+	newMnemonic, _ := req.Options[newMnemonicOptionName].(bool)
+	derivationPath, _ := req.Options[derivationPathOptionName].(string)
+
+	switch {
+	case mnemonic != "" && newMnemonic:
+		return nil, fmt.Errorf("--%s and --%s cannot be used together", mnemonicOptionName, newMnemonicOptionName)
+	case newMnemonic:
+		var err error
+		if mnemonic, err = keystore.NewMnemonic(); err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(out, "mnemonic seed phrase of the keypair, write it down and keep it safe:\n\n\t%s\n\n", mnemonic); err != nil {
+			return nil, err
+		}
+	case mnemonic == "-":
+		var err error
+		if mnemonic, err = keystore.ReadMnemonic(); err != nil {
+			return nil, err
+		}
+	case mnemonic == "":
+		return nil, nil
+	}
+
+	return keystore.DeriveKey(mnemonic, derivationPath)
 }
 
-func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, confProfiles []string, conf *config.Config) error {
+// doInit initializes the repo, with the given identity when it is not nil and
+// a new keypair otherwise
+func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, confProfiles []string, conf *config.Config, identity ci.PrivKey) error {
 	if _, err := fmt.Fprintf(out, "initializing IPFS node at %s\n", repoRoot); err != nil {
 		return err
 	}
@@ -140,13 +200,24 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 	}
 
 	if conf == nil {
+		initOut := out
+		if identity != nil {
+			// the generated keypair is replaced by the identity
+			initOut = ioutil.Discard
+		}
 		var err error
-		conf, err = config.Init(out, nBitsForKeypair)
+		conf, err = config.Init(initOut, nBitsForKeypair)
 		if err != nil {
 			return err
 		}
 	}
 
+	if identity != nil {
+		if err := setIdentity(out, conf, identity); err != nil {
+			return err
+		}
+	}
+
 	for _, profile := range confProfiles {
 		transformer, ok := config.Profiles[profile]
 		if !ok {
@@ -171,6 +242,22 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 	return initializeIpnsKeyspace(repoRoot)
 }
 
+func setIdentity(out io.Writer, conf *config.Config, sk ci.PrivKey) error {
+	skbytes, err := sk.Bytes()
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	conf.Identity.PeerID = id.Pretty()
+	conf.Identity.PrivKey = base64.StdEncoding.EncodeToString(skbytes)
+
+	_, err = fmt.Fprintf(out, "peer identity: %s\n", id.Pretty())
+	return err
+}
+
 func checkWritable(dir string) error {
 	_, err := os.Stat(dir)
 	if err == nil {
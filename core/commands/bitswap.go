@@ -3,9 +3,12 @@ package commands
 import (
 	"fmt"
 	"io"
+	"os"
+	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/provider"
 
 	humanize "github.com/dustin/go-humanize"
 	bitswap "github.com/ipfs/go-bitswap"
@@ -216,13 +219,23 @@ prints the ledger associated with a given peer.
 	},
 }
 
+const reprovideForceOptionName = "force"
+
 var reprovideCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Trigger reprovider.",
 		ShortDescription: `
 Trigger reprovider to announce our data to network.
+
+Only the keys whose provider records are about to expire are announced
+again, unless --force is given. Pinned roots are announced before the other
+blocks.
 `,
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(reprovideForceOptionName, "f", "Also announce the keys provided recently."),
+	},
+	Type: provider.ReprovideProgress{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -233,11 +246,65 @@ Trigger reprovider to announce our data to network.
 			return ErrNotOnline
 		}
 
-		err = nd.Provider.Reprovide(req.Context)
-		if err != nil {
-			return err
+		force, _ := req.Options[reprovideForceOptionName].(bool)
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- nd.Provider.Reprovide(req.Context, force)
+		}()
+
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case err := <-errCh:
+				if err != nil {
+					return err
+				}
+				p := nd.Provider.ReprovideProgress()
+				return res.Emit(&p)
+			case <-ticker.C:
+				if p := nd.Provider.ReprovideProgress(); p.Running {
+					if err := res.Emit(&p); err != nil {
+						return err
+					}
+				}
+			case <-req.Context.Done():
+				return req.Context.Err()
+			}
 		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, p *provider.ReprovideProgress) error {
+			if p.Running {
+				return nil
+			}
+			fmt.Fprintf(w, "reprovided %d of %d keys, %d skipped as not about to expire\n", p.Provided, p.Checked, p.Skipped)
+			return nil
+		}),
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
 
-		return nil
+				p, ok := v.(*provider.ReprovideProgress)
+				if !ok {
+					return e.TypeErr(p, v)
+				}
+				if p.Running {
+					fmt.Fprintf(os.Stderr, "Checked %d keys, reprovided %d\r", p.Checked, p.Provided)
+				} else if err := re.Emit(p); err != nil {
+					return err
+				}
+			}
+		},
 	},
 }
@@ -131,8 +131,11 @@ func TestCommands(t *testing.T) {
 		"/id",
 		"/key",
 		"/key/gen",
+		"/key/export",
+		"/key/import",
 		"/key/list",
 		"/key/rename",
+		"/key/rotate-identity",
 		"/key/rm",
 		"/log",
 		"/log/level",
@@ -142,6 +145,14 @@ func TestCommands(t *testing.T) {
 		"/mount",
 		"/name",
 		"/name/publish",
+		"/name/history",
+		"/name/rollback",
+		"/name/cache",
+		"/name/cache/ls",
+		"/name/cache/clear",
+		"/name/inspect",
+		"/name/republisher",
+		"/name/republisher/status",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
@@ -170,11 +181,21 @@ func TestCommands(t *testing.T) {
 		"/p2p/stream/ls",
 		"/pin",
 		"/pin/add",
+		"/pin/jobs",
+		"/pin/jobs/cancel",
+		"/pin/jobs/ls",
+		"/pin/jobs/status",
 		"/ping",
 		"/pin/ls",
+		"/pin/remote",
+		"/pin/remote/add",
+		"/pin/remote/ls",
+		"/pin/remote/rm",
 		"/pin/rm",
 		"/pin/update",
 		"/pin/verify",
+		"/provide",
+		"/provide/stat",
 		"/pubsub",
 		"/pubsub/ls",
 		"/pubsub/peers",
@@ -184,6 +205,8 @@ func TestCommands(t *testing.T) {
 		"/refs/local",
 		"/repo",
 		"/repo/fsck",
+		"/repo/encrypt-keystore",
+		"/repo/migrate-pins",
 		"/repo/gc",
 		"/repo/stat",
 		"/repo/verify",
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	ncmd "github.com/ipfs/go-ipfs/core/commands/name"
+	"github.com/ipfs/go-ipfs/core/node"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 
@@ -13,6 +15,7 @@ import (
 
 const (
 	dnsRecursiveOptionName = "recursive"
+	dnsResolverOptionName  = "resolver"
 )
 
 var DNSCmd = &cmds.Command{
@@ -50,6 +53,19 @@ The resolver can recursively resolve:
 	dnslink=/ipns/ipfs.io
 	> ipfs dns -r recursive.ipfs.io
 	/ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy
+
+The TXT records are looked up with the resolvers set in the DNS.Resolvers
+config setting, which maps domains to DNS-over-HTTPS URLs or DNS servers,
+the domain "." applying to all names:
+
+	> ipfs config --json DNS.Resolvers '{"eth": "https://resolver.example.com/dns-query", ".": "1.1.1.1"}'
+
+Names without a resolver are looked up with the system resolver. It does
+not report the TTL of the records, so its answers are cached for a minute.
+The --resolver option looks all names up with the given resolver instead:
+
+	> ipfs dns --resolver=https://cloudflare-dns.com/dns-query ipfs.io
+	/ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy
 `,
 	},
 
@@ -58,11 +74,28 @@ The resolver can recursively resolve:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(dnsRecursiveOptionName, "r", "Resolve until the result is not a DNS link.").WithDefault(true),
+		cmds.StringOption(dnsResolverOptionName, "DNS-over-HTTPS URL or DNS server address to look the names up with."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		recursive, _ := req.Options[dnsRecursiveOptionName].(bool)
 		name := req.Arguments[0]
-		resolver := namesys.NewDNSResolver()
+		var resolver *namesys.DNSResolver
+		if addr, _ := req.Options[dnsResolverOptionName].(string); addr != "" {
+			txt, err := namesys.NewTXTResolver(addr)
+			if err != nil {
+				return cmds.Errorf(cmds.ErrClient, err.Error())
+			}
+			resolver = namesys.NewDNSResolver(namesys.WithTXTResolver(".", txt))
+		} else {
+			nd, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			resolver, err = node.DNSResolver(nd.Repo)
+			if err != nil {
+				return err
+			}
+		}
 
 		var routing []nsopts.ResolveOpt
 		if !recursive {
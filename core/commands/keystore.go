@@ -1,14 +1,29 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"text/tabwriter"
 
+	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	config "github.com/ipfs/go-ipfs-config"
+	path "github.com/ipfs/go-path"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 var KeyCmd = &cmds.Command{
@@ -26,13 +41,21 @@ publish'.
   > ipfs key list
   self
   mykey
+
+'ipfs key export' and 'ipfs key import' move keys between nodes.
+
+  > ipfs key export --encrypt mykey > mykey.key
+  > ipfs key import mykey mykey.key
 		`,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"gen":    keyGenCmd,
-		"list":   keyListCmd,
-		"rename": keyRenameCmd,
-		"rm":     keyRmCmd,
+		"gen":             keyGenCmd,
+		"export":          keyExportCmd,
+		"import":          keyImportCmd,
+		"list":            keyListCmd,
+		"rename":          keyRenameCmd,
+		"rm":              keyRmCmd,
+		"rotate-identity": keyRotateIdentityCmd,
 	},
 }
 
@@ -54,22 +77,91 @@ type KeyRenameOutput struct {
 }
 
 const (
-	keyStoreTypeOptionName = "type"
-	keyStoreSizeOptionName = "size"
+	keyStoreTypeOptionName      = "type"
+	keyStoreSizeOptionName      = "size"
+	keyMnemonicOptionName       = "mnemonic"
+	keyDerivationPathOptionName = "derivation-path"
 )
 
+var errMnemonicOnDaemon = errors.New("ipfs daemon is running. please stop it to derive a key from a mnemonic seed phrase")
+
 var keyGenCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Create a new keypair",
+		ShortDescription: `
+Generate a new keypair, or derive an ed25519 keypair from a mnemonic seed
+phrase along a derivation path, as 'ipfs init --mnemonic' does for the
+identity. The same phrase and path always give the same key, so that the
+names published with it can be recovered from a backup of the phrase. With
+--mnemonic=-, the phrase is read from $IPFS_MNEMONIC or from the terminal:
+
+  > ipfs key gen --mnemonic=- --derivation-path="m/1'/0'" mykey
+
+The phrase is not sent over the API, so keys can only be derived when no ipfs
+daemons are running.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.StringOption(keyStoreTypeOptionName, "t", "type of the key to create [rsa, ed25519]"),
 		cmds.IntOption(keyStoreSizeOptionName, "s", "size of the key to generate"),
+		cmds.StringOption(keyMnemonicOptionName, "derive the key from this mnemonic seed phrase, '-' reads it from $IPFS_MNEMONIC or the terminal"),
+		cmds.StringOption(keyDerivationPathOptionName, "derivation path of the key in the mnemonic seed phrase, such as m/1'/0'"),
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("name", true, false, "name of key to create"),
 	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		mnemonic, _ := req.Options[keyMnemonicOptionName].(string)
+		if mnemonic == "" {
+			return nil
+		}
+
+		// the phrase would end up in the URL of the request to the daemon,
+		// as for the commands which cannot run on the daemon
+		if api, _ := req.Options[ApiOption].(string); api != "" {
+			return errMnemonicOnDaemon
+		}
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		if locked, _ := fsrepo.LockedByOtherProcess(configRoot); locked {
+			return errMnemonicOnDaemon
+		}
+
+		if mnemonic == "-" {
+			phrase, err := keystore.ReadMnemonic()
+			if err != nil {
+				return err
+			}
+			req.Options[keyMnemonicOptionName] = phrase
+		}
+		return nil
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+		if name == "self" {
+			return fmt.Errorf("cannot create key with name 'self'")
+		}
+
+		if mnemonic, _ := req.Options[keyMnemonicOptionName].(string); mnemonic != "" {
+			nd, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			if nd.IsDaemon {
+				return errMnemonicOnDaemon
+			}
+			id, err := deriveKey(nd.Repo.Keystore(), name, mnemonic, req)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &KeyOutput{
+				Name: name,
+				Id:   id.Pretty(),
+			})
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -80,11 +172,6 @@ var keyGenCmd = &cmds.Command{
 			return fmt.Errorf("please specify a key type with --type")
 		}
 
-		name := req.Arguments[0]
-		if name == "self" {
-			return fmt.Errorf("cannot create key with name 'self'")
-		}
-
 		opts := []options.KeyGenerateOption{options.Key.Type(typ)}
 
 		size, sizefound := req.Options[keyStoreSizeOptionName].(int)
@@ -112,6 +199,167 @@ var keyGenCmd = &cmds.Command{
 	Type: KeyOutput{},
 }
 
+const (
+	keyFormatOptionName  = "format"
+	keyEncryptOptionName = "encrypt"
+)
+
+// maxKeySize bounds the size of the imported keys
+const maxKeySize = 16 << 10
+
+var keyExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export a keypair",
+		ShortDescription: `
+Write a private key out, to be imported by another node with 'ipfs key import'.
+The key is encoded with the libp2p protobuf format, as in the keystore, or
+with the PEM encoded PKCS #8 format read by most tools:
+
+  > ipfs key export --format=pem-pkcs8 mykey > mykey.pem
+
+With --encrypt, the key is encrypted with a key derived from a passphrase, as
+in encrypted PKCS #8 keys. The passphrase is asked for, unless it is given in
+the IPFS_KEYSTORE_PASSPHRASE environment variable or read from the file
+descriptor given with --passphrase-fd:
+
+  > ipfs key export --format=pem-pkcs8 --encrypt --passphrase-fd=3 mykey 3<passphrase > mykey.pem
+
+The key is read from the repo, so this command can only run when no ipfs
+daemons are running.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "name of the key to export"),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyFormatOptionName, "format of the exported key [libp2p-protobuf, pem-pkcs8]").WithDefault(keystore.FormatProtobuf),
+		cmds.BoolOption(keyEncryptOptionName, "encrypt the exported key with a passphrase"),
+		cmds.IntOption(passphraseFdOptionName, "read the passphrase from this file descriptor, implies --encrypt"),
+	},
+	NoRemote: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		name := req.Arguments[0]
+		sk := nd.PrivateKey
+		if name != "self" {
+			if sk, err = nd.Repo.Keystore().Get(name); err != nil {
+				return err
+			}
+		}
+
+		format, _ := req.Options[keyFormatOptionName].(string)
+		encrypt, _ := req.Options[keyEncryptOptionName].(bool)
+		fd, found := req.Options[passphraseFdOptionName].(int)
+		if !found {
+			fd = -1
+		}
+		var passphrase []byte
+		if encrypt || found {
+			if passphrase, err = keystore.ReadPassphrase(fd, true); err != nil {
+				return err
+			}
+			if len(passphrase) == 0 {
+				return errors.New("the passphrase cannot be empty")
+			}
+		}
+		data, err := keystore.MarshalPrivateKey(sk, format, passphrase)
+		if err != nil {
+			return err
+		}
+		return res.Emit(bytes.NewReader(data))
+	},
+}
+
+var keyImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import a keypair",
+		ShortDescription: `
+Add a private key written by 'ipfs key export', or a PEM encoded PKCS #8 key,
+to the keystore under the given name. The format is detected. The passphrase
+of encrypted keys is asked for, unless it is given in the
+IPFS_KEYSTORE_PASSPHRASE environment variable or read from the file
+descriptor given with --passphrase-fd:
+
+  > ipfs key import --passphrase-fd=3 mykey mykey.pem 3<passphrase
+
+The key is written to the repo, so this command can only run when no ipfs
+daemons are running.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "name of the imported key"),
+		cmds.FileArg("key", true, false, "file holding the key to import").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(passphraseFdOptionName, "read the passphrase of an encrypted key from this file descriptor"),
+	},
+	NoRemote: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		name := req.Arguments[0]
+		if name == "self" {
+			return fmt.Errorf("cannot import key with name 'self'")
+		}
+
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(file, maxKeySize+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > maxKeySize {
+			return fmt.Errorf("key is larger than %d bytes", maxKeySize)
+		}
+
+		var passphrase []byte
+		if fd, found := req.Options[passphraseFdOptionName].(int); found {
+			if passphrase, err = keystore.ReadPassphrase(fd, false); err != nil {
+				return err
+			}
+		}
+		sk, err := keystore.UnmarshalPrivateKey(data, passphrase)
+		if err == keystore.ErrPassphraseNeeded {
+			if passphrase, err = keystore.ReadPassphrase(-1, false); err != nil {
+				return err
+			}
+			sk, err = keystore.UnmarshalPrivateKey(data, passphrase)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid key: %s", err)
+		}
+		if err := nd.Repo.Keystore().Put(name, sk); err != nil {
+			return err
+		}
+
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &KeyOutput{
+			Name: name,
+			Id:   id.Pretty(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ko *KeyOutput) error {
+			_, err := w.Write([]byte(ko.Id + "\n"))
+			return err
+		}),
+	},
+	Type: KeyOutput{},
+}
+
 var keyListCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List all local keypairs",
@@ -230,6 +478,238 @@ var keyRmCmd = &cmds.Command{
 	Type: KeyOutputList{},
 }
 
+// KeyRotateOutput is the output of 'ipfs key rotate-identity'
+type KeyRotateOutput struct {
+	OldId  string
+	NewId  string
+	OldKey string
+	// Updated lists the config settings which named the old identity
+	Updated []string
+}
+
+const keyRotateOldKeyOptionName = "old-key"
+
+var keyRotateIdentityCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Replace the identity of the node with a new keypair",
+		ShortDescription: `
+'ipfs key rotate-identity' generates a new identity for the node and replaces
+the one in the config. The old key is kept in the keystore, under the name
+given with --old-key, 'identity-<old PeerID>' by default.
+
+IPNS names follow the new identity: the value published with the old identity
+is published with the new one, and the old name is published anew, signed by
+the old key, to point to the new name. This record is the handover from the
+old identity to the new one, which anyone can verify, see 'ipfs name inspect':
+
+  > ipfs key rotate-identity
+  > ipfs name resolve --recursive=false <old PeerID>
+  /ipns/<new PeerID>
+
+The old key is republished as any other key, so that the handover does not
+expire. The addresses naming the old identity in Bootstrap and Addresses are
+updated. The peers whose config names this node have to be updated by their
+operators.
+
+This command can only run when no ipfs daemons are running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyStoreTypeOptionName, "t", "type of the new key [rsa, ed25519]").WithDefault("rsa"),
+		cmds.IntOption(keyStoreSizeOptionName, "s", "size of the new key"),
+		cmds.StringOption(keyRotateOldKeyOptionName, "name under which to keep the old key"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		typ, _ := req.Options[keyStoreTypeOptionName].(string)
+		size, found := req.Options[keyStoreSizeOptionName].(int)
+		if !found {
+			size = -1
+		}
+		newSk, err := generateKey(typ, size)
+		if err != nil {
+			return err
+		}
+		newID, err := peer.IDFromPrivateKey(newSk)
+		if err != nil {
+			return err
+		}
+		oldSk, oldID := nd.PrivateKey, nd.Identity
+
+		oldKey, _ := req.Options[keyRotateOldKeyOptionName].(string)
+		if oldKey == "" {
+			oldKey = "identity-" + oldID.Pretty()
+		}
+		if oldKey == "self" {
+			return fmt.Errorf("cannot keep the old key with name 'self'")
+		}
+
+		// keep both keys in the keystore before touching the config, so
+		// that neither can be lost. The new one is only kept there until it
+		// is in the config.
+		newKey := "identity-" + newID.Pretty()
+		ks := nd.Repo.Keystore()
+		if err := ks.Put(newKey, newSk); err != nil {
+			return fmt.Errorf("failed to keep the new key as %s: %s", newKey, err)
+		}
+		if err := ks.Put(oldKey, oldSk); err != nil {
+			ks.Delete(newKey)
+			return fmt.Errorf("failed to keep the old key as %s: %s", oldKey, err)
+		}
+
+		// the whole identity is written at once
+		newSkBytes, err := newSk.Bytes()
+		if err != nil {
+			return err
+		}
+		newCfg := *cfg
+		newCfg.Identity.PeerID = newID.Pretty()
+		newCfg.Identity.PrivKey = base64.StdEncoding.EncodeToString(newSkBytes)
+		updated := replaceConfigPeerID(&newCfg, oldID, newID)
+		if err := nd.Repo.SetConfig(&newCfg); err != nil {
+			return err
+		}
+
+		// the handover is published once the new identity is in the config,
+		// which is restored if publishing fails
+		if err := publishHandover(req.Context, nd, oldSk, newSk); err != nil {
+			if rerr := nd.Repo.SetConfig(cfg); rerr != nil {
+				return fmt.Errorf("%s, and restoring the old identity in the config failed: %s", err, rerr)
+			}
+			if rerr := ks.Delete(newKey); rerr != nil {
+				log.Errorf("failed to remove the new key %s from the keystore: %s", newKey, rerr)
+			}
+			return err
+		}
+		if err := ks.Delete(newKey); err != nil {
+			log.Errorf("failed to remove the new key %s from the keystore: %s", newKey, err)
+		}
+
+		return cmds.EmitOnce(res, &KeyRotateOutput{
+			OldId:   oldID.Pretty(),
+			NewId:   newID.Pretty(),
+			OldKey:  oldKey,
+			Updated: updated,
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *KeyRotateOutput) error {
+			fmt.Fprintf(w, "Identity rotated from %s to %s\n", out.OldId, out.NewId)
+			fmt.Fprintf(w, "The old key is kept as %s\n", out.OldKey)
+			for _, setting := range out.Updated {
+				fmt.Fprintf(w, "Updated %s\n", setting)
+			}
+			return nil
+		}),
+	},
+	Type: KeyRotateOutput{},
+}
+
+// deriveKey adds the key derived from the mnemonic seed phrase to the
+// keystore, along the derivation path given to ipfs key gen
+func deriveKey(ks keystore.Keystore, name, mnemonic string, req *cmds.Request) (peer.ID, error) {
+	derivationPath, _ := req.Options[keyDerivationPathOptionName].(string)
+	if derivationPath == "" {
+		return "", fmt.Errorf("please specify the derivation path of the key with --%s", keyDerivationPathOptionName)
+	}
+	if typ, _ := req.Options[keyStoreTypeOptionName].(string); typ != "" && typ != "ed25519" {
+		return "", fmt.Errorf("the keys derived from a mnemonic seed phrase are ed25519 keys")
+	}
+	if _, ok := req.Options[keyStoreSizeOptionName].(int); ok {
+		return "", fmt.Errorf("--%s cannot be used with --%s", keyStoreSizeOptionName, keyMnemonicOptionName)
+	}
+
+	if has, err := ks.Has(name); err != nil {
+		return "", err
+	} else if has {
+		return "", fmt.Errorf("key with name '%s' already exists", name)
+	}
+	sk, err := keystore.DeriveKey(mnemonic, derivationPath)
+	if err != nil {
+		return "", err
+	}
+	if err := ks.Put(name, sk); err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(sk)
+}
+
+func generateKey(typ string, size int) (ci.PrivKey, error) {
+	switch typ {
+	case "rsa":
+		if size == -1 {
+			size = options.DefaultRSALen
+		}
+		sk, _, err := ci.GenerateKeyPairWithReader(ci.RSA, size, rand.Reader)
+		return sk, err
+	case "ed25519":
+		sk, _, err := ci.GenerateEd25519Key(rand.Reader)
+		return sk, err
+	default:
+		return nil, fmt.Errorf("unrecognized key type: %s", typ)
+	}
+}
+
+// publishHandover publishes the value of the old identity's name with the new
+// key, and the new name with the old key
+func publishHandover(ctx context.Context, nd *core.IpfsNode, oldSk, newSk ci.PrivKey) error {
+	oldID, err := peer.IDFromPrivateKey(oldSk)
+	if err != nil {
+		return err
+	}
+	newID, err := peer.IDFromPrivateKey(newSk)
+	if err != nil {
+		return err
+	}
+
+	publisher := namesys.NewIpnsPublisher(nd.Routing, nd.Repo.Datastore())
+	entry, err := publisher.GetPublished(ctx, oldID, false)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		if err := publisher.Publish(ctx, newSk, path.Path(entry.GetValue())); err != nil {
+			return err
+		}
+	}
+	return publisher.Publish(ctx, oldSk, path.FromString("/ipns/"+newID.Pretty()))
+}
+
+// replaceConfigPeerID replaces the old peer ID with the new one in the
+// addresses of the config, and returns the settings it changed
+func replaceConfigPeerID(cfg *config.Config, oldID, newID peer.ID) []string {
+	var updated []string
+	replace := func(setting string, addrs *[]string) {
+		replaced := make([]string, len(*addrs))
+		changed := false
+		for i, a := range *addrs {
+			for _, proto := range []string{"/ipfs/", "/p2p/"} {
+				a = strings.Replace(a, proto+oldID.Pretty(), proto+newID.Pretty(), -1)
+			}
+			replaced[i] = a
+			changed = changed || a != (*addrs)[i]
+		}
+		if changed {
+			*addrs = replaced
+			updated = append(updated, setting)
+		}
+	}
+
+	replace("Bootstrap", &cfg.Bootstrap)
+	replace("Addresses.Swarm", &cfg.Addresses.Swarm)
+	replace("Addresses.Announce", &cfg.Addresses.Announce)
+	replace("Addresses.NoAnnounce", &cfg.Addresses.NoAnnounce)
+	return updated
+}
+
 func keyOutputListEncoders() cmds.EncoderFunc {
 	return cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, list *KeyOutputList) error {
 		withID, _ := req.Options["l"].(bool)
@@ -0,0 +1,119 @@
+package name
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errNoCache = errors.New("the name system has no cache")
+
+// CachedName is a name in the resolution cache
+type CachedName struct {
+	Name      string
+	Value     string
+	Expires   time.Time
+	EOL       time.Time
+	Persisted bool
+}
+
+var NameCacheCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the cache of resolved names.",
+		ShortDescription: `
+Resolved IPNS names and dnslinks are cached for the TTL of their records. The
+cache is kept in memory, and in the datastore as well when Ipns.PersistentCache
+is enabled:
+
+  > ipfs config --bool Ipns.PersistentCache true
+
+The IPNS names in the persistent cache survive restarts; dnslinks are only
+cached in memory. Once expired, IPNS names are served while they are resolved
+again in the background, as long as their records are valid. Set
+Ipns.ServeStale to false to resolve expired names before answering instead.
+The entries which cannot be served anymore are removed every hour.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    nameCacheLsCmd,
+		"clear": nameCacheClearCmd,
+	},
+}
+
+var nameCacheLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the cached names.",
+		ShortDescription: `
+Print the cached names, their value and when they expire. Names kept across
+restarts are marked with "persisted".
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cns, ok := nd.Namesys.(namesys.CachingNameSystem)
+		if !ok {
+			return errNoCache
+		}
+
+		entries, err := cns.CachedNames(req.Context)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := res.Emit(&CachedName{
+				Name:      e.Name,
+				Value:     e.Value.String(),
+				Expires:   e.Expires,
+				EOL:       e.EOL,
+				Persisted: e.Persisted,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, n *CachedName) error {
+			expiry := "expires " + n.Expires.Format(time.RFC3339)
+			if time.Now().After(n.Expires) {
+				expiry = "stale since " + n.Expires.Format(time.RFC3339)
+			}
+			if n.Persisted {
+				expiry += ", persisted"
+			}
+			_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", n.Name, n.Value, expiry)
+			return err
+		}),
+	},
+	Type: CachedName{},
+}
+
+var nameCacheClearCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove all the names from the cache.",
+		ShortDescription: `
+Remove all the names from the cache, so that they are resolved again on next
+use.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cns, ok := nd.Namesys.(namesys.CachingNameSystem)
+		if !ok {
+			return errNoCache
+		}
+		return cns.ClearCache()
+	},
+}
@@ -0,0 +1,241 @@
+package name
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	ipath "github.com/ipfs/go-path"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	keyArgumentName  = "key"
+	toOptionName     = "to"
+	historyKeyArgDoc = "Name of the key or a valid PeerID, as listed by 'ipfs key list -l'."
+)
+
+// HistoryEntry is a record published by this node for an IPNS name
+type HistoryEntry struct {
+	Sequence uint64
+	Value    string
+	Validity time.Time
+}
+
+var HistoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the records published for a key.",
+		ShortDescription: `
+Print the records this node published for a key, newest first: their
+sequence number, value and end of validity. The last ` + strconv.Itoa(namesys.IpnsHistorySize) + ` values published
+for each key are kept.
+
+Examples:
+
+  > ipfs name history self
+  2	/ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz	2019-06-02T12:00:00Z
+  1	/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy	2019-06-01T12:00:00Z
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg(keyArgumentName, false, false, historyKeyArgDoc+" Default: self."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		kname := "self"
+		if len(req.Arguments) > 0 {
+			kname = req.Arguments[0]
+		}
+		id, err := keyID(req.Context, api, kname)
+		if err != nil {
+			return err
+		}
+
+		entries, err := namesys.NewIpnsPublisher(nd.Routing, nd.Repo.Datastore()).History(req.Context, id)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			h, err := historyEntry(e)
+			if err != nil {
+				return err
+			}
+			if err := res.Emit(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, h *HistoryEntry) error {
+			_, err := fmt.Fprintf(w, "%d\t%s\t%s\n", h.Sequence, h.Value, h.Validity.Format(time.RFC3339))
+			return err
+		}),
+	},
+	Type: HistoryEntry{},
+}
+
+var RollbackCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish an earlier value of a key again.",
+		ShortDescription: `
+Republish a value from the history of a key, as listed by 'ipfs name history',
+with a sequence number higher than the current one so that it supersedes the
+current record. The value is selected by its sequence number or by the value
+itself.
+
+Examples:
+
+  > ipfs name rollback self --to=1
+  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
+  > ipfs name rollback self --to=/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg(keyArgumentName, true, false, historyKeyArgDoc),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(toOptionName, "Sequence number or value of the record to roll back to."),
+		cmds.StringOption(lifeTimeOptionName, "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
+		cmds.BoolOption(allowOfflineOptionName, "When offline, save the IPNS record to the the local datastore without broadcasting to the network instead of simply failing."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		to, _ := req.Options[toOptionName].(string)
+		if to == "" {
+			return fmt.Errorf("the record to roll back to must be given with --%s", toOptionName)
+		}
+		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+		validTimeOpt, _ := req.Options[lifeTimeOptionName].(string)
+		validTime, err := time.ParseDuration(validTimeOpt)
+		if err != nil {
+			return fmt.Errorf("error parsing lifetime option: %s", err)
+		}
+
+		kname := req.Arguments[0]
+		id, err := keyID(req.Context, api, kname)
+		if err != nil {
+			return err
+		}
+
+		entries, err := namesys.NewIpnsPublisher(nd.Routing, nd.Repo.Datastore()).History(req.Context, id)
+		if err != nil {
+			return err
+		}
+		target, err := findInHistory(entries, to)
+		if err != nil {
+			return fmt.Errorf("%s: %s", kname, err)
+		}
+		if target == entries[0] {
+			return fmt.Errorf("%s is already the current value of %s", target.GetValue(), kname)
+		}
+
+		out, err := api.Name().Publish(req.Context, path.New(string(target.GetValue())),
+			options.Name.AllowOffline(allowOffline),
+			options.Name.Key(kname),
+			options.Name.ValidTime(validTime),
+		)
+		if err != nil {
+			if err == iface.ErrOffline {
+				err = errAllowOffline
+			}
+			return err
+		}
+
+		return cmds.EmitOnce(res, &IpnsEntry{
+			Name:  out.Name(),
+			Value: out.Value().String(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ie *IpnsEntry) error {
+			_, err := fmt.Fprintf(w, "Published to %s: %s\n", ie.Name, ie.Value)
+			return err
+		}),
+	},
+	Type: IpnsEntry{},
+}
+
+// keyID returns the peer ID of the key with the given name or ID
+func keyID(ctx context.Context, api iface.CoreAPI, k string) (peer.ID, error) {
+	keys, err := api.Key().List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if key.Name() == k || key.ID().Pretty() == k {
+			return key.ID(), nil
+		}
+	}
+	return "", fmt.Errorf("no key named %s was found", k)
+}
+
+// findInHistory returns the newest entry matching to, which is either a
+// sequence number or a value
+func findInHistory(entries []*pb.IpnsEntry, to string) (*pb.IpnsEntry, error) {
+	if seq, err := strconv.ParseUint(to, 10, 64); err == nil {
+		for _, e := range entries {
+			if e.GetSequence() == seq {
+				return e, nil
+			}
+		}
+		return nil, fmt.Errorf("no record with sequence number %d in the history", seq)
+	}
+
+	p, err := ipath.ParsePath(to)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if ipath.Path(e.GetValue()) == p {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the history", p)
+}
+
+func historyEntry(e *pb.IpnsEntry) (*HistoryEntry, error) {
+	eol, err := ipns.GetEOL(e)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryEntry{
+		Sequence: e.GetSequence(),
+		Value:    string(e.GetValue()),
+		Validity: eol,
+	}, nil
+}
@@ -0,0 +1,223 @@
+package name
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	proto "github.com/gogo/protobuf/proto"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+const (
+	inspectVerifyOptionName = "verify"
+	inspectDumpOptionName   = "dump"
+)
+
+// maxRecordSize bounds the size of the records read by 'ipfs name inspect',
+// the DHT does not accept larger ones
+const maxRecordSize = 10 << 10
+
+// IpnsInspectEntry holds the fields of an IPNS record
+type IpnsInspectEntry struct {
+	Value        string
+	Sequence     uint64
+	ValidityType string
+	Validity     time.Time
+	TTL          time.Duration
+	PublicKey    string
+	Verification *IpnsVerification `json:",omitempty"`
+}
+
+// IpnsVerification is the result of the verification of an IPNS record
+// against a name
+type IpnsVerification struct {
+	Name  string
+	Valid bool
+	Error string `json:",omitempty"`
+}
+
+var IpnsInspectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect an IPNS record.",
+		ShortDescription: `
+Print the fields of an IPNS record: its value, sequence number, validity, TTL
+and embedded public key. The record is read from a file or stdin, or is the
+record this node published for the key given with --key.
+
+With --verify, the signature of the record is checked against the given IPNS
+name, which is done offline when the public key is embedded in the record or
+in the name.
+
+With --dump, the signed record is written out instead, as stored in the DHT,
+so that it can be inspected or put into the DHT by another node.
+
+Examples:
+
+  > ipfs name inspect --key=self --dump > record.bin
+  > ipfs name inspect --verify=QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n < record.bin
+  Value: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  Sequence: 2
+  Validity Type: EOL
+  Validity: 2019-06-02T12:00:00Z
+  TTL: 1m0s
+  Public Key: none
+  Signature: valid for QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.FileArg("record", false, false, "IPNS record to inspect.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyOptionName, "k", "Inspect the record published by this node for this key, given by name or PeerID, instead of reading one."),
+		cmds.StringOption(inspectVerifyOptionName, "Verify the signature of the record against this IPNS name."),
+		cmds.BoolOption(inspectDumpOptionName, "Write the signed record instead of its fields."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		verifyName, _ := req.Options[inspectVerifyOptionName].(string)
+		if kname, _ := req.Options[keyOptionName].(string); kname != "" {
+			api, err := cmdenv.GetApi(env, req)
+			if err != nil {
+				return err
+			}
+			id, err := keyID(req.Context, api, kname)
+			if err != nil {
+				return err
+			}
+			entry, err := namesys.NewIpnsPublisher(nd.Routing, nd.Repo.Datastore()).GetPublished(req.Context, id, nd.IsOnline)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				return fmt.Errorf("no record was published for %s", kname)
+			}
+			if data, err = proto.Marshal(entry); err != nil {
+				return err
+			}
+			if verifyName == "" {
+				verifyName = id.Pretty()
+			}
+		} else {
+			if req.Files == nil {
+				return errors.New("a record or --key must be given")
+			}
+			file, err := cmdenv.GetFileArg(req.Files.Entries())
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			data, err = ioutil.ReadAll(io.LimitReader(file, maxRecordSize+1))
+			if err != nil {
+				return err
+			}
+			if len(data) > maxRecordSize {
+				return fmt.Errorf("record is larger than %d bytes", maxRecordSize)
+			}
+		}
+
+		entry := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(data, entry); err != nil {
+			return fmt.Errorf("invalid IPNS record: %s", err)
+		}
+
+		if dump, _ := req.Options[inspectDumpOptionName].(bool); dump {
+			return res.Emit(bytes.NewReader(data))
+		}
+
+		out := &IpnsInspectEntry{
+			Value:        string(entry.GetValue()),
+			Sequence:     entry.GetSequence(),
+			ValidityType: entry.GetValidityType().String(),
+			TTL:          time.Duration(entry.GetTtl()),
+		}
+		if eol, err := ipns.GetEOL(entry); err == nil {
+			out.Validity = eol
+		}
+		if len(entry.GetPubKey()) > 0 {
+			out.PublicKey = base64.StdEncoding.EncodeToString(entry.GetPubKey())
+		}
+
+		if verifyName != "" {
+			id, err := peer.IDB58Decode(strings.TrimPrefix(verifyName, "/ipns/"))
+			if err != nil {
+				return fmt.Errorf("invalid IPNS name %q: %s", verifyName, err)
+			}
+			out.Verification = &IpnsVerification{Name: id.Pretty()}
+
+			pk, err := ipns.ExtractPublicKey(id, entry)
+			if err == nil && pk == nil && nd.Routing != nil {
+				// neither the record nor the name hold the key
+				pk, err = routing.GetPublicKey(nd.Routing, req.Context, id)
+			}
+			if err == nil && pk == nil {
+				err = errors.New("public key not found")
+			}
+			if err == nil {
+				err = verifyRecord(pk, entry)
+			}
+			if err != nil {
+				out.Verification.Error = err.Error()
+			} else {
+				out.Verification.Valid = true
+			}
+		}
+
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *IpnsInspectEntry) error {
+			fmt.Fprintf(w, "Value: %s\n", e.Value)
+			fmt.Fprintf(w, "Sequence: %d\n", e.Sequence)
+			fmt.Fprintf(w, "Validity Type: %s\n", e.ValidityType)
+			if !e.Validity.IsZero() {
+				fmt.Fprintf(w, "Validity: %s\n", e.Validity.Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "TTL: %s\n", e.TTL)
+			if e.PublicKey == "" {
+				fmt.Fprintln(w, "Public Key: none")
+			} else {
+				fmt.Fprintf(w, "Public Key: %s\n", e.PublicKey)
+			}
+			if v := e.Verification; v != nil {
+				if v.Valid {
+					fmt.Fprintf(w, "Signature: valid for %s\n", v.Name)
+				} else {
+					fmt.Fprintf(w, "Signature: invalid for %s: %s\n", v.Name, v.Error)
+				}
+			}
+			return nil
+		}),
+	},
+	Type: IpnsInspectEntry{},
+}
+
+// verifyRecord checks the signature of a record. An expired record with a
+// valid signature is reported as such.
+func verifyRecord(pk ci.PubKey, entry *pb.IpnsEntry) error {
+	switch err := ipns.Validate(pk, entry); err {
+	case ipns.ErrExpiredRecord:
+		return errors.New("the signature is valid but the record has expired")
+	default:
+		return err
+	}
+}
@@ -59,8 +59,13 @@ Resolve the value of a dnslink:
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"publish": PublishCmd,
-		"resolve": IpnsCmd,
-		"pubsub":  IpnsPubsubCmd,
+		"publish":     PublishCmd,
+		"resolve":     IpnsCmd,
+		"pubsub":      IpnsPubsubCmd,
+		"history":     HistoryCmd,
+		"rollback":    RollbackCmd,
+		"cache":       NameCacheCmd,
+		"inspect":     IpnsInspectCmd,
+		"republisher": NameRepublisherCmd,
 	},
 }
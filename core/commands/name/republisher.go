@@ -0,0 +1,112 @@
+package name
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// RepublishStatus is the republishing state of a key
+type RepublishStatus struct {
+	Name          string
+	Id            string
+	Interval      time.Duration
+	Lifetime      time.Duration
+	Disabled      bool
+	Published     bool
+	LastRepublish time.Time
+	LastAttempt   time.Time
+	LastError     string `json:",omitempty"`
+	NextRepublish time.Time
+}
+
+var NameRepublisherCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the IPNS republisher.",
+		ShortDescription: `
+The daemon republishes the records of its keys every Ipns.RepublishPeriod, so
+that they do not expire. The interval and the lifetime of the republished
+records can be set for each key, and republishing disabled, with
+Ipns.KeyPolicies:
+
+  > ipfs config --json Ipns.KeyPolicies '{"mykey": {"Interval": "1h", "Lifetime": "48h"}, "other": {"Disabled": true}}'
+
+The node's own key is named "self".
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": nameRepublisherStatusCmd,
+	},
+}
+
+var nameRepublisherStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show when the records of each key were and will be republished.",
+		ShortDescription: `
+Print, for each key, when its record was last republished, the error of the
+last attempt if it failed, and when it is next due.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.IpnsRepub == nil {
+			return errors.New("the republisher only runs on an online node")
+		}
+
+		keys, err := nd.IpnsRepub.Status()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := res.Emit(&RepublishStatus{
+				Name:          k.Name,
+				Id:            k.ID.Pretty(),
+				Interval:      k.Interval,
+				Lifetime:      k.Lifetime,
+				Disabled:      k.Disabled,
+				Published:     k.Published,
+				LastRepublish: k.LastRepublish,
+				LastAttempt:   k.LastAttempt,
+				LastError:     k.LastError,
+				NextRepublish: k.NextRepublish,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *RepublishStatus) error {
+			fmt.Fprintf(w, "%s (%s)\n", s.Name, s.Id)
+			switch {
+			case s.Disabled:
+				fmt.Fprintln(w, "  republishing disabled")
+			case !s.Published:
+				fmt.Fprintln(w, "  nothing published")
+			default:
+				fmt.Fprintf(w, "  every %s, records valid for %s\n", s.Interval, s.Lifetime)
+			}
+			if !s.LastRepublish.IsZero() {
+				fmt.Fprintf(w, "  last republished: %s\n", s.LastRepublish.Format(time.RFC3339))
+			} else if s.Published {
+				fmt.Fprintln(w, "  last republished: never")
+			}
+			if s.LastError != "" {
+				fmt.Fprintf(w, "  last error: %s\n", s.LastError)
+			}
+			if !s.Disabled && !s.NextRepublish.IsZero() {
+				fmt.Fprintf(w, "  next due: %s\n", s.NextRepublish.Format(time.RFC3339))
+			}
+			return nil
+		}),
+	},
+	Type: RepublishStatus{},
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
@@ -35,6 +36,8 @@ var PinCmd = &cmds.Command{
 		"ls":     listPinCmd,
 		"verify": verifyPinCmd,
 		"update": updatePinCmd,
+		"jobs":   pinJobsCmd,
+		"remote": remotePinCmd,
 	},
 }
 
@@ -44,18 +47,47 @@ type PinOutput struct {
 
 type AddPinOutput struct {
 	Pins     []string
-	Progress int `json:",omitempty"`
+	Progress int      `json:",omitempty"`
+	Jobs     []string `json:",omitempty"`
 }
 
 const (
-	pinRecursiveOptionName = "recursive"
-	pinProgressOptionName  = "progress"
+	pinRecursiveOptionName  = "recursive"
+	pinProgressOptionName   = "progress"
+	pinNameOptionName       = "name"
+	pinMetaOptionName       = "meta"
+	pinExpireInOptionName   = "expire-in"
+	pinBackgroundOptionName = "background"
+	pinNamespaceOptionName  = "namespace"
 )
 
 var addPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Pin objects to local storage.",
 		ShortDescription: "Stores an IPFS object(s) from a given path locally to disk.",
+		LongDescription: `
+Stores an IPFS object(s) from a given path locally to disk.
+
+Pins can be labelled with a name and metadata, using --name and --meta. With
+--expire-in, the pin is removed once the given duration has passed, after
+which its content may be garbage collected. Pinning an object again without
+--expire-in makes its pin permanent, while a permanent pin stays permanent
+when pinned again with --expire-in: remove it first to make it expire.
+
+With --namespace, the objects are pinned on behalf of the given namespace, e.g.
+the name of an application. Content stays pinned as long as one namespace
+holds it, and 'ipfs pin rm' only removes the pins of the namespace it is given.
+Pins made without a namespace belong to the "default" namespace. The expiry of
+a namespace's pin only applies to that namespace: the content is unpinned once
+the pins of all the namespaces holding it expired.
+
+With --background, the objects are pinned by the daemon in the background and
+a job ID is returned for each of them right away. The jobs survive daemon
+restarts, and are managed with 'ipfs pin jobs'.
+
+Example:
+	$ ipfs pin add --name=uploads --meta=customer=acme --expire-in=72h <hash>
+`,
 	},
 
 	Arguments: []cmds.Argument{
@@ -64,9 +96,19 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinNameOptionName, "An optional name to label the pin(s) with."),
+		cmds.StringOption(pinMetaOptionName, "Optional metadata to attach to the pin(s), as comma separated key=value pairs."),
+		cmds.StringOption(pinExpireInOptionName, "Remove the pin(s) after the given duration, e.g. \"72h\"."),
+		cmds.BoolOption(pinBackgroundOptionName, "Pin in the background and return job IDs right away."),
+		cmds.StringOption(pinNamespaceOptionName, "Pin on behalf of the given namespace."),
 	},
 	Type: AddPinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -76,6 +118,30 @@ var addPinCmd = &cmds.Command{
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 		showProgress, _ := req.Options[pinProgressOptionName].(bool)
 
+		var info pin.Info
+		info.Name, _ = req.Options[pinNameOptionName].(string)
+		metaStr, _ := req.Options[pinMetaOptionName].(string)
+		if info.Meta, err = pin.ParseMeta(metaStr); err != nil {
+			return err
+		}
+		var expireIn time.Duration
+		if str, ok := req.Options[pinExpireInOptionName].(string); ok {
+			expireIn, err = time.ParseDuration(str)
+			if err != nil {
+				return err
+			}
+			if expireIn <= 0 {
+				return fmt.Errorf("pin expiry must be positive")
+			}
+		}
+
+		ns, _ := req.Options[pinNamespaceOptionName].(string)
+		if _, ok := req.Options[pinNamespaceOptionName]; ok {
+			if err := pin.ValidateNamespace(ns); err != nil {
+				return err
+			}
+		}
+
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
 		}
@@ -85,8 +151,24 @@ var addPinCmd = &cmds.Command{
 			return err
 		}
 
+		if background, _ := req.Options[pinBackgroundOptionName].(bool); background {
+			if ns != "" {
+				return fmt.Errorf("--%s cannot be used with --%s", pinNamespaceOptionName, pinBackgroundOptionName)
+			}
+			// the expiry is counted from when the job makes the pin
+			out, err := pinAddBackground(req.Context, api, n, enc, req.Arguments, recursive, expireIn, info)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, out)
+		}
+
+		if expireIn > 0 {
+			info.Expires = time.Now().Add(expireIn)
+		}
+
 		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(req.Context, api, n, enc, req.Arguments, recursive, info, ns)
 			if err != nil {
 				return err
 			}
@@ -104,7 +186,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(ctx, api, n, enc, req.Arguments, recursive, info, ns)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -144,6 +226,13 @@ var addPinCmd = &cmds.Command{
 				pintype = "directly"
 			}
 
+			if len(out.Jobs) > 0 {
+				for i, k := range out.Pins {
+					fmt.Fprintf(w, "queued %s to be pinned %s as job %s\n", k, pintype, out.Jobs[i])
+				}
+				return nil
+			}
+
 			for _, k := range out.Pins {
 				fmt.Fprintf(w, "pinned %s %s\n", k, pintype)
 			}
@@ -180,21 +269,102 @@ var addPinCmd = &cmds.Command{
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool) ([]string, error) {
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, n *core.IpfsNode, enc cidenc.Encoder, paths []string, recursive bool, info pin.Info, ns string) ([]string, error) {
+	nss := pin.NewNamespaces(n.Repo.Datastore(), n.Pinning)
 	added := make([]string, len(paths))
+	pinned := make([]cid.Cid, len(paths))
+	if ns == "" {
+		// recorded as held by the default namespace when other namespaces
+		// hold the content too
+		ns = pin.DefaultNamespace
+	}
 	for i, b := range paths {
 		rp, err := api.ResolvePath(ctx, path.New(b))
 		if err != nil {
 			return nil, err
 		}
-
-		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
+		if err := pinAddNamespaced(ctx, api, n, nss, ns, rp, recursive, info.Expires); err != nil {
 			return nil, err
 		}
 		added[i] = enc.Encode(rp.Cid())
+		pinned[i] = rp.Cid()
 	}
 
-	return added, nil
+	defer n.Blockstore.PinLock().Unlock()
+
+	changed := false
+	for _, c := range pinned {
+		// the expiry was set by the namespaces
+		ok, err := pin.AddInfo(n.Pinning, c, info)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || ok
+	}
+
+	if !changed {
+		return added, nil
+	}
+	return added, n.Pinning.Flush()
+}
+
+func pinAddNamespaced(ctx context.Context, api coreiface.CoreAPI, n *core.IpfsNode, nss *pin.Namespaces, ns string, rp path.Resolved, recursive bool, expires time.Time) error {
+	nd, err := api.ResolveNode(ctx, rp)
+	if err != nil {
+		return err
+	}
+
+	unlock := n.Blockstore.PinLock()
+	if err := nss.Pin(ctx, ns, nd, recursive, expires); err != nil {
+		unlock.Unlock()
+		return fmt.Errorf("pin: %s", err)
+	}
+	err = n.Pinning.Flush()
+	unlock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return n.Provider.Provide(rp.Cid())
+}
+
+func pinRmNamespaced(ctx context.Context, n *core.IpfsNode, nss *pin.Namespaces, ns string, c cid.Cid, recursive bool) error {
+	defer n.Blockstore.PinLock().Unlock()
+
+	if err := nss.Unpin(ctx, ns, c, recursive); err != nil {
+		return err
+	}
+	return n.Pinning.Flush()
+}
+
+func pinAddBackground(ctx context.Context, api coreiface.CoreAPI, n *core.IpfsNode, enc cidenc.Encoder, paths []string, recursive bool, expireIn time.Duration, info pin.Info) (*AddPinOutput, error) {
+	if n.PinJobs == nil {
+		return nil, ErrNotOnline
+	}
+
+	// resolve all the paths first, so that no job is queued if one is invalid
+	cids := make([]cid.Cid, len(paths))
+	for i, b := range paths {
+		rp, err := api.ResolvePath(ctx, path.New(b))
+		if err != nil {
+			return nil, err
+		}
+		cids[i] = rp.Cid()
+	}
+
+	out := &AddPinOutput{
+		Pins: make([]string, len(cids)),
+		Jobs: make([]string, len(cids)),
+	}
+	for i, c := range cids {
+		j, err := n.PinJobs.Add(c, recursive, expireIn, info)
+		if err != nil {
+			return nil, err
+		}
+		out.Pins[i] = enc.Encode(c)
+		out.Jobs[i] = j.ID
+	}
+	return out, nil
 }
 
 var rmPinCmd = &cmds.Command{
@@ -203,6 +373,9 @@ var rmPinCmd = &cmds.Command{
 		ShortDescription: `
 Removes the pin from the given object allowing it to be garbage
 collected if needed. (By default, recursively. Use -r=false for direct pins.)
+
+With --namespace, only the pin held by the given namespace is removed. The
+object stays pinned while other namespaces hold it.
 `,
 	},
 
@@ -211,9 +384,15 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively unpin the object linked to by the specified object(s).").WithDefault(true),
+		cmds.StringOption(pinNamespaceOptionName, "Remove the pin(s) held by the given namespace."),
 	},
 	Type: PinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -222,6 +401,14 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 		// set recursive flag
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 
+		ns, _ := req.Options[pinNamespaceOptionName].(string)
+		if _, ok := req.Options[pinNamespaceOptionName]; ok {
+			if err := pin.ValidateNamespace(ns); err != nil {
+				return err
+			}
+		}
+		nss := pin.NewNamespaces(n.Repo.Datastore(), n.Pinning)
+
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
 		}
@@ -240,7 +427,14 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 
 			id := enc.Encode(rp.Cid())
 			pins = append(pins, id)
-			if err := api.Pin().Rm(req.Context, rp, options.Pin.RmRecursive(recursive)); err != nil {
+
+			// Rm only removes the pins of the default namespace
+			if ns != "" {
+				err = pinRmNamespaced(req.Context, n, nss, ns, rp.Cid(), recursive)
+			} else {
+				err = api.Pin().Rm(req.Context, rp, options.Pin.RmRecursive(recursive))
+			}
+			if err != nil {
 				return err
 			}
 		}
@@ -259,8 +453,9 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 }
 
 const (
-	pinTypeOptionName  = "type"
-	pinQuietOptionName = "quiet"
+	pinTypeOptionName   = "type"
+	pinQuietOptionName  = "quiet"
+	pinStreamOptionName = "stream"
 )
 
 var listPinCmd = &cmds.Command{
@@ -290,6 +485,18 @@ With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
 
+Use --namespace=<namespace> to only list the direct and recursive pins held
+by the given namespace. The "default" namespace holds the pins made without
+a namespace.
+
+Use --stream to write the pins as they are listed, without keeping them all in
+memory. An object pinned both directly and indirectly is then listed twice.
+
+Use --name=<prefix> to only list the direct and recursive pins whose name
+starts with the given prefix. Names and metadata are attached with
+'ipfs pin add --name --meta'. Pins added with --expire-in also show their
+remaining lifetime.
+
 Example:
 	$ echo "hello" | ipfs add -q
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
@@ -313,6 +520,9 @@ Example:
 	Options: []cmds.Option{
 		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
+		cmds.StringOption(pinNameOptionName, "n", "Only list pins whose name starts with the given prefix."),
+		cmds.StringOption(pinNamespaceOptionName, "Only list the pins held by the given namespace."),
+		cmds.BoolOption(pinStreamOptionName, "s", "Write the pins as they are listed, instead of all at once at the end."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -342,21 +552,41 @@ Example:
 			return err
 		}
 
+		stream, _ := req.Options[pinStreamOptionName].(bool)
+		name, filterName := req.Options[pinNameOptionName].(string)
+
+		refKeys := make(map[string]RefKeyObject)
+		emit := func(c cid.Cid, obj RefKeyObject) error {
+			if filterName && (obj.Name == "" || !strings.HasPrefix(obj.Name, name)) {
+				return nil
+			}
+			if stream {
+				return res.Emit(&RefKeyList{Keys: map[string]RefKeyObject{enc.Encode(c): obj}})
+			}
+			refKeys[enc.Encode(c)] = obj
+			return nil
+		}
+
 		var keys map[cid.Cid]RefKeyObject
-		if len(req.Arguments) > 0 {
+		if ns, ok := req.Options[pinNamespaceOptionName].(string); ok {
+			keys, err = pinLsNamespace(req.Context, req.Arguments, typeStr, ns, n, api)
+		} else if len(req.Arguments) > 0 {
 			keys, err = pinLsKeys(req.Context, req.Arguments, typeStr, n, api)
 		} else {
-			keys, err = pinLsAll(req.Context, typeStr, n)
+			err = pinLsAll(req.Context, typeStr, n, emit)
 		}
 		if err != nil {
 			return err
 		}
-
-		refKeys := make(map[string]RefKeyObject, len(keys))
 		for k, v := range keys {
-			refKeys[enc.Encode(k)] = v
+			if err := emit(k, v); err != nil {
+				return err
+			}
 		}
 
+		if stream {
+			return nil
+		}
 		return cmds.EmitOnce(res, &RefKeyList{Keys: refKeys})
 	},
 	Type: RefKeyList{},
@@ -368,7 +598,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
+					fmt.Fprintf(w, "%s %s%s\n", k, v.Type, v.formatLabel())
 				}
 			}
 
@@ -387,7 +617,8 @@ var updatePinCmd = &cmds.Command{
 		ShortDescription: `
 Updates one pin to another, making sure that all objects in the new pin are
 local.  Then removes the old pin. This is an optimized version of adding the
-new pin and removing the old one.
+new pin and removing the old one. The name and metadata of the old pin are
+carried over to the new one.
 `,
 	},
 
@@ -439,15 +670,29 @@ new pin and removing the old one.
 
 const (
 	pinVerboseOptionName = "verbose"
+	pinRepairOptionName  = "repair"
 )
 
+// pinRepairTimeout bounds the time spent fetching a single missing block
+// during 'pin verify --repair'
+const pinRepairTimeout = time.Minute
+
 var verifyPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify that recursive pins are complete.",
+		ShortDescription: `
+Checks that all the blocks of the recursive pins are present and valid.
+
+With --repair, missing or corrupt blocks are fetched again from the network.
+Blocks which cannot be fetched, for example because the node is offline, are
+listed as unrecoverable for each broken pin. With --quiet, each of them is
+written as "<pin> <block>" on its own line.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(pinVerboseOptionName, "Also write the hashes of non-broken pins."),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of broken pins."),
+		cmds.BoolOption(pinRepairOptionName, "Fetch missing or corrupt blocks from the network."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -467,9 +712,12 @@ var verifyPinCmd = &cmds.Command{
 			return err
 		}
 
+		repair, _ := req.Options[pinRepairOptionName].(bool)
+
 		opts := pinVerifyOpts{
-			explain:   !quiet,
+			explain:   !quiet || repair,
 			includeOk: verbose,
+			repair:    repair,
 		}
 		out := pinVerify(req.Context, n, opts, enc)
 
@@ -479,8 +727,13 @@ var verifyPinCmd = &cmds.Command{
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinVerifyRes) error {
 			quiet, _ := req.Options[pinQuietOptionName].(bool)
+			repair, _ := req.Options[pinRepairOptionName].(bool)
 
-			if quiet && !out.Ok {
+			if quiet && !out.Ok && repair {
+				for _, e := range out.BadNodes {
+					fmt.Fprintf(w, "%s %s\n", out.Cid, e.Cid)
+				}
+			} else if quiet && !out.Ok {
 				fmt.Fprintf(w, "%s\n", out.Cid)
 			} else if !quiet {
 				out.Format(w)
@@ -492,7 +745,42 @@ var verifyPinCmd = &cmds.Command{
 }
 
 type RefKeyObject struct {
-	Type string
+	Type      string
+	Name      string            `json:",omitempty"`
+	Meta      map[string]string `json:",omitempty"`
+	ExpiresIn string            `json:",omitempty"`
+}
+
+func newRefKeyObject(typeStr string, info pin.Info) RefKeyObject {
+	obj := RefKeyObject{
+		Type: typeStr,
+		Name: info.Name,
+		Meta: info.Meta,
+	}
+	if !info.Expires.IsZero() {
+		if remaining := time.Until(info.Expires); remaining > 0 {
+			obj.ExpiresIn = remaining.Round(time.Second).String()
+		} else {
+			obj.ExpiresIn = "expired"
+		}
+	}
+	return obj
+}
+
+// formatLabel returns the label of the pin as appended to the text output of
+// 'pin ls'
+func (o RefKeyObject) formatLabel() string {
+	var s string
+	if o.Name != "" || len(o.Meta) > 0 {
+		s += fmt.Sprintf(" %q", o.Name)
+	}
+	if len(o.Meta) > 0 {
+		s += " " + pin.FormatMeta(o.Meta)
+	}
+	if o.ExpiresIn != "" {
+		s += " expires in " + o.ExpiresIn
+	}
+	return s
 }
 
 type RefKeyList struct {
@@ -528,44 +816,118 @@ func pinLsKeys(ctx context.Context, args []string, typeStr string, n *core.IpfsN
 		default:
 			pinType = "indirect through " + pinType
 		}
-		keys[c.Cid()] = RefKeyObject{
-			Type: pinType,
-		}
+		info, _ := n.Pinning.PinInfo(c.Cid())
+		keys[c.Cid()] = newRefKeyObject(pinType, info)
 	}
 
 	return keys, nil
 }
 
-func pinLsAll(ctx context.Context, typeStr string, n *core.IpfsNode) (map[cid.Cid]RefKeyObject, error) {
+// pinLsNamespace lists the direct and recursive pins held by a namespace,
+// optionally restricted to the given paths
+func pinLsNamespace(ctx context.Context, args []string, typeStr string, ns string, n *core.IpfsNode, api coreiface.CoreAPI) (map[cid.Cid]RefKeyObject, error) {
+	if typeStr == "indirect" {
+		return nil, fmt.Errorf("namespaces only hold direct and recursive pins")
+	}
+
+	held, err := pin.NewNamespaces(n.Repo.Datastore(), n.Pinning).Ls(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > 0 {
+		wanted := make(map[cid.Cid]pin.Mode, len(args))
+		for _, p := range args {
+			rp, err := api.ResolvePath(ctx, path.New(p))
+			if err != nil {
+				return nil, err
+			}
+			mode, ok := held[rp.Cid()]
+			if !ok {
+				return nil, fmt.Errorf("path '%s' is not pinned in namespace %s", p, ns)
+			}
+			wanted[rp.Cid()] = mode
+		}
+		held = wanted
+	}
 
 	keys := make(map[cid.Cid]RefKeyObject)
+	for c, mode := range held {
+		modeStr, _ := pin.ModeToString(mode)
+		if typeStr != "all" && typeStr != modeStr {
+			continue
+		}
+		info, _ := n.Pinning.PinInfo(c)
+		keys[c] = newRefKeyObject(modeStr, info)
+	}
+	return keys, nil
+}
 
-	AddToResultKeys := func(keyList []cid.Cid, typeStr string) {
-		for _, c := range keyList {
-			keys[c] = RefKeyObject{
-				Type: typeStr,
+// pinLsAll passes the pins of the given type to emit as they are listed. An
+// object pinned both directly and indirectly is passed twice, and the
+// indirect pins are passed after the recursive ones.
+func pinLsAll(ctx context.Context, typeStr string, n *core.IpfsNode, emit func(cid.Cid, RefKeyObject) error) error {
+	emitKeys := func(keys <-chan pin.StreamedCid, typeStr string) error {
+		for k := range keys {
+			if k.Err != nil {
+				return k.Err
+			}
+			info, _ := n.Pinning.PinInfo(k.C)
+			if err := emit(k.C, newRefKeyObject(typeStr, info)); err != nil {
+				return err
 			}
 		}
+		return ctx.Err()
 	}
 
 	if typeStr == "direct" || typeStr == "all" {
-		AddToResultKeys(n.Pinning.DirectKeys(), "direct")
+		if err := emitKeys(n.Pinning.DirectKeysChan(ctx), "direct"); err != nil {
+			return err
+		}
+	}
+	if typeStr == "recursive" || typeStr == "all" {
+		if err := emitKeys(n.Pinning.RecursiveKeysChan(ctx), "recursive"); err != nil {
+			return err
+		}
 	}
 	if typeStr == "indirect" || typeStr == "all" {
 		set := cid.NewSet()
-		for _, k := range n.Pinning.RecursiveKeys() {
-			err := dag.EnumerateChildren(ctx, dag.GetLinksWithDAG(n.DAG), k, set.Visit)
+		var emitErr error
+		visit := func(c cid.Cid) bool {
+			if emitErr != nil || !set.Visit(c) {
+				return false
+			}
+			if typeStr == "all" {
+				_, recursive, err := n.Pinning.IsPinnedWithType(c, pin.Recursive)
+				if err != nil {
+					emitErr = err
+					return false
+				}
+				if recursive {
+					// already listed, and its descendants are still walked
+					return true
+				}
+			}
+			info, _ := n.Pinning.PinInfo(c)
+			emitErr = emit(c, newRefKeyObject("indirect", info))
+			return emitErr == nil
+		}
+		for k := range n.Pinning.RecursiveKeysChan(ctx) {
+			if k.Err != nil {
+				return k.Err
+			}
+			err := dag.EnumerateChildren(ctx, dag.GetLinksWithDAG(n.DAG), k.C, visit)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			if emitErr != nil {
+				return emitErr
 			}
 		}
-		AddToResultKeys(set.Keys(), "indirect")
-	}
-	if typeStr == "recursive" || typeStr == "all" {
-		AddToResultKeys(n.Pinning.RecursiveKeys(), "recursive")
+		return ctx.Err()
 	}
 
-	return keys, nil
+	return nil
 }
 
 // PinVerifyRes is the result returned for each pin checked in "pin verify"
@@ -578,6 +940,7 @@ type PinVerifyRes struct {
 type PinStatus struct {
 	Ok       bool
 	BadNodes []BadNode `json:",omitempty"`
+	Repaired []string  `json:",omitempty"`
 }
 
 // BadNode is used in PinVerifyRes
@@ -589,6 +952,7 @@ type BadNode struct {
 type pinVerifyOpts struct {
 	explain   bool
 	includeOk bool
+	repair    bool
 }
 
 func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc cidenc.Encoder) <-chan interface{} {
@@ -599,6 +963,23 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 	getLinks := dag.GetLinksWithDAG(DAG)
 	recPins := n.Pinning.RecursiveKeys()
 
+	// refetch replaces a missing or corrupt block with a copy from the network
+	refetch := func(key cid.Cid) error {
+		if !n.IsOnline {
+			return fmt.Errorf("block unavailable and node is offline: %s", key)
+		}
+		if has, _ := bs.Has(key); has {
+			// the local copy could not be read, drop it so that it is fetched
+			if err := bs.DeleteBlock(key); err != nil {
+				return err
+			}
+		}
+		fctx, cancel := context.WithTimeout(ctx, pinRepairTimeout)
+		defer cancel()
+		_, err := n.Blocks.GetBlock(fctx, key)
+		return err
+	}
+
 	var checkPin func(root cid.Cid) PinStatus
 	checkPin = func(root cid.Cid) PinStatus {
 		key := root
@@ -616,6 +997,13 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 		}
 
 		links, err := getLinks(ctx, root)
+		repaired := false
+		if err != nil && opts.repair {
+			if err = refetch(root); err == nil {
+				links, err = getLinks(ctx, root)
+				repaired = err == nil
+			}
+		}
 		if err != nil {
 			status := PinStatus{Ok: false}
 			if opts.explain {
@@ -626,12 +1014,16 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 		}
 
 		status := PinStatus{Ok: true}
+		if repaired {
+			status.Repaired = []string{enc.Encode(key)}
+		}
 		for _, lnk := range links {
 			res := checkPin(lnk.Cid)
 			if !res.Ok {
 				status.Ok = false
 				status.BadNodes = append(status.BadNodes, res.BadNodes...)
 			}
+			status.Repaired = append(status.Repaired, res.Repaired...)
 		}
 
 		visited[key] = status
@@ -642,8 +1034,18 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 	go func() {
 		defer close(out)
 		for _, cid := range recPins {
-			pinStatus := checkPin(cid)
-			if !pinStatus.Ok || opts.includeOk {
+			var pinStatus PinStatus
+			if opts.repair {
+				// keep the garbage collector from removing the blocks
+				// fetched for this pin until it is checked, without
+				// holding it off for the whole verification
+				unlocker := n.Blockstore.PinLock()
+				pinStatus = checkPin(cid)
+				unlocker.Unlock()
+			} else {
+				pinStatus = checkPin(cid)
+			}
+			if !pinStatus.Ok || opts.includeOk || len(pinStatus.Repaired) > 0 {
 				select {
 				case out <- &PinVerifyRes{enc.Encode(cid), pinStatus}:
 				case <-ctx.Done():
@@ -658,12 +1060,20 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 
 // Format formats PinVerifyRes
 func (r PinVerifyRes) Format(out io.Writer) {
-	if r.Ok {
+	if r.Ok && len(r.Repaired) > 0 {
+		fmt.Fprintf(out, "%s repaired\n", r.Cid)
+		for _, c := range r.Repaired {
+			fmt.Fprintf(out, "  %s: fetched\n", c)
+		}
+	} else if r.Ok {
 		fmt.Fprintf(out, "%s ok\n", r.Cid)
 	} else {
 		fmt.Fprintf(out, "%s broken\n", r.Cid)
 		for _, e := range r.BadNodes {
 			fmt.Fprintf(out, "  %s: %s\n", e.Cid, e.Err)
 		}
+		for _, c := range r.Repaired {
+			fmt.Fprintf(out, "  %s: fetched\n", c)
+		}
 	}
 }
@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	pinjobs "github.com/ipfs/go-ipfs/pin/jobs"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var pinJobsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage background pin jobs.",
+		ShortDescription: `
+Pin jobs are created by 'ipfs pin add --background'. They are run by the
+daemon, and resumed when it restarts. Finished jobs are remembered for a day.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"ls":     pinJobsLsCmd,
+		"status": pinJobsStatusCmd,
+		"cancel": pinJobsCancelCmd,
+	},
+}
+
+// PinJobOutput describes a background pin job
+type PinJobOutput struct {
+	ID        string
+	Cid       string
+	Recursive bool
+	Name      string `json:",omitempty"`
+	State     string
+	Error     string `json:",omitempty"`
+	Progress  int
+	Created   time.Time
+	Updated   time.Time
+}
+
+func newPinJobOutput(req *cmds.Request, j pinjobs.Job) (*PinJobOutput, error) {
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return nil, err
+	}
+	return &PinJobOutput{
+		ID:        j.ID,
+		Cid:       enc.Encode(j.Cid),
+		Recursive: j.Recursive,
+		Name:      j.Info.Name,
+		State:     string(j.State),
+		Error:     j.Err,
+		Progress:  j.Progress,
+		Created:   j.Created,
+		Updated:   j.Updated,
+	}, nil
+}
+
+func (o *PinJobOutput) format(w io.Writer) {
+	fmt.Fprintf(w, "%s %s %s", o.ID, o.Cid, o.State)
+	if o.State == string(pinjobs.Running) {
+		fmt.Fprintf(w, " (%d nodes fetched)", o.Progress)
+	}
+	if o.Name != "" {
+		fmt.Fprintf(w, " name=%s", o.Name)
+	}
+	if o.Error != "" {
+		fmt.Fprintf(w, ": %s", o.Error)
+	}
+	fmt.Fprintln(w)
+}
+
+func getPinJobs(env cmds.Environment) (*core.IpfsNode, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.PinJobs == nil {
+		return nil, ErrNotOnline
+	}
+	return n, nil
+}
+
+var pinJobsLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List background pin jobs.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := getPinJobs(env)
+		if err != nil {
+			return err
+		}
+
+		for _, j := range n.PinJobs.List() {
+			out, err := newPinJobOutput(req, j)
+			if err != nil {
+				return err
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: PinJobOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinJobOutput) error {
+			out.format(w)
+			return nil
+		}),
+	},
+}
+
+var pinJobsStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the status of a background pin job.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("id", true, false, "ID of the pin job."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := getPinJobs(env)
+		if err != nil {
+			return err
+		}
+
+		j, err := n.PinJobs.Get(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		out, err := newPinJobOutput(req, j)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: PinJobOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinJobOutput) error {
+			out.format(w)
+			return nil
+		}),
+	},
+}
+
+var pinJobsCancelCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Cancel a queued or running pin job.",
+		ShortDescription: `
+Content fetched by a canceled job is not pinned, and is removed by the next
+garbage collection.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("id", true, true, "IDs of the pin jobs to cancel.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := getPinJobs(env)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range req.Arguments {
+			if err := n.PinJobs.Cancel(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	pin "github.com/ipfs/go-ipfs/pin"
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	pinServiceOptionName = "service"
+	pinStatusOptionName  = "status"
+	pinCidOptionName     = "cid"
+
+	// remoteServicesConfigKey holds the remote pinning services, by name.
+	// Each of them has an Endpoint and an access Key.
+	remoteServicesConfigKey = "Pinning.RemoteServices"
+)
+
+var remotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin (and unpin) objects to remote pinning services.",
+		ShortDescription: `
+Remote pinning services store content on behalf of this node. They are set up
+in the config, under a name passed to the --service option of each command:
+
+  > ipfs config Pinning.RemoteServices.mysrv.Endpoint https://pins.example.com/api/v1
+  > ipfs config Pinning.RemoteServices.mysrv.Key <access token>
+
+The services must implement the HTTP pinning service API.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"add": addRemotePinCmd,
+		"ls":  lsRemotePinCmd,
+		"rm":  rmRemotePinCmd,
+	},
+}
+
+// RemotePinOutput describes a pin request on a remote service
+type RemotePinOutput struct {
+	RequestID string
+	Cid       string
+	Name      string `json:",omitempty"`
+	Status    string
+	Created   time.Time
+}
+
+func newRemotePinOutput(st remote.PinStatus) *RemotePinOutput {
+	return &RemotePinOutput{
+		RequestID: st.RequestID,
+		Cid:       st.Pin.Cid,
+		Name:      st.Pin.Name,
+		Status:    string(st.Status),
+		Created:   st.Created,
+	}
+}
+
+var remotePinEncoderMap = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RemotePinOutput) error {
+		fmt.Fprintf(w, "%s %s %s", out.RequestID, out.Cid, out.Status)
+		if out.Name != "" {
+			fmt.Fprintf(w, " %s", out.Name)
+		}
+		fmt.Fprintln(w)
+		return nil
+	}),
+}
+
+// getRemotePinning returns the remote pinning API of the node, and a client
+// for the service named in the request
+func getRemotePinning(req *cmds.Request, env cmds.Environment) (*coreapi.RemotePinAPI, remote.Client, error) {
+	name, _ := req.Options[pinServiceOptionName].(string)
+	if name == "" {
+		return nil, nil, fmt.Errorf("no remote pinning service given, use --%s", pinServiceOptionName)
+	}
+
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	capi, ok := api.(*coreapi.CoreAPI)
+	if !ok {
+		return nil, nil, fmt.Errorf("remote pinning is not supported by this API")
+	}
+
+	prefix := remoteServicesConfigKey + "." + name + "."
+	endpoint, err := repo.ConfigString(n.Repo, prefix+"Endpoint", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if endpoint == "" {
+		return nil, nil, fmt.Errorf("remote pinning service %q is not configured", name)
+	}
+	key, err := repo.ConfigString(n.Repo, prefix+"Key", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return capi.RemotePin(), remote.NewHTTPClient(endpoint, key), nil
+}
+
+var addRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Ask a remote pinning service to pin objects.",
+		ShortDescription: `
+Creates a pin request on the service for each path. The service fetches the
+content in the background; use 'ipfs pin remote ls' to follow its progress.
+When the node is online, its addresses are passed to the service so that it
+can fetch the content from this node.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, true, "Path to object(s) to be pinned.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmds.StringOption(pinNameOptionName, "An optional name for the pin(s)."),
+		cmds.StringOption(pinMetaOptionName, "Metadata for the pin(s), as comma separated key=value pairs."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, client, err := getRemotePinning(req, env)
+		if err != nil {
+			return err
+		}
+
+		name, _ := req.Options[pinNameOptionName].(string)
+		metaStr, _ := req.Options[pinMetaOptionName].(string)
+		meta, err := pin.ParseMeta(metaStr)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range req.Arguments {
+			st, err := api.Add(req.Context, client, path.New(p), name, meta)
+			if err != nil {
+				return err
+			}
+			if err := res.Emit(newRemotePinOutput(st)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type:     RemotePinOutput{},
+	Encoders: remotePinEncoderMap,
+}
+
+var lsRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the pin requests of a remote pinning service.",
+		ShortDescription: `
+Only pinned requests are listed by default. Use --status to list requests in
+other states, e.g. --status=queued,pinning,pinned,failed.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmds.StringOption(pinNameOptionName, "Only list pins with this name."),
+		cmds.StringOption(pinCidOptionName, "Only list pins of these comma separated CIDs."),
+		cmds.StringOption(pinStatusOptionName, "Only list pins in these comma separated states."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, client, err := getRemotePinning(req, env)
+		if err != nil {
+			return err
+		}
+
+		var opts remote.ListOptions
+		opts.Name, _ = req.Options[pinNameOptionName].(string)
+		if cids, _ := req.Options[pinCidOptionName].(string); cids != "" {
+			for _, s := range strings.Split(cids, ",") {
+				c, err := cid.Decode(s)
+				if err != nil {
+					return err
+				}
+				opts.Cids = append(opts.Cids, c)
+			}
+		}
+		if status, _ := req.Options[pinStatusOptionName].(string); status != "" {
+			for _, s := range strings.Split(status, ",") {
+				switch st := remote.Status(s); st {
+				case remote.Queued, remote.Pinning, remote.Pinned, remote.Failed:
+					opts.Status = append(opts.Status, st)
+				default:
+					return fmt.Errorf("invalid pin status %q", s)
+				}
+			}
+		}
+
+		pins, err := api.Ls(req.Context, client, opts)
+		if err != nil {
+			return err
+		}
+		for _, st := range pins {
+			if err := res.Emit(newRemotePinOutput(st)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type:     RemotePinOutput{},
+	Encoders: remotePinEncoderMap,
+}
+
+var rmRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove pin requests from a remote pinning service.",
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("request-id", true, true, "IDs of the pin requests to remove.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, client, err := getRemotePinning(req, env)
+		if err != nil {
+			return err
+		}
+		return api.Rm(req.Context, client, req.Arguments...)
+	},
+}
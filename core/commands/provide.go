@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/provider"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var ProvideCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Interact with the provider system.",
+		ShortDescription: `
+The provider system announces the content of the node to the network.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"stat": provideStatCmd,
+	},
+}
+
+var provideStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show statistics about the provider system.",
+		ShortDescription: `
+Print the number of CIDs waiting to be announced, the number of announce
+workers, how many CIDs were announced or failed to be announced since the
+node started, and the number of CIDs announced per second over the last
+minute.
+
+The announcements can be tuned with the following settings:
+
+  Provider.Workers     number of concurrent announce workers (default: 8)
+  Provider.RateLimit   maximum number of CIDs announced per second (default: 0, no limit)
+  Provider.BatchSize   number of queued CIDs a worker announces at once (default: 8)
+
+A failed announcement is queued again after a minute, then after twice as
+long with every further failure. After 6 retries the CID is left to the next
+reprovide. The CIDs left unannounced when the daemon stops are announced on
+the next start.
+`,
+	},
+	Type: provider.Stats{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline {
+			return cmds.Errorf(cmds.ErrClient, ErrNotOnline.Error())
+		}
+
+		st, err := nd.Provider.Stat()
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &st)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *provider.Stats) error {
+			fmt.Fprintln(w, "provider status")
+			fmt.Fprintf(w, "\tqueue length: %d\n", s.QueueLength)
+			fmt.Fprintf(w, "\tworkers: %d\n", s.Workers)
+			fmt.Fprintf(w, "\tprovided: %d\n", s.Provided)
+			fmt.Fprintf(w, "\tfailed: %d\n", s.Failed)
+			fmt.Fprintf(w, "\tthroughput: %.2f/s\n", s.Throughput)
+			return nil
+		}),
+	},
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"text/tabwriter"
@@ -15,12 +16,17 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	dspinner "github.com/ipfs/go-ipfs/pin/dspinner"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
+	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	config "github.com/ipfs/go-ipfs-config"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	dag "github.com/ipfs/go-merkledag"
 )
 
 type RepoVersion struct {
@@ -36,23 +42,50 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"stat":    repoStatCmd,
-		"gc":      repoGcCmd,
-		"fsck":    repoFsckCmd,
-		"version": repoVersionCmd,
-		"verify":  repoVerifyCmd,
+		"stat":             repoStatCmd,
+		"gc":               repoGcCmd,
+		"fsck":             repoFsckCmd,
+		"version":          repoVersionCmd,
+		"verify":           repoVerifyCmd,
+		"encrypt-keystore": repoEncryptKeystoreCmd,
+		"migrate-pins":     repoMigratePinsCmd,
 	},
 }
 
 // GcResult is the result returned by "repo gc" command.
 type GcResult struct {
 	Key   cid.Cid
+	Size  int    `json:",omitempty"`
 	Error string `json:",omitempty"`
+
+	// Reclaimable is only set with --dry-run
+	Reclaimable *GcReport `json:",omitempty"`
+}
+
+// GcReport is the space a garbage collection would reclaim, as reported by
+// "repo gc --dry-run".
+type GcReport struct {
+	GcCodecReport
+	Codecs map[string]GcCodecReport
+}
+
+// GcCodecReport counts the blocks of one codec in a GcReport
+type GcCodecReport struct {
+	Blocks uint64
+	Bytes  uint64
+}
+
+func (r *GcCodecReport) add(size int) {
+	r.Blocks++
+	if size > 0 {
+		r.Bytes += uint64(size)
+	}
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoDryRunOptionName       = "dry-run"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -62,11 +95,15 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+With --dry-run, nothing is removed: the number of blocks and bytes that
+would be freed is reported instead, broken down by codec.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmds.BoolOption(repoDryRunOptionName, "Report the space a garbage collection would reclaim, without removing anything."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -74,6 +111,24 @@ order to reclaim hard disk space.
 			return err
 		}
 
+		if dryRun, _ := req.Options[repoDryRunOptionName].(bool); dryRun {
+			report := &GcReport{Codecs: make(map[string]GcCodecReport)}
+			err := corerepo.CollectResultWithSize(req.Context, corerepo.GarbageCollectDryRun(n, req.Context), func(k cid.Cid, size int) {
+				codec, ok := cid.CodecToStr[k.Type()]
+				if !ok {
+					codec = fmt.Sprintf("0x%x", k.Type())
+				}
+				cr := report.Codecs[codec]
+				cr.add(size)
+				report.Codecs[codec] = cr
+				report.add(size)
+			})
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(re, &GcResult{Reclaimable: report})
+		}
+
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
 
 		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
@@ -87,7 +142,7 @@ order to reclaim hard disk space.
 					}
 					errs = true
 				} else {
-					if err := re.Emit(&GcResult{Key: res.KeyRemoved}); err != nil {
+					if err := re.Emit(&GcResult{Key: res.KeyRemoved, Size: res.Size}); err != nil {
 						return err
 					}
 				}
@@ -96,11 +151,11 @@ order to reclaim hard disk space.
 				return errors.New("encountered errors during gc run")
 			}
 		} else {
-			err := corerepo.CollectResult(req.Context, gcOutChan, func(k cid.Cid) {
+			err := corerepo.CollectResultWithSize(req.Context, gcOutChan, func(k cid.Cid, size int) {
 				// Nothing to do with this error, really. This
 				// most likely means that the client is gone but
 				// we still need to let the GC finish.
-				_ = re.Emit(&GcResult{Key: k})
+				_ = re.Emit(&GcResult{Key: k, Size: size})
 			})
 			if err != nil {
 				return err
@@ -119,6 +174,25 @@ order to reclaim hard disk space.
 				return err
 			}
 
+			if r := gcr.Reclaimable; r != nil {
+				if quiet {
+					_, err := fmt.Fprintf(w, "%d %d\n", r.Blocks, r.Bytes)
+					return err
+				}
+
+				fmt.Fprintf(w, "would remove %d blocks, %s\n", r.Blocks, humanize.Bytes(r.Bytes))
+				codecs := make([]string, 0, len(r.Codecs))
+				for codec := range r.Codecs {
+					codecs = append(codecs, codec)
+				}
+				sort.Strings(codecs)
+				for _, codec := range codecs {
+					cr := r.Codecs[codec]
+					fmt.Fprintf(w, "  %s: %d blocks, %s\n", codec, cr.Blocks, humanize.Bytes(cr.Bytes))
+				}
+				return nil
+			}
+
 			prefix := "removed "
 			if quiet {
 				prefix = ""
@@ -375,6 +449,103 @@ var repoVerifyCmd = &cmds.Command{
 	},
 }
 
+const passphraseFdOptionName = "passphrase-fd"
+
+var repoEncryptKeystoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the keystore with a passphrase.",
+		ShortDescription: `
+'ipfs repo encrypt-keystore' seals the keys of the keystore with a key derived
+from a passphrase, so that they cannot be used by whoever can read the repo.
+The passphrase is asked for, unless it is given in the
+IPFS_KEYSTORE_PASSPHRASE environment variable or read from the file descriptor
+given with --passphrase-fd. This command can only run when no ipfs daemons
+are running.
+
+The daemon then needs the passphrase to start, see 'ipfs daemon --help', and
+so do the commands using the keys when the daemon is not running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(passphraseFdOptionName, "Read the passphrase from this file descriptor."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		fd, found := req.Options[passphraseFdOptionName].(int)
+		if !found {
+			fd = -1
+		}
+		pass, err := keystore.ReadPassphrase(fd, true)
+		if err != nil {
+			return err
+		}
+
+		if err := keystore.EncryptFSKeystore(filepath.Join(configRoot, "keystore"), pass); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &MessageOutput{"The keystore has been encrypted.\n"})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			fmt.Fprintf(w, out.Message)
+			return nil
+		}),
+	},
+}
+
+var repoMigratePinsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Convert the pins to the datastore pinner.",
+		ShortDescription: `
+'ipfs repo migrate-pins' moves the pins from the pin set DAG to one datastore
+key per pin, and switches the repo to the datastore pinner. The conversion is
+one way, and can safely be run again if it was interrupted. This command can
+only run when no ipfs daemons are running.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		r, err := fsrepo.Open(configRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		d := r.Datastore()
+		migrated, err := dspinner.Initialized(d)
+		if err != nil {
+			return err
+		}
+		if migrated {
+			return cmds.EmitOnce(res, &MessageOutput{"The repo already uses the datastore pinner.\n"})
+		}
+
+		bs := bstore.NewBlockstore(d)
+		dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+		n, err := dspinner.ConvertFromDAG(req.Context, d, dserv, dserv)
+		if err != nil {
+			return fmt.Errorf("failed to convert the pins: %s", err)
+		}
+		return cmds.EmitOnce(res, &MessageOutput{fmt.Sprintf("Converted %d pins to the datastore pinner.\n", n)})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			fmt.Fprintf(w, out.Message)
+			return nil
+		}),
+	},
+}
+
 var repoVersionCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the repo version.",
@@ -23,6 +23,7 @@ import (
 	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	"github.com/ipfs/go-ipfs/p2p"
 	"github.com/ipfs/go-ipfs/pin"
+	pinjobs "github.com/ipfs/go-ipfs/pin/jobs"
 	"github.com/ipfs/go-ipfs/provider"
 	"github.com/ipfs/go-ipfs/repo"
 
@@ -93,6 +94,7 @@ type IpfsNode struct {
 	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
 	Provider     provider.System     // the value provider system
 	IpnsRepub    *ipnsrp.Republisher `optional:"true"`
+	PinJobs      *pinjobs.Manager    `optional:"true"` // the background pinning service
 
 	AutoNAT  *autonat.AutoNATService    `optional:"true"`
 	PubSub   *pubsub.PubSub             `optional:"true"`
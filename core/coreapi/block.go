@@ -56,6 +56,9 @@ func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.Bloc
 
 	if settings.Pin {
 		api.pinning.PinWithMode(b.Cid(), pin.Recursive)
+		if err := (*CoreAPI)(api).pinNamespaces().RecordPin(b.Cid(), pin.Recursive); err != nil {
+			return nil, err
+		}
 	}
 
 	return &BlockStat{path: path.IpldPath(b.Cid()), size: len(data)}, nil
@@ -215,7 +215,11 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		}
 
 		subApi.routing = offlineroute.NewOfflineRouter(subApi.repo.Datastore(), subApi.recordValidator)
-		subApi.namesys = namesys.NewNameSystem(subApi.routing, subApi.repo.Datastore(), cs)
+		dns, err := node.DNSResolver(subApi.repo)
+		if err != nil {
+			return nil, err
+		}
+		subApi.namesys = namesys.NewNameSystem(subApi.routing, subApi.repo.Datastore(), cs, namesys.WithDNSResolver(dns))
 		subApi.provider = provider.NewOfflineProvider()
 
 		subApi.peerstore = nil
@@ -242,3 +246,9 @@ func (api *CoreAPI) getSession(ctx context.Context) *CoreAPI {
 
 	return &sesApi
 }
+
+// pinNamespaces returns the pin namespaces of the node, which every pin made
+// by the API goes through or is recorded in
+func (api *CoreAPI) pinNamespaces() *pin.Namespaces {
+	return pin.NewNamespaces(api.repo.Datastore(), api.pinning)
+}
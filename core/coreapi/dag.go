@@ -25,6 +25,9 @@ func (adder *pinningAdder) Add(ctx context.Context, nd ipld.Node) error {
 	}
 
 	adder.pinning.PinWithMode(nd.Cid(), pin.Recursive)
+	if err := (*CoreAPI)(adder).pinNamespaces().RecordPin(nd.Cid(), pin.Recursive); err != nil {
+		return err
+	}
 
 	return adder.pinning.Flush()
 }
@@ -37,11 +40,15 @@ func (adder *pinningAdder) AddMany(ctx context.Context, nds []ipld.Node) error {
 	}
 
 	cids := cid.NewSet()
+	nss := (*CoreAPI)(adder).pinNamespaces()
 
 	for _, nd := range nds {
 		c := nd.Cid()
 		if cids.Visit(c) {
 			adder.pinning.PinWithMode(c, pin.Recursive)
+			if err := nss.RecordPin(c, pin.Recursive); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ipfs/go-ipfs/core/node"
 	"github.com/ipfs/go-ipfs/keystore"
 	"github.com/ipfs/go-ipfs/namesys"
 
@@ -95,10 +96,14 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 	var resolver namesys.Resolver = api.namesys
 
 	if !options.Cache {
-		resolver = namesys.NewNameSystem(api.routing, api.repo.Datastore(), 0)
+		dns, err := node.DNSResolver(api.repo)
+		if err != nil {
+			return nil, err
+		}
+		resolver = namesys.NewNameSystem(api.routing, api.repo.Datastore(), 0, namesys.WithDNSResolver(dns))
 	}
 
-	if !strings.HasPrefix(name, "/ipns/") {
+	if !strings.HasPrefix(name, "/ipns/") && !namesys.HasRegisteredResolver(name) {
 		name = "/ipns/" + name
 	}
 
@@ -119,6 +119,9 @@ func (api *ObjectAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.Obj
 
 	if options.Pin {
 		api.pinning.PinWithMode(dagnode.Cid(), pin.Recursive)
+		if err := (*CoreAPI)(api).pinNamespaces().RecordPin(dagnode.Cid(), pin.Recursive); err != nil {
+			return nil, err
+		}
 		err = api.pinning.Flush()
 		if err != nil {
 			return nil, err
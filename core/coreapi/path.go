@@ -5,6 +5,7 @@ import (
 	"fmt"
 	gopath "path"
 
+	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/namesys/resolve"
 
 	"github.com/ipfs/go-cid"
@@ -37,8 +38,11 @@ func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (path.Resolved
 	if _, ok := p.(path.Resolved); ok {
 		return p.(path.Resolved), nil
 	}
-	if err := p.IsValid(); err != nil {
-		return nil, err
+	// names under custom prefixes are only valid paths once resolved
+	if !namesys.HasRegisteredResolver(p.String()) {
+		if err := p.IsValid(); err != nil {
+			return nil, err
+		}
 	}
 
 	ipath := ipfspath.Path(p.String())
@@ -3,6 +3,9 @@ package coreapi
 import (
 	"context"
 	"fmt"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
 
 	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
@@ -28,7 +31,7 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 
 	defer api.blockstore.PinLock().Unlock()
 
-	err = api.pinning.Pin(ctx, dagNode, settings.Recursive)
+	err = (*CoreAPI)(api).pinNamespaces().Pin(ctx, pin.DefaultNamespace, dagNode, settings.Recursive, time.Time{})
 	if err != nil {
 		return fmt.Errorf("pin: %s", err)
 	}
@@ -67,7 +70,10 @@ func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOpti
 		return err
 	}
 
-	if err = api.pinning.Unpin(ctx, rp.Cid(), settings.Recursive); err != nil {
+	defer api.blockstore.PinLock().Unlock()
+
+	// only the pins of the default namespace can be removed here
+	if err = (*CoreAPI)(api).pinNamespaces().Unpin(ctx, pin.DefaultNamespace, rp.Cid(), settings.Recursive); err != nil {
 		return err
 	}
 
@@ -92,7 +98,25 @@ func (api *PinAPI) Update(ctx context.Context, from path.Path, to path.Path, opt
 
 	defer api.blockstore.PinLock().Unlock()
 
-	err = api.pinning.Update(ctx, fp.Cid(), tp.Cid(), settings.Unpin)
+	// content held by namespaces is updated in the default namespace only
+	nss := (*CoreAPI)(api).pinNamespaces()
+	fromHolders, err := nss.Holders(fp.Cid())
+	if err != nil {
+		return err
+	}
+	toHolders, err := nss.Holders(tp.Cid())
+	if err != nil {
+		return err
+	}
+	if len(fromHolders) > 0 || len(toHolders) > 0 {
+		toNode, err := api.core().ResolveNode(ctx, tp)
+		if err != nil {
+			return err
+		}
+		err = nss.Update(ctx, pin.DefaultNamespace, fp.Cid(), toNode, settings.Unpin)
+	} else {
+		err = api.pinning.Update(ctx, fp.Cid(), tp.Cid(), settings.Unpin)
+	}
 	if err != nil {
 		return err
 	}
@@ -173,9 +197,67 @@ func (api *PinAPI) Verify(ctx context.Context) (<-chan coreiface.PinStatus, erro
 	return out, nil
 }
 
+// SetInfo attaches a name and metadata to an existing direct or recursive
+// pin. An empty Info removes the label.
+func (api *PinAPI) SetInfo(ctx context.Context, p path.Path, info pin.Info) error {
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	defer api.blockstore.PinLock().Unlock()
+
+	if err := api.pinning.SetPinInfo(rp.Cid(), info); err != nil {
+		return err
+	}
+
+	return api.pinning.Flush()
+}
+
+// LsByName lists the direct and recursive pins whose name starts with the
+// given prefix. The returned pins implement LabeledPin.
+func (api *PinAPI) LsByName(ctx context.Context, prefix string) ([]coreiface.Pin, error) {
+	var out []coreiface.Pin
+
+	addMatching := func(keyList []cid.Cid, typeStr string) {
+		for _, c := range keyList {
+			info, _ := api.pinning.PinInfo(c)
+			if !info.HasNamePrefix(prefix) {
+				continue
+			}
+			out = append(out, &pinInfo{
+				pinType: typeStr,
+				path:    path.IpldPath(c),
+				info:    info,
+			})
+		}
+	}
+
+	addMatching(api.pinning.DirectKeys(), "direct")
+	addMatching(api.pinning.RecursiveKeys(), "recursive")
+
+	return out, nil
+}
+
+// LabeledPin is implemented by the pins returned from the PinAPI. It exposes
+// the optional label attached to direct and recursive pins.
+type LabeledPin interface {
+	coreiface.Pin
+
+	// Name returns the name of the pin, if any
+	Name() string
+
+	// Meta returns the metadata attached to the pin, if any
+	Meta() map[string]string
+
+	// Expires returns when the pin expires, or the zero time if it never does
+	Expires() time.Time
+}
+
 type pinInfo struct {
 	pinType string
 	path    path.Resolved
+	info    pin.Info
 }
 
 func (p *pinInfo) Path() path.Resolved {
@@ -186,15 +268,29 @@ func (p *pinInfo) Type() string {
 	return p.pinType
 }
 
+func (p *pinInfo) Name() string {
+	return p.info.Name
+}
+
+func (p *pinInfo) Meta() map[string]string {
+	return p.info.Meta
+}
+
+func (p *pinInfo) Expires() time.Time {
+	return p.info.Expires
+}
+
 func (api *PinAPI) pinLsAll(typeStr string, ctx context.Context) ([]coreiface.Pin, error) {
 
 	keys := make(map[cid.Cid]*pinInfo)
 
 	AddToResultKeys := func(keyList []cid.Cid, typeStr string) {
 		for _, c := range keyList {
+			info, _ := api.pinning.PinInfo(c)
 			keys[c] = &pinInfo{
 				pinType: typeStr,
 				path:    path.IpldPath(c),
+				info:    info,
 			}
 		}
 	}
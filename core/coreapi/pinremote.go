@@ -0,0 +1,69 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// RemotePinAPI pins content on remote pinning services. The services are
+// reached through a remote.Client, so that any implementation of it can be
+// plugged in.
+type RemotePinAPI CoreAPI
+
+// RemotePin returns the RemotePinAPI backed by the go-ipfs node
+func (api *CoreAPI) RemotePin() *RemotePinAPI {
+	return (*RemotePinAPI)(api)
+}
+
+// Add asks the service to pin the given path. When the node is online, its
+// addresses are sent along as origins so that the service can fetch the
+// content from it directly.
+func (api *RemotePinAPI) Add(ctx context.Context, client remote.Client, p path.Path, name string, meta map[string]string) (remote.PinStatus, error) {
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return remote.PinStatus{}, fmt.Errorf("pin remote: %s", err)
+	}
+
+	return client.Add(ctx, remote.Pin{
+		Cid:     rp.Cid().String(),
+		Name:    name,
+		Origins: api.origins(),
+		Meta:    meta,
+	})
+}
+
+// Ls lists the pin requests of the service matching the given options
+func (api *RemotePinAPI) Ls(ctx context.Context, client remote.Client, opts remote.ListOptions) ([]remote.PinStatus, error) {
+	return client.Ls(ctx, opts)
+}
+
+// Rm removes pin requests from the service
+func (api *RemotePinAPI) Rm(ctx context.Context, client remote.Client, requestIDs ...string) error {
+	for _, id := range requestIDs {
+		if err := client.Rm(ctx, id); err != nil {
+			return fmt.Errorf("pin remote: %s: %s", id, err)
+		}
+	}
+	return nil
+}
+
+func (api *RemotePinAPI) origins() []string {
+	if api.peerHost == nil {
+		return nil
+	}
+
+	var out []string
+	for _, a := range api.peerHost.Addrs() {
+		out = append(out, a.String()+"/ipfs/"+api.identity.Pretty())
+	}
+	return out
+}
+
+func (api *RemotePinAPI) core() coreiface.CoreAPI {
+	return (*CoreAPI)(api)
+}
@@ -9,6 +9,7 @@ import (
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
@@ -20,6 +21,12 @@ type GatewayConfig struct {
 	PathPrefixes []string
 }
 
+// GatewayPaths returns the paths a gateway serves: /ipfs, /ipns, and the name
+// prefixes with a resolver registered by a plugin
+func GatewayPaths() []string {
+	return append([]string{"/ipfs", "/ipns"}, namesys.RegisteredPrefixes()...)
+}
+
 // A helper function to clean up a set of headers:
 // 1. Canonicalizes.
 // 2. Deduplicates.
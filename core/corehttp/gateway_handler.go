@@ -14,6 +14,7 @@ import (
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/dagutils"
+	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/namesys/resolve"
 
 	"github.com/dustin/go-humanize"
@@ -153,7 +154,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	parsedPath := ipath.New(urlPath)
-	if err := parsedPath.IsValid(); err != nil {
+	if err := parsedPath.IsValid(); err != nil && !namesys.HasRegisteredResolver(urlPath) {
 		webError(w, "invalid ipfs path", err, http.StatusBadRequest)
 		return
 	}
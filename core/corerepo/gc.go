@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/node"
 	gc "github.com/ipfs/go-ipfs/pin/gc"
 	repo "github.com/ipfs/go-ipfs/repo"
 
@@ -27,6 +29,11 @@ type GC struct {
 	StorageGC  uint64
 	SlackGB    uint64
 	Storage    uint64
+
+	// EvictLRU makes the GC only remove the least recently used unpinned
+	// blocks, until the usage drops to StorageTarget
+	EvictLRU      bool
+	StorageTarget uint64
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
@@ -65,12 +72,26 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		slackGB = 1
 	}
 
+	eviction, err := repo.ConfigString(r, node.GCEvictionConfigKey, "")
+	if err != nil {
+		return nil, err
+	}
+	targetPct, err := repo.ConfigInt(r, node.GCEvictionTargetConfigKey, 80)
+	if err != nil {
+		return nil, err
+	}
+	if eviction == "lru" && (targetPct <= 0 || targetPct >= cfg.Datastore.StorageGCWatermark) {
+		return nil, fmt.Errorf("%s must be between 0 and Datastore.StorageGCWatermark", node.GCEvictionTargetConfigKey)
+	}
+
 	return &GC{
-		Node:       n,
-		Repo:       r,
-		StorageMax: storageMax,
-		StorageGC:  storageGC,
-		SlackGB:    slackGB,
+		Node:          n,
+		Repo:          r,
+		StorageMax:    storageMax,
+		StorageGC:     storageGC,
+		SlackGB:       slackGB,
+		EvictLRU:      eviction == "lru",
+		StorageTarget: storageMax * uint64(targetPct) / 100,
 	}, nil
 }
 
@@ -83,12 +104,47 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 	return []cid.Cid{rootDag.Cid()}, nil
 }
 
+// defaultMarkSetBloomSize is the default size of the Bloom filter of the
+// on-disk GC mark set
+const defaultMarkSetBloomSize = "64MB"
+
+// gcOptions returns the garbage collection options set in the config
+func gcOptions(r repo.Repo) ([]gc.Option, error) {
+	markSet, err := repo.ConfigString(r, node.GCMarkSetConfigKey, "memory")
+	if err != nil {
+		return nil, err
+	}
+
+	switch markSet {
+	case "memory":
+		return nil, nil
+	case "disk":
+		s, err := repo.ConfigString(r, node.GCMarkSetBloomSizeConfigKey, defaultMarkSetBloomSize)
+		if err != nil {
+			return nil, err
+		}
+		bloomSize, err := humanize.ParseBytes(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", node.GCMarkSetBloomSizeConfigKey, err)
+		}
+		return []gc.Option{gc.WithMarkSet(func() (gc.MarkSet, error) {
+			return gc.NewDiskMarkSet(r.Datastore(), bloomSize)
+		})}, nil
+	default:
+		return nil, fmt.Errorf("unknown %s %q", node.GCMarkSetConfigKey, markSet)
+	}
+}
+
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
 		return err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	opts, err := gcOptions(n.Repo)
+	if err != nil {
+		return err
+	}
+	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, opts...)
 
 	return CollectResult(ctx, rmed, nil)
 }
@@ -97,6 +153,16 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 // given callback for each object removed.  It also collects all errors into a
 // MultiError which is returned after the gc is completed.
 func CollectResult(ctx context.Context, gcOut <-chan gc.Result, cb func(cid.Cid)) error {
+	var cbWithSize func(cid.Cid, int)
+	if cb != nil {
+		cbWithSize = func(k cid.Cid, _ int) { cb(k) }
+	}
+	return CollectResultWithSize(ctx, gcOut, cbWithSize)
+}
+
+// CollectResultWithSize is like CollectResult, but also passes the size of
+// each removed object to the callback. The size is -1 when unknown.
+func CollectResultWithSize(ctx context.Context, gcOut <-chan gc.Result, cb func(cid.Cid, int)) error {
 	var errors []error
 loop:
 	for {
@@ -108,7 +174,7 @@ loop:
 			if res.Error != nil {
 				errors = append(errors, res.Error)
 			} else if res.KeyRemoved.Defined() && cb != nil {
-				cb(res.KeyRemoved)
+				cb(res.KeyRemoved, res.Size)
 			}
 		case <-ctx.Done():
 			errors = append(errors, ctx.Err())
@@ -147,16 +213,61 @@ func (e *MultiError) Error() string {
 	return buf.String()
 }
 
-func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+// EvictLRU removes the least recently used unpinned blocks until toFree
+// bytes are freed. LRU eviction must be enabled for block accesses to be
+// recorded.
+func EvictLRU(n *core.IpfsNode, ctx context.Context, toFree uint64) error {
+	tbs, ok := n.Blockstore.(*gc.TrackingBlockstore)
+	if !ok || tbs.AccessLog() == nil {
+		return fmt.Errorf("LRU eviction is not enabled, set %s to \"lru\"", node.GCEvictionConfigKey)
+	}
+	if err := tbs.AccessLog().Flush(); err != nil {
+		return err
+	}
+
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
-		out := make(chan gc.Result)
-		out <- gc.Result{Error: err}
-		close(out)
-		return out
+		return err
+	}
+	opts, err := gcOptions(n.Repo)
+	if err != nil {
+		return err
 	}
+	rmed := gc.Evict(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, tbs.AccessLog(), toFree, opts...)
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	return CollectResult(ctx, rmed, nil)
+}
+
+func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err == nil {
+		var opts []gc.Option
+		if opts, err = gcOptions(n.Repo); err == nil {
+			return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, opts...)
+		}
+	}
+
+	out := make(chan gc.Result, 1)
+	out <- gc.Result{Error: err}
+	close(out)
+	return out
+}
+
+// GarbageCollectDryRun reports the blocks a garbage collection would
+// remove, without removing them.
+func GarbageCollectDryRun(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err == nil {
+		var opts []gc.Option
+		if opts, err = gcOptions(n.Repo); err == nil {
+			return gc.DryRun(ctx, n.Blockstore, n.Pinning, roots, opts...)
+		}
+	}
+
+	out := make(chan gc.Result, 1)
+	out <- gc.Result{Error: err}
+	close(out)
+	return out
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -215,6 +326,18 @@ func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 			log.Warningf("pre-GC: %s", ErrMaxStorageExceeded)
 		}
 
+		if gc.EvictLRU {
+			toFree := storage + offset - gc.StorageTarget
+			log.Infof("Watermark exceeded. Evicting %s of least recently used blocks...", humanize.Bytes(toFree))
+			defer log.EventBegin(ctx, "repoEvict").Done()
+
+			if err := EvictLRU(gc.Node, ctx, toFree); err != nil {
+				return err
+			}
+			log.Infof("Repo eviction done. See `ipfs repo stat` to see how much space got freed.\n")
+			return nil
+		}
+
 		// Do GC here
 		log.Info("Watermark exceeded. Starting repo GC...")
 		defer log.EventBegin(ctx, "repoGC").Done()
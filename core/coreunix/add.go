@@ -76,6 +76,10 @@ type Adder struct {
 	tempRoot   cid.Cid
 	CidBuilder cid.Builder
 	liveNodes  uint64
+
+	// PinNamespaces, when set, records the pin of the root as held by the
+	// default namespace, see pin.Namespaces.RecordPin
+	PinNamespaces *pin.Namespaces
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -176,6 +180,11 @@ func (adder *Adder) PinRoot(root ipld.Node) error {
 	}
 
 	adder.pinning.PinWithMode(rnk, pin.Recursive)
+	if adder.PinNamespaces != nil {
+		if err := adder.PinNamespaces.RecordPin(rnk, pin.Recursive); err != nil {
+			return err
+		}
+	}
 	return adder.pinning.Flush()
 }
 
@@ -3,9 +3,14 @@ package node
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/pin"
+	"github.com/ipfs/go-ipfs/pin/dspinner"
+	"github.com/ipfs/go-ipfs/pin/gc"
+	"github.com/ipfs/go-ipfs/pin/jobs"
+	"github.com/ipfs/go-ipfs/provider"
 	"github.com/ipfs/go-ipfs/repo"
 
 	"github.com/ipfs/go-bitswap"
@@ -20,6 +25,7 @@ import (
 	"github.com/ipfs/go-merkledag"
 	"github.com/ipfs/go-mfs"
 	"github.com/ipfs/go-unixfs"
+	"github.com/jbenet/goprocess"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
@@ -39,20 +45,182 @@ func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interf
 }
 
 // Pinning creates new pinner which tells GC which blocks should be kept
-func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo) (pin.Pinner, error) {
+func Pinning(bstore blockstore.Blockstore, ds format.DAGService, r repo.Repo) (pin.Pinner, error) {
 	internalDag := merkledag.NewDAGService(blockservice.New(bstore, offline.Exchange(bstore)))
-	pinning, err := pin.LoadPinner(repo.Datastore(), ds, internalDag)
+
+	useDsPinner, err := dspinner.Initialized(r.Datastore())
+	if err != nil {
+		return nil, err
+	}
+	if useDsPinner {
+		return dspinner.New(r.Datastore(), ds), nil
+	}
+
+	pinning, err := pin.LoadPinner(r.Datastore(), ds, internalDag)
 	if err != nil {
 		// TODO: we should move towards only running 'NewPinner' explicitly on
 		// node init instead of implicitly here as a result of the pinner keys
 		// not being found in the datastore.
 		// this is kinda sketchy and could cause data loss
-		pinning = pin.NewPinner(repo.Datastore(), ds, internalDag)
+		pinning = pin.NewPinner(r.Datastore(), ds, internalDag)
 	}
 
 	return pinning, nil
 }
 
+// pinExpiryInterval is how often expired pins are looked for
+const pinExpiryInterval = time.Minute
+
+// PinExpirer runs a service removing the pins whose expiry has passed
+func PinExpirer(lc lcProcess, pinning pin.Pinner, bs blockstore.GCBlockstore) {
+	lc.Append(func(proc goprocess.Process) {
+		ticker := time.NewTicker(pinExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-proc.Closing():
+				return
+			}
+
+			unlocker := bs.PinLock()
+			removed, err := pin.RemoveExpired(pinning, time.Now())
+			unlocker.Unlock()
+			if err != nil {
+				log.Errorf("failed to remove expired pins: %s", err)
+				continue
+			}
+			for _, c := range removed {
+				log.Infof("pin of %s expired", c)
+			}
+		}
+	})
+}
+
+// GCEvictionConfigKey selects how the repo is cleaned up once it crosses
+// Datastore.StorageGCWatermark. With "lru", the least recently used unpinned
+// blocks are evicted until the usage drops to GCEvictionTargetConfigKey,
+// instead of removing all the unpinned blocks.
+const GCEvictionConfigKey = "Datastore.GCEviction"
+
+// GCEvictionTargetConfigKey is the usage LRU eviction stops at, in percent
+// of Datastore.StorageMax
+const GCEvictionTargetConfigKey = "Datastore.GCEvictionTarget"
+
+// GCMarkSetConfigKey selects where GC keeps the set of live blocks while
+// collecting: "memory" (the default), or "disk" for repos whose live blocks
+// do not fit in memory
+const GCMarkSetConfigKey = "Datastore.GCMarkSet"
+
+// GCMarkSetBloomSizeConfigKey is the size of the Bloom filter of the "disk"
+// GC mark set, e.g. "64MB"
+const GCMarkSetBloomSizeConfigKey = "Datastore.GCMarkSetBloomSize"
+
+// accessLogFlushInterval is how often block access times are stored
+const accessLogFlushInterval = time.Minute
+
+// AccessLogger records when blocks are accessed, if LRU eviction is enabled
+func AccessLogger(lc lcProcess, r repo.Repo, bs blockstore.GCBlockstore) error {
+	mode, err := repo.ConfigString(r, GCEvictionConfigKey, "")
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case "":
+		return nil
+	case "lru":
+	default:
+		return fmt.Errorf("unknown %s mode %q", GCEvictionConfigKey, mode)
+	}
+
+	tbs, ok := bs.(*gc.TrackingBlockstore)
+	if !ok {
+		return fmt.Errorf("LRU eviction is not supported by this blockstore")
+	}
+	alog := gc.NewAccessLog(r.Datastore())
+	tbs.SetAccessLog(alog)
+
+	lc.Append(func(proc goprocess.Process) {
+		ticker := time.NewTicker(accessLogFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-proc.Closing():
+				if err := alog.Flush(); err != nil {
+					log.Errorf("failed to store block access times: %s", err)
+				}
+				return
+			}
+
+			if err := alog.Flush(); err != nil {
+				log.Errorf("failed to store block access times: %s", err)
+			}
+		}
+	})
+	return nil
+}
+
+// pinJobWorkers is the number of background pin jobs run concurrently
+const pinJobWorkers = 4
+
+// PinJobs runs the background pinning service, resuming the jobs left over
+// from the previous run
+func PinJobs(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo, dag format.DAGService, pinning pin.Pinner, bs blockstore.GCBlockstore, prov provider.System) (*jobs.Manager, error) {
+	pinFn := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		// Fetch the content without the pin lock, which would block the
+		// garbage collector and every other pin for as long as it takes.
+		var err error
+		if recursive {
+			err = merkledag.FetchGraph(ctx, c, dag)
+		} else {
+			_, err = dag.Get(ctx, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		// The pin walks the DAG again under the lock, fetching anything
+		// collected in the meantime.
+		defer bs.PinLock().Unlock()
+
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		var expires time.Time
+		if expireIn > 0 {
+			expires = time.Now().Add(expireIn)
+		}
+		nss := pin.NewNamespaces(r.Datastore(), pinning)
+		if err := nss.Pin(ctx, pin.DefaultNamespace, nd, recursive, expires); err != nil {
+			return err
+		}
+		// the expiry was set by the namespaces
+		if _, err := pin.AddInfo(pinning, c, info); err != nil {
+			return err
+		}
+		if err := prov.Provide(c); err != nil {
+			return err
+		}
+		return pinning.Flush()
+	}
+
+	m, err := jobs.NewManager(helpers.LifecycleCtx(mctx, lc), r.Datastore(), pinFn, pinJobWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return m.Close()
+		},
+	})
+	return m, nil
+}
+
 // Dag creates new DAGService
 func Dag(bs blockservice.BlockService) format.DAGService {
 	return merkledag.NewDAGService(bs)
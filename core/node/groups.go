@@ -230,9 +230,10 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		fx.Provide(OnlineExchange(shouldBitswapProvide)),
 		fx.Provide(Namesys(ipnsCacheSize)),
 
-		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
+		fx.Provide(IpnsRepublisher(repubPeriod, recordLifetime)),
 
 		fx.Provide(p2p.New),
+		fx.Provide(PinJobs),
 
 		LibP2P(bcfg, cfg),
 		OnlineProviders(cfg.Experimental.StrategicProviding, cfg.Reprovider.Strategy, cfg.Reprovider.Interval),
@@ -256,6 +257,9 @@ var Core = fx.Options(
 	fx.Provide(resolver.NewBasicResolver),
 	fx.Provide(Pinning),
 	fx.Provide(Files),
+
+	fx.Invoke(PinExpirer),
+	fx.Invoke(AccessLogger),
 )
 
 func Networked(bcfg *BuildCfg, cfg *config.Config) fx.Option {
@@ -3,11 +3,14 @@ package node
 import (
 	"context"
 
+	logging "github.com/ipfs/go-log"
 	"github.com/jbenet/goprocess"
 	"github.com/pkg/errors"
 	"go.uber.org/fx"
 )
 
+var log = logging.Logger("core/node")
+
 type lcProcess struct {
 	fx.In
 
@@ -18,6 +18,35 @@ import (
 
 const DefaultIpnsCacheSize = 128
 
+// DNSResolversConfigKey maps domains, such as "eth", to the DNS resolvers
+// used for the dnslinks under them: DNS-over-HTTPS URLs or DNS server
+// addresses. The domain "." applies to all domains, names without a
+// resolver are looked up with the system resolver.
+const DNSResolversConfigKey = "DNS.Resolvers"
+
+// IpnsPersistentCacheConfigKey enables keeping the resolved names in the
+// datastore, so that they survive restarts
+const IpnsPersistentCacheConfigKey = "Ipns.PersistentCache"
+
+// IpnsServeStaleConfigKey controls whether the persistent cache serves
+// expired names, as long as their records are valid, while resolving them
+// again in the background. It is enabled by default.
+const IpnsServeStaleConfigKey = "Ipns.ServeStale"
+
+// IpnsKeyPoliciesConfigKey maps key names to how their records are
+// republished, overriding Ipns.RepublishPeriod and Ipns.RecordLifetime:
+//
+//	{"mykey": {"Interval": "1h", "Lifetime": "48h"}, "other": {"Disabled": true}}
+//
+// The node's own key is named "self".
+const IpnsKeyPoliciesConfigKey = "Ipns.KeyPolicies"
+
+type ipnsKeyPolicy struct {
+	Interval string
+	Lifetime string
+	Disabled bool
+}
+
 // RecordValidator provides namesys compatible routing record validator
 func RecordValidator(ps peerstore.Peerstore) record.Validator {
 	return record.NamespacedValidator{
@@ -27,20 +56,56 @@ func RecordValidator(ps peerstore.Peerstore) record.Validator {
 }
 
 // Namesys creates new name system
-func Namesys(cacheSize int) func(rt routing.Routing, repo repo.Repo) (namesys.NameSystem, error) {
-	return func(rt routing.Routing, repo repo.Repo) (namesys.NameSystem, error) {
-		return namesys.NewNameSystem(rt, repo.Datastore(), cacheSize), nil
+func Namesys(cacheSize int) func(rt routing.Routing, r repo.Repo) (namesys.NameSystem, error) {
+	return func(rt routing.Routing, r repo.Repo) (namesys.NameSystem, error) {
+		dns, err := DNSResolver(r)
+		if err != nil {
+			return nil, err
+		}
+		opts := []namesys.Option{namesys.WithDNSResolver(dns)}
+
+		persist, err := repo.ConfigBool(r, IpnsPersistentCacheConfigKey, false)
+		if err != nil {
+			return nil, err
+		}
+		if persist {
+			serveStale, err := repo.ConfigBool(r, IpnsServeStaleConfigKey, true)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, namesys.WithPersistentCache(r.Datastore(), serveStale))
+		}
+
+		return namesys.NewNameSystem(rt, r.Datastore(), cacheSize, opts...), nil
+	}
+}
+
+// DNSResolver creates the dnslink resolver set up in DNS.Resolvers
+func DNSResolver(r repo.Repo) (*namesys.DNSResolver, error) {
+	resolvers, err := repo.ConfigStringMap(r, DNSResolversConfigKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []namesys.DNSOption
+	for domain, addr := range resolvers {
+		res, err := namesys.NewTXTResolver(addr)
+		if err != nil {
+			return nil, fmt.Errorf("config setting %s.%s: %s", DNSResolversConfigKey, domain, err)
+		}
+		opts = append(opts, namesys.WithTXTResolver(domain, res))
 	}
+	return namesys.NewDNSResolver(opts...), nil
 }
 
 // IpnsRepublisher runs new IPNS republisher service
-func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) error {
-	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) error {
+func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) (*republisher.Republisher, error) {
+	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) (*republisher.Republisher, error) {
 		repub := republisher.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore())
 
 		if repubPeriod != 0 {
-			if !util.Debug && (repubPeriod < time.Minute || repubPeriod > (time.Hour*24)) {
-				return fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
+			if err := checkRepublishPeriod("IPNS.RepublishPeriod", repubPeriod); err != nil {
+				return nil, err
 			}
 
 			repub.Interval = repubPeriod
@@ -50,7 +115,78 @@ func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) fu
 			repub.RecordLifetime = recordLifetime
 		}
 
+		policies, err := ipnsKeyPolicies(repo, repub.Interval, repub.RecordLifetime)
+		if err != nil {
+			return nil, err
+		}
+		repub.Policies = policies
+
 		lc.Append(repub.Run)
-		return nil
+		return repub, nil
+	}
+}
+
+func checkRepublishPeriod(setting string, period time.Duration) error {
+	if !util.Debug && (period < time.Minute || period > (time.Hour*24)) {
+		return fmt.Errorf("config setting %s is not between 1min and 1day: %s", setting, period)
+	}
+	return nil
+}
+
+// ipnsKeyPolicies reads the republishing policies set in Ipns.KeyPolicies.
+// The interval and lifetime are the defaults of the policies leaving them
+// unset.
+func ipnsKeyPolicies(r repo.Repo, interval, lifetime time.Duration) (map[string]republisher.Policy, error) {
+	var cfg map[string]ipnsKeyPolicy
+	if err := repo.ConfigUnmarshal(r, IpnsKeyPoliciesConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]republisher.Policy, len(cfg))
+	for name, c := range cfg {
+		setting := IpnsKeyPoliciesConfigKey + "." + name
+		p := republisher.Policy{Disabled: c.Disabled}
+		if c.Interval != "" {
+			d, err := time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("failure to parse config setting %s.Interval: %s", setting, err)
+			}
+			if err := checkRepublishPeriod(setting+".Interval", d); err != nil {
+				return nil, err
+			}
+			p.Interval = d
+		}
+		if c.Lifetime != "" {
+			d, err := time.ParseDuration(c.Lifetime)
+			if err != nil {
+				return nil, fmt.Errorf("failure to parse config setting %s.Lifetime: %s", setting, err)
+			}
+			p.Lifetime = d
+		}
+
+		if !p.Disabled {
+			i, l := interval, lifetime
+			if p.Interval != 0 {
+				i = p.Interval
+			}
+			if p.Lifetime != 0 {
+				l = p.Lifetime
+			}
+			if l <= i {
+				return nil, fmt.Errorf("config setting %s: the record lifetime %s must be longer than the republish interval %s", setting, l, i)
+			}
+		}
+
+		if name != republisher.SelfKeyName {
+			has, err := r.Keystore().Has(name)
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				log.Warningf("config setting %s names a key which is not in the keystore", setting)
+			}
+		}
+		policies[name] = p
 	}
+	return policies, nil
 }
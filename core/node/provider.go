@@ -6,10 +6,17 @@ import (
 	"time"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/pin"
 	"github.com/ipfs/go-ipfs/provider"
 	q "github.com/ipfs/go-ipfs/provider/queue"
 	"github.com/ipfs/go-ipfs/provider/simple"
 	"github.com/ipfs/go-ipfs/repo"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
 )
@@ -23,15 +30,69 @@ func ProviderQueue(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*q
 	return q.NewQueue(helpers.LifecycleCtx(mctx, lc), "provider-v1", repo.Datastore())
 }
 
+// ProviderWorkersConfigKey is the number of concurrent announce workers
+const ProviderWorkersConfigKey = "Provider.Workers"
+
+// ProviderRateLimitConfigKey is the maximum number of CIDs announced per
+// second, 0 for no limit
+const ProviderRateLimitConfigKey = "Provider.RateLimit"
+
+// ProviderBatchSizeConfigKey is the number of queued CIDs announce workers
+// take at once
+const ProviderBatchSizeConfigKey = "Provider.BatchSize"
+
+// ProvideTracker creates the datastore backed record of when keys were provided
+func ProvideTracker(repo repo.Repo) *simple.Tracker {
+	return simple.NewTracker(repo.Datastore())
+}
+
 // SimpleProvider creates new record provider
-func SimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing) provider.Provider {
-	return simple.NewProvider(helpers.LifecycleCtx(mctx, lc), queue, rt)
+func SimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing, r repo.Repo, tracker *simple.Tracker) (provider.Provider, error) {
+	p, err := newSimpleProvider(mctx, lc, queue, rt, r, tracker)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func newSimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing, r repo.Repo, tracker *simple.Tracker, opts ...simple.Option) (*simple.Provider, error) {
+	workers, err := repo.ConfigInt(r, ProviderWorkersConfigKey, simple.DefaultWorkers)
+	if err != nil {
+		return nil, err
+	}
+	rateLimit, err := repo.ConfigInt(r, ProviderRateLimitConfigKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := repo.ConfigInt(r, ProviderBatchSizeConfigKey, simple.DefaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]simple.Option{
+		simple.Workers(workers),
+		simple.RateLimit(rateLimit),
+		simple.BatchSize(batchSize),
+		simple.WithTracker(tracker),
+	}, opts...)
+	return simple.NewProvider(helpers.LifecycleCtx(mctx, lc), queue, rt, opts...), nil
+}
+
+// StrategicProvider creates a record provider announcing only the roots and
+// directory entries of the provided content. The directories are walked by
+// the announce workers.
+func StrategicProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing, r repo.Repo, tracker *simple.Tracker, bs blockstore.Blockstore) (provider.Provider, error) {
+	p, err := newSimpleProvider(mctx, lc, queue, rt, r, tracker, simple.Expand(simple.DirectoryEntries(offlineDag(bs))))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 // SimpleReprovider creates new reprovider
 func SimpleReprovider(reproviderInterval time.Duration) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc) (provider.Reprovider, error) {
-		return simple.NewReprovider(helpers.LifecycleCtx(mctx, lc), reproviderInterval, rt, keyProvider), nil
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc, tracker *simple.Tracker) (provider.Reprovider, error) {
+		return simple.NewReprovider(helpers.LifecycleCtx(mctx, lc), reproviderInterval, rt, keyProvider, tracker), nil
 	}
 }
 
@@ -61,7 +122,10 @@ func SimpleProviderSys(isOnline bool) interface{} {
 // OnlineProviders groups units managing provider routing records online
 func OnlineProviders(useStrategicProviding bool, reprovideStrategy string, reprovideInterval string) fx.Option {
 	if useStrategicProviding {
-		return fx.Provide(provider.NewOfflineProvider)
+		return fx.Options(
+			StrategicProviders(reprovideInterval),
+			fx.Provide(SimpleProviderSys(true)),
+		)
 	}
 
 	return fx.Options(
@@ -73,7 +137,10 @@ func OnlineProviders(useStrategicProviding bool, reprovideStrategy string, repro
 // OfflineProviders groups units managing provider routing records offline
 func OfflineProviders(useStrategicProviding bool, reprovideStrategy string, reprovideInterval string) fx.Option {
 	if useStrategicProviding {
-		return fx.Provide(provider.NewOfflineProvider)
+		return fx.Options(
+			StrategicProviders(reprovideInterval),
+			fx.Provide(SimpleProviderSys(false)),
+		)
 	}
 
 	return fx.Options(
@@ -84,14 +151,9 @@ func OfflineProviders(useStrategicProviding bool, reprovideStrategy string, repr
 
 // SimpleProviders creates the simple provider/reprovider dependencies
 func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Option {
-	reproviderInterval := kReprovideFrequency
-	if reprovideInterval != "" {
-		dur, err := time.ParseDuration(reprovideInterval)
-		if err != nil {
-			return fx.Error(err)
-		}
-
-		reproviderInterval = dur
+	reproviderInterval, err := parseReprovideInterval(reprovideInterval)
+	if err != nil {
+		return fx.Error(err)
 	}
 
 	var keyProvider fx.Option
@@ -99,7 +161,7 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 	case "all":
 		fallthrough
 	case "":
-		keyProvider = fx.Provide(simple.NewBlockstoreProvider)
+		keyProvider = fx.Provide(pinnedFirstProvider)
 	case "roots":
 		keyProvider = fx.Provide(simple.NewPinnedProvider(true))
 	case "pinned":
@@ -110,8 +172,54 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 
 	return fx.Options(
 		fx.Provide(ProviderQueue),
+		fx.Provide(ProvideTracker),
 		fx.Provide(SimpleProvider),
 		keyProvider,
 		fx.Provide(SimpleReprovider(reproviderInterval)),
 	)
 }
+
+// pinnedFirstProvider supplies all the blocks, the pinned roots first
+func pinnedFirstProvider(bstore blockstore.Blockstore, pinning pin.Pinner, dag format.DAGService) simple.KeyChanFunc {
+	return simple.NewPrioritizedProvider(
+		simple.NewPinnedProvider(true)(pinning, dag),
+		simple.NewBlockstoreProvider(bstore),
+	)
+}
+
+// StrategicProviders creates the provider/reprovider dependencies announcing
+// only the roots and directory entries of added and pinned content. The
+// reprovide strategy is ignored.
+func StrategicProviders(reprovideInterval string) fx.Option {
+	reproviderInterval, err := parseReprovideInterval(reprovideInterval)
+	if err != nil {
+		return fx.Error(err)
+	}
+
+	return fx.Options(
+		fx.Provide(ProviderQueue),
+		fx.Provide(ProvideTracker),
+		fx.Provide(StrategicProvider),
+		fx.Provide(strategicKeyProvider),
+		fx.Provide(SimpleReprovider(reproviderInterval)),
+	)
+}
+
+// strategicKeyProvider supplies the pinned roots, then the directory entries
+// under recursive pins
+func strategicKeyProvider(bstore blockstore.Blockstore, pinning pin.Pinner) simple.KeyChanFunc {
+	return simple.NewStrategicKeyProvider(pinning, offlineDag(bstore))
+}
+
+func parseReprovideInterval(reprovideInterval string) (time.Duration, error) {
+	if reprovideInterval == "" {
+		return kReprovideFrequency, nil
+	}
+	return time.ParseDuration(reprovideInterval)
+}
+
+// offlineDag is a DAG service which never fetches from the network, to walk
+// local content only
+func offlineDag(bstore blockstore.Blockstore) format.DAGService {
+	return merkledag.NewDAGService(blockservice.New(bstore, offline.Exchange(bstore)))
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/filestore"
+	"github.com/ipfs/go-ipfs/pin/gc"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/thirdparty/cidv0v1"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
@@ -73,22 +74,22 @@ func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead
 
 // GcBlockstoreCtor wraps the base blockstore with GC and Filestore layers
 func GcBlockstoreCtor(bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore) {
-	gclocker = blockstore.NewGCLocker()
-	gcbs = blockstore.NewGCBlockstore(bb, gclocker)
+	tbs := gc.NewTrackingBlockstore(blockstore.NewGCBlockstore(bb, blockstore.NewGCLocker()))
 
+	// the tracking blockstore lets GC run without blocking writes
+	gclocker, gcbs = tbs, tbs
 	bs = gcbs
 	return
 }
 
 // GcBlockstoreCtor wraps GcBlockstore and adds Filestore support
 func FilestoreBlockstoreCtor(repo repo.Repo, bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore, fstore *filestore.Filestore) {
-	gclocker = blockstore.NewGCLocker()
-
 	// hash security
 	fstore = filestore.NewFilestore(bb, repo.FileManager())
-	gcbs = blockstore.NewGCBlockstore(fstore, gclocker)
-	gcbs = &verifbs.VerifBSGC{GCBlockstore: gcbs}
+	gcbs = blockstore.NewGCBlockstore(fstore, blockstore.NewGCLocker())
+	tbs := gc.NewTrackingBlockstore(&verifbs.VerifBSGC{GCBlockstore: gcbs})
 
+	gclocker, gcbs = tbs, tbs
 	bs = gcbs
 	return
 }
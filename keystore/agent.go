@@ -0,0 +1,265 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+)
+
+// The agent protocol: an AgentKeystore connects to the Unix socket of the
+// agent for each request, writes the request as JSON and reads the JSON
+// response.
+const (
+	agentOpList   = "list"
+	agentOpPublic = "public"
+	agentOpSign   = "sign"
+)
+
+// agentTimeout bounds the requests to a keystore agent
+const agentTimeout = 30 * time.Second
+
+// maxAgentRequestSize bounds the requests read by the agent
+const maxAgentRequestSize = 1 << 20
+
+// ErrAgentKeystore is returned when adding or removing the keys of an
+// AgentKeystore, which are managed by the agent
+var ErrAgentKeystore = errors.New("the keys are managed by the keystore agent")
+
+// errAgentKey is returned when reading the private keys of an AgentKeystore
+var errAgentKey = errors.New("the private keys of the keystore agent cannot be read")
+
+type agentRequest struct {
+	Op   string
+	Name string `json:",omitempty"`
+	Data []byte `json:",omitempty"`
+}
+
+type agentResponse struct {
+	Names     []string `json:",omitempty"`
+	PublicKey []byte   `json:",omitempty"`
+	Signature []byte   `json:",omitempty"`
+	NoSuchKey bool     `json:",omitempty"`
+	Error     string   `json:",omitempty"`
+}
+
+// AgentKeystore is a keystore whose private keys are held by an external
+// agent, listening on a Unix socket, which signs with them on request. The
+// keys returned by Get only hold the public key, their Sign method asks the
+// agent for the signature.
+type AgentKeystore struct {
+	socket string
+}
+
+var _ Keystore = (*AgentKeystore)(nil)
+
+// NewAgentKeystore returns a keystore using the agent listening on socket
+func NewAgentKeystore(socket string) *AgentKeystore {
+	return &AgentKeystore{socket: socket}
+}
+
+func (ks *AgentKeystore) call(req *agentRequest) (*agentResponse, error) {
+	conn, err := net.DialTimeout("unix", ks.socket, agentTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the keystore agent: %s", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(agentTimeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var res agentResponse
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid keystore agent response: %s", err)
+	}
+	if res.NoSuchKey {
+		return nil, ErrNoSuchKey
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("keystore agent: %s", res.Error)
+	}
+	return &res, nil
+}
+
+// Has returns whether or not a key exist in the Keystore
+func (ks *AgentKeystore) Has(name string) (bool, error) {
+	_, err := ks.Get(name)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrNoSuchKey:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Put returns ErrAgentKeystore, keys are added to the agent instead
+func (ks *AgentKeystore) Put(name string, k ci.PrivKey) error {
+	return ErrAgentKeystore
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns ErrNoSuchKey
+// otherwise.
+func (ks *AgentKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	res, err := ks.call(&agentRequest{Op: agentOpPublic, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ci.UnmarshalPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key from the keystore agent: %s", err)
+	}
+	return &agentKey{ks: ks, name: name, pub: pub}, nil
+}
+
+// Delete returns ErrAgentKeystore, keys are removed from the agent instead
+func (ks *AgentKeystore) Delete(name string) error {
+	return ErrAgentKeystore
+}
+
+// List return a list of key identifier
+func (ks *AgentKeystore) List() ([]string, error) {
+	res, err := ks.call(&agentRequest{Op: agentOpList})
+	if err != nil {
+		return nil, err
+	}
+	return res.Names, nil
+}
+
+// agentKey is a private key held by a keystore agent
+type agentKey struct {
+	ks   *AgentKeystore
+	name string
+	pub  ci.PubKey
+}
+
+var _ ci.PrivKey = (*agentKey)(nil)
+
+// Sign asks the agent to sign data, and checks the signature
+func (k *agentKey) Sign(data []byte) ([]byte, error) {
+	res, err := k.ks.call(&agentRequest{Op: agentOpSign, Name: k.name, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := k.pub.Verify(data, res.Signature); err != nil || !ok {
+		return nil, fmt.Errorf("the keystore agent returned an invalid signature for key %s", k.name)
+	}
+	return res.Signature, nil
+}
+
+func (k *agentKey) GetPublic() ci.PubKey {
+	return k.pub
+}
+
+func (k *agentKey) Bytes() ([]byte, error) {
+	return nil, errAgentKey
+}
+
+func (k *agentKey) Raw() ([]byte, error) {
+	return nil, errAgentKey
+}
+
+func (k *agentKey) Type() pb.KeyType {
+	return k.pub.Type()
+}
+
+// Equals compares the public keys, the private keys cannot be read
+func (k *agentKey) Equals(o ci.Key) bool {
+	sk, ok := o.(ci.PrivKey)
+	if !ok {
+		return false
+	}
+	return k.pub.Equals(sk.GetPublic())
+}
+
+// Agent serves the keys of a keystore to AgentKeystores: it lists them, and
+// signs with them without ever sending them. It is the reference agent, meant
+// to run where the keys are safe, and listen on a Unix socket only the node
+// can reach.
+type Agent struct {
+	ks Keystore
+}
+
+// NewAgent creates an agent serving the keys of ks
+func NewAgent(ks Keystore) *Agent {
+	return &Agent{ks: ks}
+}
+
+// Serve answers the requests of the connections accepted on l, until l is
+// closed
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go a.handle(conn)
+	}
+}
+
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(agentTimeout)); err != nil {
+		return
+	}
+
+	var req agentRequest
+	if err := json.NewDecoder(io.LimitReader(conn, maxAgentRequestSize)).Decode(&req); err != nil {
+		log.Debugf("invalid keystore agent request: %s", err)
+		return
+	}
+	res := a.answer(&req)
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		log.Debugf("failed to answer a keystore agent request: %s", err)
+	}
+}
+
+func (a *Agent) answer(req *agentRequest) *agentResponse {
+	if req.Op == agentOpList {
+		names, err := a.ks.List()
+		if err != nil {
+			return &agentResponse{Error: err.Error()}
+		}
+		return &agentResponse{Names: names}
+	}
+
+	sk, err := a.ks.Get(req.Name)
+	switch err {
+	case nil:
+	case ErrNoSuchKey:
+		return &agentResponse{NoSuchKey: true}
+	default:
+		return &agentResponse{Error: err.Error()}
+	}
+
+	switch req.Op {
+	case agentOpPublic:
+		pub, err := sk.GetPublic().Bytes()
+		if err != nil {
+			return &agentResponse{Error: err.Error()}
+		}
+		return &agentResponse{PublicKey: pub}
+	case agentOpSign:
+		log.Infof("keystore agent: signing %d bytes with key %s", len(req.Data), req.Name)
+		sig, err := sk.Sign(req.Data)
+		if err != nil {
+			return &agentResponse{Error: err.Error()}
+		}
+		return &agentResponse{Signature: sig}
+	default:
+		return &agentResponse{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+}
@@ -0,0 +1,77 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ipns "github.com/ipfs/go-ipns"
+)
+
+func TestAgentKeystore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-agent-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	held := NewMemKeystore()
+	foo := privKeyOrFatal(t)
+	if err := held.Put("foo", foo); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(tdir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewAgent(held).Serve(l)
+
+	ks := NewAgentKeystore(socket)
+
+	l2, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l2) != 1 || l2[0] != "foo" {
+		t.Fatalf("unexpected keys: %v", l2)
+	}
+	if has, err := ks.Has("bar"); err != nil || has {
+		t.Fatalf("expected bar not to exist: %v", err)
+	}
+	if _, err := ks.Get("bar"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+
+	sk, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk.Equals(foo) || !sk.GetPublic().Equals(foo.GetPublic()) {
+		t.Fatal("expected the key of the agent")
+	}
+	if _, err := sk.Bytes(); err == nil {
+		t.Fatal("expected the private key not to be readable")
+	}
+
+	// IPNS records are signed by the agent
+	entry, err := ipns.Create(sk, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipns.Validate(foo.GetPublic(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Put("bar", foo); err != ErrAgentKeystore {
+		t.Fatalf("expected ErrAgentKeystore, got %v", err)
+	}
+	if err := ks.Delete("foo"); err != ErrAgentKeystore {
+		t.Fatalf("expected ErrAgentKeystore, got %v", err)
+	}
+}
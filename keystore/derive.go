@@ -0,0 +1,130 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	bip39 "github.com/tyler-smith/go-bip39"
+	ed25519 "golang.org/x/crypto/ed25519"
+	terminal "golang.org/x/crypto/ssh/terminal"
+)
+
+// IdentityDerivationPath is the derivation path of the peer identity in a
+// mnemonic seed phrase. The IPNS keys are derived along m/1'/<n>' by
+// convention, so that a node can be recreated from the phrase alone.
+const IdentityDerivationPath = "m/0'"
+
+// MnemonicEnv is the environment variable a mnemonic seed phrase can be given
+// in
+const MnemonicEnv = "IPFS_MNEMONIC"
+
+// mnemonicEntropyBits is the entropy of the generated phrases, 24 words
+const mnemonicEntropyBits = 256
+
+// hardenedOffset is added to the indexes of hardened derivations, the only
+// ones defined for ed25519 keys by SLIP-0010
+const hardenedOffset = 1 << 31
+
+// ed25519Curve is the key of the HMAC deriving the master key, in SLIP-0010
+var ed25519Curve = []byte("ed25519 seed")
+
+// NewMnemonic generates a new BIP-39 mnemonic seed phrase of 24 words
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// DeriveKey derives the ed25519 key at the given path, such as m/1'/0', from
+// a BIP-39 mnemonic seed phrase, as specified by SLIP-0010. The same phrase
+// and path always give the same key.
+func DeriveKey(mnemonic, derivationPath string) (ci.PrivKey, error) {
+	indexes, err := parseDerivationPath(derivationPath)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(strings.Join(strings.Fields(mnemonic), " "), "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic seed phrase: %s", err)
+	}
+
+	key, _ := deriveEd25519Seed(seed, indexes)
+	return ci.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(key))
+}
+
+// parseDerivationPath parses a path of hardened indexes, such as m/1'/0'
+func parseDerivationPath(derivationPath string) ([]uint32, error) {
+	components := strings.Split(derivationPath, "/")
+	if components[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q, it must begin with m/", derivationPath)
+	}
+
+	indexes := make([]uint32, 0, len(components)-1)
+	for _, c := range components[1:] {
+		if !strings.HasSuffix(c, "'") {
+			return nil, fmt.Errorf("invalid derivation path %q, ed25519 keys only have hardened derivations such as %s'", derivationPath, c)
+		}
+		i, err := strconv.ParseUint(strings.TrimSuffix(c, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q: %s", derivationPath, err)
+		}
+		indexes = append(indexes, uint32(i)+hardenedOffset)
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("invalid derivation path %q, the master key cannot be used", derivationPath)
+	}
+	return indexes, nil
+}
+
+// deriveEd25519Seed returns the private key and chain code derived from seed
+// along the hardened indexes
+func deriveEd25519Seed(seed []byte, indexes []uint32) (key, chainCode []byte) {
+	mac := hmac.New(sha512.New, ed25519Curve)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode = sum[:32], sum[32:]
+
+	for _, i := range indexes {
+		data := make([]byte, 1+32+4)
+		copy(data[1:], key)
+		binary.BigEndian.PutUint32(data[33:], i)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		key, chainCode = sum[:32], sum[32:]
+	}
+	return key, chainCode
+}
+
+// ReadMnemonic gets a mnemonic seed phrase from MnemonicEnv when it is set,
+// else from a prompt on the terminal
+func ReadMnemonic() (string, error) {
+	if mnemonic := os.Getenv(MnemonicEnv); mnemonic != "" {
+		return mnemonic, nil
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(stdin) {
+		return "", fmt.Errorf("the mnemonic seed phrase must be given in %s", MnemonicEnv)
+	}
+	fmt.Fprint(os.Stderr, "Enter the mnemonic seed phrase: ")
+	mnemonic, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(strings.TrimSpace(string(mnemonic))) == 0 {
+		return "", errors.New("the mnemonic seed phrase cannot be empty")
+	}
+	return string(mnemonic), nil
+}
@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveEd25519Seed(t *testing.T) {
+	// test vector 1 of SLIP-0010 for ed25519
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	for _, tc := range []struct {
+		path      string
+		key       string
+		chainCode string
+	}{
+		{"m/0'", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3", "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69"},
+		{"m/0'/1'", "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2", "a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14"},
+	} {
+		indexes, err := parseDerivationPath(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, chainCode := deriveEd25519Seed(seed, indexes)
+		if hex.EncodeToString(key) != tc.key || hex.EncodeToString(chainCode) != tc.chainCode {
+			t.Fatalf("%s: got key %x and chain code %x", tc.path, key, chainCode)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := DeriveKey(mnemonic, IdentityDerivationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := DeriveKey(" "+mnemonic+"\n", IdentityDerivationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Equals(again) {
+		t.Fatal("the same phrase and path should give the same key")
+	}
+
+	ipnsKey, err := DeriveKey(mnemonic, "m/1'/0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Equals(ipnsKey) {
+		t.Fatal("different paths should give different keys")
+	}
+
+	if _, err := DeriveKey(mnemonic+" abandon", IdentityDerivationPath); err == nil {
+		t.Fatal("expected an invalid phrase to be rejected")
+	}
+	for _, path := range []string{"", "m", "0'", "m/1", "m/1'/x'", "m/2147483648'"} {
+		if _, err := DeriveKey(mnemonic, path); err == nil {
+			t.Fatalf("expected the derivation path %q to be rejected", path)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	pbkdf2 "golang.org/x/crypto/pbkdf2"
+)
+
+// encryptionFile holds the parameters of an encrypted keystore. Key names
+// cannot begin with a period, so it never clashes with a key.
+const encryptionFile = ".encryption"
+
+// checkValue is sealed in encryptionFile to check passphrases
+var checkValue = []byte("ipfs keystore")
+
+// ErrLocked is returned by encrypted keystores until they are unlocked
+var ErrLocked = errors.New("the keystore is encrypted, unlock it with its passphrase")
+
+// Lockable is a keystore which needs a passphrase to read and write keys
+type Lockable interface {
+	Keystore
+
+	// Locked returns whether the keystore still needs to be unlocked
+	Locked() bool
+
+	// Unlock checks the passphrase and uses it for the next operations. It
+	// returns ErrBadPassphrase if the passphrase is wrong.
+	Unlock(passphrase []byte) error
+}
+
+type encryptionParams struct {
+	Cipher     string
+	KDF        string
+	Iterations int
+	Salt       []byte
+	Check      []byte
+}
+
+// EncryptedFSKeystore is a keystore backed by files in a given directory, in
+// which the keys are sealed with AES-256-GCM under a key derived from a
+// passphrase. Key names are not encrypted.
+type EncryptedFSKeystore struct {
+	FSKeystore
+
+	params encryptionParams
+
+	lk   sync.RWMutex
+	aead cipher.AEAD
+}
+
+var _ Lockable = (*EncryptedFSKeystore)(nil)
+
+// IsEncryptedFSKeystore returns whether the keystore in dir is encrypted
+func IsEncryptedFSKeystore(dir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, encryptionFile))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// NewEncryptedFSKeystore opens the encrypted keystore in dir, locked
+func NewEncryptedFSKeystore(dir string) (*EncryptedFSKeystore, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, encryptionFile))
+	if err != nil {
+		return nil, err
+	}
+	var params encryptionParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("invalid keystore encryption parameters: %s", err)
+	}
+	if params.Cipher != "aes-256-gcm" || params.KDF != "pbkdf2-sha256" ||
+		params.Iterations <= 0 || params.Iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported keystore encryption %s with %s", params.Cipher, params.KDF)
+	}
+
+	return &EncryptedFSKeystore{
+		FSKeystore: FSKeystore{dir},
+		params:     params,
+	}, nil
+}
+
+func newKeystoreAEAD(passphrase []byte, params encryptionParams) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, params.Salt, params.Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealKey(aead cipher.AEAD, data, name []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, name), nil
+}
+
+func openSealed(aead cipher.AEAD, data, name []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	out, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], name)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return out, nil
+}
+
+// Locked implements Lockable.
+func (ks *EncryptedFSKeystore) Locked() bool {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+	return ks.aead == nil
+}
+
+// Unlock implements Lockable.
+func (ks *EncryptedFSKeystore) Unlock(passphrase []byte) error {
+	aead, err := newKeystoreAEAD(passphrase, ks.params)
+	if err != nil {
+		return err
+	}
+	if _, err := openSealed(aead, ks.params.Check, []byte(encryptionFile)); err != nil {
+		return err
+	}
+
+	ks.lk.Lock()
+	defer ks.lk.Unlock()
+	ks.aead = aead
+	return nil
+}
+
+func (ks *EncryptedFSKeystore) getAEAD() (cipher.AEAD, error) {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+	if ks.aead == nil {
+		return nil, ErrLocked
+	}
+	return ks.aead, nil
+}
+
+// Put stores a key in the Keystore, if a key with the same name already exists, returns ErrKeyExists
+func (ks *EncryptedFSKeystore) Put(name string, k ci.PrivKey) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	aead, err := ks.getAEAD()
+	if err != nil {
+		return err
+	}
+
+	b, err := k.Bytes()
+	if err != nil {
+		return err
+	}
+	sealed, err := sealKey(aead, b, []byte(name))
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.OpenFile(filepath.Join(ks.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrKeyExists
+		}
+		return err
+	}
+	defer fi.Close()
+
+	_, err = fi.Write(sealed)
+	return err
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns ErrNoSuchKey
+// otherwise.
+func (ks *EncryptedFSKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	aead, err := ks.getAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(ks.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+
+	b, err := openSealed(aead, data, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key %s: %s", name, err)
+	}
+	return ci.UnmarshalPrivateKey(b)
+}
+
+// EncryptFSKeystore encrypts the keys of the plain keystore in dir with the
+// passphrase, to be opened with NewEncryptedFSKeystore. The encrypted keys
+// are written to a new directory which then replaces dir, so that a failure
+// leaves the keystore as it was.
+func EncryptFSKeystore(dir string, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return errors.New("the passphrase cannot be empty")
+	}
+	encrypted, err := IsEncryptedFSKeystore(dir)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return errors.New("the keystore is already encrypted")
+	}
+
+	plain, err := NewFSKeystore(dir)
+	if err != nil {
+		return err
+	}
+	names, err := plain.List()
+	if err != nil {
+		return err
+	}
+
+	params := encryptionParams{
+		Cipher:     "aes-256-gcm",
+		KDF:        "pbkdf2-sha256",
+		Iterations: pbkdf2Iterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return err
+	}
+	aead, err := newKeystoreAEAD(passphrase, params)
+	if err != nil {
+		return err
+	}
+	if params.Check, err = sealKey(aead, checkValue, []byte(encryptionFile)); err != nil {
+		return err
+	}
+	paramsData, err := json.Marshal(&params)
+	if err != nil {
+		return err
+	}
+
+	tmp := dir + ".encrypting"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, encryptionFile), paramsData, 0600); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	ks := &EncryptedFSKeystore{FSKeystore: FSKeystore{tmp}, params: params, aead: aead}
+	for _, name := range names {
+		k, err := plain.Get(name)
+		if err == nil {
+			err = ks.Put(name, k)
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("failed to encrypt key %s: %s", name, err)
+		}
+	}
+
+	backup := dir + ".plain"
+	if err := os.Rename(dir, backup); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(backup, dir)
+		return err
+	}
+	return os.RemoveAll(backup)
+}
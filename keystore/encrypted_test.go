@@ -0,0 +1,103 @@
+package keystore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestEncryptFSKeystore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+	dir := filepath.Join(tdir, "keystore")
+
+	plain, err := NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo := privKeyOrFatal(t)
+	if err := plain.Put("foo", foo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptFSKeystore(dir, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptFSKeystore(dir, []byte("secret")); err == nil {
+		t.Fatal("expected an encrypted keystore not to be encrypted again")
+	}
+
+	// the key is no longer stored in the clear
+	fooBytes, err := foo.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, fooBytes) {
+		t.Fatal("expected the key to be encrypted")
+	}
+
+	encrypted, err := IsEncryptedFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encrypted {
+		t.Fatal("expected the keystore to be encrypted")
+	}
+	ks, err := NewEncryptedFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ks.Locked() {
+		t.Fatal("expected the keystore to be locked")
+	}
+	if _, err := ks.Get("foo"); err != ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := ks.Unlock([]byte("wrong")); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	if err := ks.Unlock([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertGetKey(ks, "foo", foo); err != nil {
+		t.Fatal(err)
+	}
+	bar := privKeyOrFatal(t)
+	if err := ks.Put("bar", bar); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("bar", bar); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if err := assertGetKey(ks, "bar", bar); err != nil {
+		t.Fatal(err)
+	}
+
+	// a sealed key cannot be passed off as another one
+	if err := os.Rename(filepath.Join(dir, "bar"), filepath.Join(dir, "baz")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("baz"); err == nil {
+		t.Fatal("expected a renamed key file not to be decrypted")
+	}
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	if len(l) != 2 || l[0] != "baz" || l[1] != "foo" {
+		t.Fatalf("unexpected keys: %v", l)
+	}
+}
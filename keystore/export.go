@@ -0,0 +1,310 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	ed25519 "golang.org/x/crypto/ed25519"
+	pbkdf2 "golang.org/x/crypto/pbkdf2"
+)
+
+// Formats of exported keys
+const (
+	// FormatProtobuf is the libp2p protobuf encoding of keys, as stored in
+	// the keystore
+	FormatProtobuf = "libp2p-protobuf"
+	// FormatPEM is a PEM encoded PKCS #8 private key
+	FormatPEM = "pem-pkcs8"
+)
+
+const (
+	pemType          = "PRIVATE KEY"
+	pemEncryptedType = "ENCRYPTED PRIVATE KEY"
+)
+
+// pbkdf2Iterations is the cost of deriving encryption keys from passphrases
+const pbkdf2Iterations = 100000
+
+// maxPBKDF2Iterations bounds the cost of decrypting keys
+const maxPBKDF2Iterations = 10000000
+
+// ErrBadPassphrase is returned when an encrypted key cannot be decrypted
+var ErrBadPassphrase = errors.New("wrong passphrase, or corrupted key")
+
+// ErrPassphraseNeeded is returned when an encrypted key is read without a
+// passphrase
+var ErrPassphraseNeeded = errors.New("the key is encrypted, a passphrase is needed")
+
+var (
+	oidEd25519        = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// MarshalPrivateKey encodes a key in the given format. With a passphrase, the
+// key is encrypted with PBES2, as in PKCS #8 encrypted private keys, using
+// PBKDF2-SHA256 and AES-256-CBC.
+func MarshalPrivateKey(k ci.PrivKey, format string, passphrase []byte) ([]byte, error) {
+	var data []byte
+	var err error
+	switch format {
+	case FormatProtobuf:
+		data, err = k.Bytes()
+	case FormatPEM:
+		data, err = marshalPKCS8(k)
+	default:
+		return nil, fmt.Errorf("unknown key format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) > 0 {
+		if data, err = encryptKey(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	if format == FormatPEM {
+		typ := pemType
+		if len(passphrase) > 0 {
+			typ = pemEncryptedType
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data})
+	}
+	return data, nil
+}
+
+// UnmarshalPrivateKey decodes a key encoded by MarshalPrivateKey, in any
+// format. The passphrase is only used when the key is encrypted.
+func UnmarshalPrivateKey(data []byte, passphrase []byte) (ci.PrivKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		der := block.Bytes
+		switch block.Type {
+		case pemType:
+		case pemEncryptedType:
+			if len(passphrase) == 0 {
+				return nil, ErrPassphraseNeeded
+			}
+			var err error
+			if der, err = decryptKey(der, passphrase); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+		return unmarshalPKCS8(der)
+	}
+
+	if isEncryptedKey(data) {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseNeeded
+		}
+		var err error
+		if data, err = decryptKey(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return ci.UnmarshalPrivateKey(data)
+}
+
+// pkcs8 is a PKCS #8 PrivateKeyInfo
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+func marshalPKCS8(k ci.PrivKey) ([]byte, error) {
+	raw, err := k.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.(type) {
+	case *ci.RsaPrivateKey:
+		sk, err := x509.ParsePKCS1PrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return x509.MarshalPKCS8PrivateKey(sk)
+	case *ci.ECDSAPrivateKey:
+		sk, err := x509.ParseECPrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return x509.MarshalPKCS8PrivateKey(sk)
+	case *ci.Ed25519PrivateKey:
+		// RFC 8410, which crypto/x509 does not support yet
+		seed, err := asn1.Marshal(raw[:ed25519.SeedSize])
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(pkcs8{
+			Algo:       pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PrivateKey: seed,
+		})
+	default:
+		return nil, fmt.Errorf("keys of type %T cannot be encoded as PKCS #8", k)
+	}
+}
+
+func unmarshalPKCS8(der []byte) (ci.PrivKey, error) {
+	var info pkcs8
+	if _, err := asn1.Unmarshal(der, &info); err == nil && info.Algo.Algorithm.Equal(oidEd25519) {
+		var seed []byte
+		if _, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid ed25519 private key")
+		}
+		return ci.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(seed))
+	}
+
+	sk, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch sk := sk.(type) {
+	case *rsa.PrivateKey:
+		return ci.UnmarshalRsaPrivateKey(x509.MarshalPKCS1PrivateKey(sk))
+	case *ecdsa.PrivateKey:
+		raw, err := x509.MarshalECPrivateKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		return ci.UnmarshalECDSAPrivateKey(raw)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", sk)
+	}
+}
+
+// encryptedKey is a PKCS #8 EncryptedPrivateKeyInfo
+type encryptedKey struct {
+	Algo pkix.AlgorithmIdentifier
+	Data []byte
+}
+
+type pbes2Params struct {
+	KDF    pkix.AlgorithmIdentifier
+	Cipher pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier
+}
+
+func encryptKey(data, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, pbkdf2Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	enc := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc, enc)
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pbkdf2Iterations,
+		KeyLength:  32,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KDF:    pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		Cipher: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedKey{
+		Algo: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data: enc,
+	})
+}
+
+func isEncryptedKey(data []byte) bool {
+	var k encryptedKey
+	rest, err := asn1.Unmarshal(data, &k)
+	return err == nil && len(rest) == 0 && k.Algo.Algorithm.Equal(oidPBES2)
+}
+
+func decryptKey(data, passphrase []byte) ([]byte, error) {
+	var k encryptedKey
+	if _, err := asn1.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if !k.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s", k.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(k.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	var kdf pbkdf2Params
+	if !params.KDF.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KDF.Algorithm)
+	}
+	if _, err := asn1.Unmarshal(params.KDF.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	if !kdf.PRF.Algorithm.Equal(oidHMACWithSHA256) || (kdf.KeyLength != 0 && kdf.KeyLength != 32) ||
+		kdf.Iterations <= 0 || kdf.Iterations > maxPBKDF2Iterations {
+		return nil, errors.New("unsupported PBKDF2 parameters")
+	}
+	if !params.Cipher.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("unsupported key cipher %s", params.Cipher.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Cipher.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(k.Data) == 0 || len(k.Data)%aes.BlockSize != 0 {
+		return nil, ErrBadPassphrase
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	dec := make([]byte, len(k.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(dec, k.Data)
+
+	pad := int(dec[len(dec)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(dec[len(dec)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrBadPassphrase
+	}
+	return dec[:len(dec)-pad], nil
+}
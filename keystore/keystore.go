@@ -164,6 +164,9 @@ func (ks *FSKeystore) List() ([]string, error) {
 	list := make([]string, 0, len(dirs))
 
 	for _, name := range dirs {
+		if name == encryptionFile {
+			continue
+		}
 		err := validateName(name)
 		if err == nil {
 			list = append(list, name)
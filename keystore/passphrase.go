@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	terminal "golang.org/x/crypto/ssh/terminal"
+)
+
+// PassphraseEnv is the environment variable the passphrase of an encrypted
+// keystore can be given in
+const PassphraseEnv = "IPFS_KEYSTORE_PASSPHRASE"
+
+// maxPassphraseSize bounds the passphrases read from file descriptors
+const maxPassphraseSize = 4 << 10
+
+// ReadPassphrase gets the passphrase of an encrypted keystore: from the file
+// descriptor fd, up to the first newline, when fd is not negative, else from
+// PassphraseEnv when it is set, else from a prompt on the terminal. With
+// confirm, the prompt asks for the passphrase twice.
+func ReadPassphrase(fd int, confirm bool) ([]byte, error) {
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), "passphrase")
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer f.Close()
+		line, err := bufio.NewReader(io.LimitReader(f, maxPassphraseSize)).ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(stdin) {
+		return nil, fmt.Errorf("the keystore is encrypted, its passphrase must be given in %s or with a file descriptor", PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Enter the keystore passphrase: ")
+	pass, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil || !confirm {
+		return pass, err
+	}
+
+	fmt.Fprint(os.Stderr, "Enter it again: ")
+	again, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, errors.New("the passphrases do not match")
+	}
+	return pass, nil
+}
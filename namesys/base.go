@@ -12,7 +12,9 @@ import (
 type onceResult struct {
 	value path.Path
 	ttl   time.Duration
-	err   error
+	// end of validity of the record, zero when unknown
+	eol time.Time
+	err error
 }
 
 type resolver interface {
@@ -6,14 +6,14 @@ import (
 	path "github.com/ipfs/go-path"
 )
 
-func (ns *mpns) cacheGet(name string) (path.Path, bool) {
+func (ns *mpns) cacheGet(name string) (cacheEntry, bool) {
 	if ns.cache == nil {
-		return "", false
+		return cacheEntry{}, false
 	}
 
 	ientry, ok := ns.cache.Get(name)
 	if !ok {
-		return "", false
+		return cacheEntry{}, false
 	}
 
 	entry, ok := ientry.(cacheEntry)
@@ -22,26 +22,50 @@ func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 		log.Panicf("unexpected type %T in cache for %q.", ientry, name)
 	}
 
-	if time.Now().Before(entry.eol) {
-		return entry.val, true
+	if time.Now().Before(entry.expires) {
+		return entry, true
 	}
 
 	ns.cache.Remove(name)
 
-	return "", false
+	return cacheEntry{}, false
 }
 
-func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
+// cacheSet caches the value of a name for ttl. The EOL of the record the value
+// comes from, if known, bounds how long the persistent cache can serve it;
+// values without one are not persisted.
+func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration, eol time.Time) {
+	if ttl <= 0 {
+		return
+	}
+	expires := time.Now().Add(ttl)
+	if ns.cache != nil {
+		ns.cache.Add(name, cacheEntry{
+			val:     val,
+			expires: expires,
+			eol:     eol,
+		})
+	}
+	if ns.dscache != nil && !eol.IsZero() {
+		ns.dscache.put(name, val, expires, eol)
+	}
+}
+
+// cacheSetError caches the failure to resolve a name, such as a domain
+// without dnslink record
+func (ns *mpns) cacheSetError(name string, err error, ttl time.Duration) {
 	if ns.cache == nil || ttl <= 0 {
 		return
 	}
 	ns.cache.Add(name, cacheEntry{
-		val: val,
-		eol: time.Now().Add(ttl),
+		err:     err,
+		expires: time.Now().Add(ttl),
 	})
 }
 
 type cacheEntry struct {
-	val path.Path
-	eol time.Time
+	val     path.Path
+	err     error
+	expires time.Time
+	eol     time.Time
 }
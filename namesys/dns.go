@@ -5,10 +5,12 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"time"
 
 	path "github.com/ipfs/go-path"
 	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	isd "github.com/jbenet/go-is-domain"
+	dns "github.com/miekg/dns"
 )
 
 type LookupTXTFunc func(name string) (txt []string, err error)
@@ -16,13 +18,50 @@ type LookupTXTFunc func(name string) (txt []string, err error)
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
+	// resolvers used instead of lookupTXT, by domain suffix
+	resolvers map[string]TXTResolver
+}
+
+// DNSOption configures a DNSResolver
+type DNSOption func(*DNSResolver)
+
+// WithTXTResolver uses res to look up the names under the given domain, such
+// as "eth", rather than the system resolver. The domain "." matches all
+// names, the most specific domain is used.
+func WithTXTResolver(domain string, res TXTResolver) DNSOption {
+	return func(r *DNSResolver) {
+		r.resolvers[dns.Fqdn(strings.TrimPrefix(domain, "."))] = res
+	}
 }
 
 // NewDNSResolver constructs a name resolver using DNS TXT records.
-func NewDNSResolver() *DNSResolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
+func NewDNSResolver(options ...DNSOption) *DNSResolver {
+	r := &DNSResolver{
+		lookupTXT: net.LookupTXT,
+		resolvers: make(map[string]TXTResolver),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+// resolverFor returns the TXT resolver for the given fully qualified name
+func (r *DNSResolver) resolverFor(fqdn string) TXTResolver {
+	for domain := fqdn; ; {
+		if res, ok := r.resolvers[domain]; ok {
+			return res
+		}
+		if domain == "." {
+			return r.lookupTXT
+		}
+		i := strings.IndexByte(domain, '.')
+		if i == len(domain)-1 {
+			domain = "."
+		} else {
+			domain = domain[i+1:]
+		}
+	}
 }
 
 // Resolve implements Resolver.
@@ -37,6 +76,7 @@ func (r *DNSResolver) ResolveAsync(ctx context.Context, name string, options ...
 
 type lookupRes struct {
 	path  path.Path
+	ttl   time.Duration
 	error error
 }
 
@@ -63,10 +103,10 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 	}
 
 	rootChan := make(chan lookupRes, 1)
-	go workDomain(r, fqdn, rootChan)
+	go workDomain(ctx, r, fqdn, rootChan)
 
 	subChan := make(chan lookupRes, 1)
-	go workDomain(r, "_dnslink."+fqdn, subChan)
+	go workDomain(ctx, r, "_dnslink."+fqdn, subChan)
 
 	appendPath := func(p path.Path) (path.Path, error) {
 		if len(segments) > 1 {
@@ -77,6 +117,9 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 
 	go func() {
 		defer close(out)
+		// lookups which failed for lack of a dnslink record, cached
+		// when both did
+		var missing []lookupRes
 		for {
 			select {
 			case subRes, ok := <-subChan:
@@ -86,9 +129,10 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 				}
 				if subRes.error == nil {
 					p, err := appendPath(subRes.path)
-					emitOnceResult(ctx, out, onceResult{value: p, err: err})
+					emitOnceResult(ctx, out, onceResult{value: p, ttl: subRes.ttl, err: err})
 					return
 				}
+				missing = append(missing, subRes)
 			case rootRes, ok := <-rootChan:
 				if !ok {
 					rootChan = nil
@@ -96,12 +140,17 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 				}
 				if rootRes.error == nil {
 					p, err := appendPath(rootRes.path)
-					emitOnceResult(ctx, out, onceResult{value: p, err: err})
+					emitOnceResult(ctx, out, onceResult{value: p, ttl: rootRes.ttl, err: err})
+				} else {
+					missing = append(missing, rootRes)
 				}
 			case <-ctx.Done():
 				return
 			}
 			if subChan == nil && rootChan == nil {
+				if ttl, ok := negativeTTL(missing); ok {
+					emitOnceResult(ctx, out, onceResult{err: ErrResolveFailed, ttl: ttl})
+				}
 				return
 			}
 		}
@@ -110,24 +159,42 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 	return out
 }
 
-func workDomain(r *DNSResolver, name string, res chan lookupRes) {
+// negativeTTL returns how long the failure of both dnslink lookups can be
+// cached for, if they both failed because there was no record
+func negativeTTL(missing []lookupRes) (time.Duration, bool) {
+	if len(missing) != 2 {
+		return 0, false
+	}
+	var ttl time.Duration
+	for i, res := range missing {
+		if res.ttl <= 0 || (res.error != ErrNoTXTRecord && res.error != ErrResolveFailed) {
+			return 0, false
+		}
+		if i == 0 || res.ttl < ttl {
+			ttl = res.ttl
+		}
+	}
+	return ttl, true
+}
+
+func workDomain(ctx context.Context, r *DNSResolver, name string, res chan lookupRes) {
 	defer close(res)
 
-	txt, err := r.lookupTXT(name)
+	txt, ttl, err := r.resolverFor(name).LookupTXT(ctx, name)
 	if err != nil {
 		// Error is != nil
-		res <- lookupRes{"", err}
+		res <- lookupRes{"", ttl, err}
 		return
 	}
 
 	for _, t := range txt {
 		p, err := parseEntry(t)
 		if err == nil {
-			res <- lookupRes{p, nil}
+			res <- lookupRes{p, ttl, nil}
 			return
 		}
 	}
-	res <- lookupRes{"", ErrResolveFailed}
+	res <- lookupRes{"", ttl, ErrResolveFailed}
 }
 
 func parseEntry(txt string) (path.Path, error) {
@@ -0,0 +1,216 @@
+package namesys
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// ErrNoTXTRecord is returned by TXT resolvers when a name has no TXT record
+var ErrNoTXTRecord = errors.New("no TXT record found")
+
+// MaxNegativeCacheTTL bounds how long the absence of a TXT record is cached
+const MaxNegativeCacheTTL = 5 * time.Minute
+
+// dohMaxResponseSize bounds the size of the DNS messages read from
+// DNS-over-HTTPS servers, DNS messages are never larger than 64KiB.
+const dohMaxResponseSize = 64 << 10
+
+// TXTResolver looks up the TXT records of DNS names.
+type TXTResolver interface {
+	// LookupTXT returns the TXT records of name and how long they can be
+	// cached for, zero when unknown. When name has no TXT record, it returns
+	// ErrNoTXTRecord and how long that can be cached for.
+	LookupTXT(ctx context.Context, name string) (txt []string, ttl time.Duration, err error)
+}
+
+// LookupTXT implements TXTResolver. The TTL of the records is unknown, so
+// they are cached for DefaultResolverCacheTTL, and their absence for as long
+// but at most MaxNegativeCacheTTL.
+func (f LookupTXTFunc) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, err := f(name)
+	if err != nil {
+		if isNoSuchHost(err) {
+			return nil, systemNegativeTTL, ErrNoTXTRecord
+		}
+		return nil, 0, err
+	}
+	return txt, DefaultResolverCacheTTL, nil
+}
+
+// systemNegativeTTL is how long the absence of a TXT record reported by the
+// system resolver is cached for
+var systemNegativeTTL = minDuration(DefaultResolverCacheTTL, MaxNegativeCacheTTL)
+
+// isNoSuchHost returns whether err is the error of the system resolver for a
+// name without records
+func isNoSuchHost(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && !dnsErr.Timeout() && !dnsErr.Temporary() && dnsErr.Err == "no such host"
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// NewTXTResolver returns a TXT resolver querying the given server: a
+// DNS-over-HTTPS endpoint when addr is an https:// URL, a plain DNS server
+// otherwise, given as an IP address or host name with an optional port.
+func NewTXTResolver(addr string) (TXTResolver, error) {
+	if strings.HasPrefix(addr, "https://") {
+		return NewDoHResolver(addr), nil
+	}
+	if strings.Contains(addr, "://") {
+		return nil, fmt.Errorf("unsupported DNS resolver %q: only https:// URLs and DNS servers are supported", addr)
+	}
+	return NewDNSServerResolver(addr)
+}
+
+// DNSServerResolver queries a DNS server over UDP, retrying over TCP when the
+// answer is truncated.
+type DNSServerResolver struct {
+	addr   string
+	client *dns.Client
+}
+
+// NewDNSServerResolver returns a resolver querying the DNS server at addr,
+// on port 53 when no port is given.
+func NewDNSServerResolver(addr string) (*DNSServerResolver, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if strings.Contains(addr, ":") && net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid DNS server address %q", addr)
+		}
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &DNSServerResolver{
+		addr:   addr,
+		client: new(dns.Client),
+	}, nil
+}
+
+// LookupTXT implements TXTResolver.
+func (r *DNSServerResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	in, _, err := r.client.ExchangeContext(ctx, txtQuery(name), r.addr)
+	if err == nil && in.Truncated {
+		tcp := &dns.Client{Net: "tcp"}
+		in, _, err = tcp.ExchangeContext(ctx, txtQuery(name), r.addr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return txtAnswers(in)
+}
+
+// DoHResolver queries a DNS-over-HTTPS server, as specified in RFC 8484.
+type DoHResolver struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHResolver returns a resolver querying the DNS-over-HTTPS endpoint at
+// url, such as https://cloudflare-dns.com/dns-query.
+func NewDoHResolver(url string) *DoHResolver {
+	return &DoHResolver{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// LookupTXT implements TXTResolver.
+func (r *DoHResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	q := txtQuery(name)
+	// the RFC recommends an ID of 0, which makes answers easier to cache
+	q.Id = 0
+	msg, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS-over-HTTPS query to %s failed: %s", r.url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, dohMaxResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	in := new(dns.Msg)
+	if err := in.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("invalid answer from %s: %s", r.url, err)
+	}
+	return txtAnswers(in)
+}
+
+func txtQuery(name string) *dns.Msg {
+	q := new(dns.Msg)
+	q.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	return q
+}
+
+// txtAnswers returns the TXT records in a DNS answer and the smallest of
+// their TTLs. When there is none, the TTL is the negative caching TTL given
+// by the SOA record of the answer, as specified in RFC 2308.
+func txtAnswers(in *dns.Msg) ([]string, time.Duration, error) {
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return nil, 0, fmt.Errorf("DNS query failed: %s", dns.RcodeToString[in.Rcode])
+	}
+
+	var txt []string
+	var ttl uint32
+	for _, rr := range in.Answer {
+		t, ok := rr.(*dns.TXT)
+		if !ok {
+			// CNAMEs leading to the records
+			continue
+		}
+		if len(txt) == 0 || t.Hdr.Ttl < ttl {
+			ttl = t.Hdr.Ttl
+		}
+		txt = append(txt, strings.Join(t.Txt, ""))
+	}
+	if len(txt) > 0 {
+		return txt, time.Duration(ttl) * time.Second, nil
+	}
+
+	for _, rr := range in.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		ttl := soa.Minttl
+		if soa.Hdr.Ttl < ttl {
+			ttl = soa.Hdr.Ttl
+		}
+		negative := time.Duration(ttl) * time.Second
+		if negative > MaxNegativeCacheTTL {
+			negative = MaxNegativeCacheTTL
+		}
+		return nil, negative, ErrNoTXTRecord
+	}
+	return nil, 0, ErrNoTXTRecord
+}
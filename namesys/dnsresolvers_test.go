@@ -0,0 +1,174 @@
+package namesys
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	dns "github.com/miekg/dns"
+)
+
+type countingTXTResolver struct {
+	lk      sync.Mutex
+	entries map[string][]string
+	lookups int
+}
+
+func (r *countingTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.lookups++
+	txt, ok := r.entries[name]
+	if !ok {
+		return nil, time.Minute, ErrNoTXTRecord
+	}
+	return txt, time.Minute, nil
+}
+
+func (r *countingTXTResolver) count() int {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.lookups
+}
+
+func TestDNSResolverPerDomain(t *testing.T) {
+	eth := &countingTXTResolver{entries: map[string][]string{
+		"app.eth.":          {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		"_dnslink.app.eth.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+	}}
+	other := &countingTXTResolver{entries: map[string][]string{
+		"example.com.":          {"dnslink=/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr"},
+		"_dnslink.example.com.": {"dnslink=/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr"},
+	}}
+	r := NewDNSResolver(WithTXTResolver("eth", eth), WithTXTResolver(".", other))
+
+	testResolution(t, r, "app.eth", 1, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "example.com", 1, "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr", nil)
+	if eth.count() != 2 || other.count() != 2 {
+		t.Fatalf("expected each resolver to do 2 lookups, got %d and %d", eth.count(), other.count())
+	}
+}
+
+func TestSystemResolverTTL(t *testing.T) {
+	ctx := context.Background()
+	lookup := LookupTXTFunc(func(name string) ([]string, error) {
+		switch name {
+		case "example.com.":
+			return []string{"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"}, nil
+		case "missing.com.":
+			return nil, &net.DNSError{Err: "no such host", Name: name}
+		default:
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+	})
+
+	if _, ttl, err := lookup.LookupTXT(ctx, "example.com."); err != nil || ttl != DefaultResolverCacheTTL {
+		t.Fatalf("expected the default TTL, got %s (%v)", ttl, err)
+	}
+	if _, ttl, err := lookup.LookupTXT(ctx, "missing.com."); err != ErrNoTXTRecord || ttl <= 0 || ttl > MaxNegativeCacheTTL {
+		t.Fatalf("expected a bounded negative TTL, got %s (%v)", ttl, err)
+	}
+	if _, ttl, err := lookup.LookupTXT(ctx, "timeout.com."); err == nil || err == ErrNoTXTRecord || ttl != 0 {
+		t.Fatalf("expected a timeout not to be cached, got %s (%v)", ttl, err)
+	}
+}
+
+func TestDNSLinkCache(t *testing.T) {
+	// both records exist, so that both lookups complete before resolution
+	txt := &countingTXTResolver{entries: map[string][]string{
+		"example.com.":          {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		"_dnslink.example.com.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+	}}
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	ns := NewNameSystem(offroute.NewOfflineRouter(dstore, mockrouting.MockValidator{}), dstore, 16,
+		WithDNSResolver(NewDNSResolver(WithTXTResolver(".", txt))))
+
+	for i := 0; i < 2; i++ {
+		testResolution(t, ns, "/ipns/example.com", 1, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	}
+	if txt.count() != 2 {
+		t.Fatalf("expected the dnslink to be cached, got %d lookups", txt.count())
+	}
+
+	for i := 0; i < 2; i++ {
+		testResolution(t, ns, "/ipns/missing.example.com", 1, "", ErrResolveFailed)
+	}
+	if txt.count() != 4 {
+		t.Fatalf("expected the missing dnslink to be cached, got %d lookups", txt.count())
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		q := new(dns.Msg)
+		if err := q.Unpack(body); err != nil {
+			t.Error(err)
+			return
+		}
+
+		a := new(dns.Msg)
+		a.SetReply(q)
+		if q.Question[0].Name == "example.com." {
+			a.Answer = append(a.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+				Txt: []string{"dnslink=/ipfs/", "QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+			})
+		} else {
+			a.Rcode = dns.RcodeNameError
+			a.Ns = append(a.Ns, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: "com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 900},
+				Ns:     "ns.com.",
+				Mbox:   "hostmaster.com.",
+				Minttl: 60,
+			})
+		}
+		out, err := a.Pack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}))
+	defer s.Close()
+
+	r := NewDoHResolver(s.URL)
+	ctx := context.Background()
+
+	txt, ttl, err := r.LookupTXT(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 1 || txt[0] != "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD" {
+		t.Fatalf("unexpected TXT records: %v", txt)
+	}
+	if ttl != 300*time.Second {
+		t.Fatalf("expected a TTL of 300s, got %s", ttl)
+	}
+
+	_, ttl, err = r.LookupTXT(ctx, "missing.com")
+	if err != ErrNoTXTRecord {
+		t.Fatalf("expected ErrNoTXTRecord, got %v", err)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("expected a negative TTL of 1m, got %s", ttl)
+	}
+}
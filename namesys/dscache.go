@@ -0,0 +1,331 @@
+package namesys
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	path "github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	base32 "github.com/whyrusleeping/base32"
+)
+
+const ipnsCachePrefix = "/ipns-cache/"
+
+// cachePruneInterval is how often the persistent cache is cleared of the
+// entries which cannot be served anymore
+const cachePruneInterval = time.Hour
+
+// revalidateTimeout bounds the background resolution of stale cache entries
+const revalidateTimeout = time.Minute
+
+// CacheEntry is a name cached by the name system
+type CacheEntry struct {
+	Name  string
+	Value path.Path
+	// Expires is when the entry has to be resolved again
+	Expires time.Time
+	// EOL is when the record the entry was resolved from stops being
+	// valid, zero when unknown. Until then, an expired entry can be served
+	// while it is resolved again.
+	EOL time.Time
+	// Persisted tells whether the entry is kept across restarts
+	Persisted bool
+}
+
+// CachingNameSystem is a name system whose cache can be listed and cleared
+type CachingNameSystem interface {
+	NameSystem
+
+	// CachedNames returns the names in the cache
+	CachedNames(ctx context.Context) ([]CacheEntry, error)
+
+	// ClearCache removes all the names from the cache
+	ClearCache() error
+}
+
+// WithPersistentCache keeps the resolved names in the given datastore as well,
+// so that they are not lost on restart. With serveStale, expired entries are
+// served, as long as their records are valid, while they are resolved again
+// in the background. Only names resolved from records with a known EOL, such
+// as IPNS records, are kept: the others, such as DNS results, cannot be served
+// once expired.
+func WithPersistentCache(d ds.Datastore, serveStale bool) Option {
+	return func(ns *mpns) {
+		ns.dscache = newPersistentCache(d, serveStale)
+		ns.revalidating = make(map[string]struct{})
+	}
+}
+
+// persistentCache stores cache entries in a datastore. The entries which
+// cannot be served anymore are removed when read, and pruned every
+// cachePruneInterval when entries are added.
+type persistentCache struct {
+	ds         ds.Datastore
+	serveStale bool
+
+	pruneLk   sync.Mutex
+	lastPrune time.Time
+}
+
+func newPersistentCache(d ds.Datastore, serveStale bool) *persistentCache {
+	return &persistentCache{ds: d, serveStale: serveStale}
+}
+
+type persistedEntry struct {
+	Value   string
+	Expires time.Time
+	EOL     time.Time
+}
+
+func persistentCacheKey(name string) ds.Key {
+	return ds.NewKey(ipnsCachePrefix + base32.RawStdEncoding.EncodeToString([]byte(name)))
+}
+
+// servable returns whether the entry can still be served at the given time
+func (c *persistentCache) servable(e CacheEntry, now time.Time) bool {
+	return now.Before(e.Expires) || (c.serveStale && now.Before(e.EOL))
+}
+
+func (c *persistentCache) get(name string) (CacheEntry, bool) {
+	data, err := c.ds.Get(persistentCacheKey(name))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Errorf("failed to read the cache entry of %s: %s", name, err)
+		}
+		return CacheEntry{}, false
+	}
+	var e persistedEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Errorf("invalid cache entry for %s: %s", name, err)
+		return CacheEntry{}, false
+	}
+	return CacheEntry{
+		Name:      name,
+		Value:     path.Path(e.Value),
+		Expires:   e.Expires,
+		EOL:       e.EOL,
+		Persisted: true,
+	}, true
+}
+
+func (c *persistentCache) put(name string, val path.Path, expires, eol time.Time) {
+	data, err := json.Marshal(&persistedEntry{
+		Value:   val.String(),
+		Expires: expires,
+		EOL:     eol,
+	})
+	if err == nil {
+		err = c.ds.Put(persistentCacheKey(name), data)
+	}
+	if err != nil {
+		log.Errorf("failed to store the cache entry of %s: %s", name, err)
+	}
+
+	now := time.Now()
+	c.pruneLk.Lock()
+	if now.Sub(c.lastPrune) >= cachePruneInterval {
+		c.lastPrune = now
+		go func() {
+			if err := c.prune(now); err != nil {
+				log.Errorf("failed to prune the ipns cache: %s", err)
+			}
+		}()
+	}
+	c.pruneLk.Unlock()
+}
+
+// prune removes the entries which cannot be served anymore
+func (c *persistentCache) prune(now time.Time) error {
+	res, err := c.ds.Query(dsquery.Query{Prefix: ipnsCachePrefix})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var e persistedEntry
+		if err := json.Unmarshal(r.Value, &e); err == nil && c.servable(CacheEntry{Expires: e.Expires, EOL: e.EOL}, now) {
+			continue
+		}
+		if err := c.ds.Delete(ds.RawKey(r.Key)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *persistentCache) remove(name string) {
+	if err := c.ds.Delete(persistentCacheKey(name)); err != nil {
+		log.Errorf("failed to remove the cache entry of %s: %s", name, err)
+	}
+}
+
+// list returns the cached entries, including the expired ones
+func (c *persistentCache) list(ctx context.Context) ([]CacheEntry, error) {
+	res, err := c.ds.Query(dsquery.Query{
+		Prefix:   ipnsCachePrefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var entries []CacheEntry
+	for {
+		select {
+		case r, ok := <-res.Next():
+			if !ok {
+				return entries, nil
+			}
+			if r.Error != nil {
+				return nil, r.Error
+			}
+			name, err := base32.RawStdEncoding.DecodeString(ds.RawKey(r.Key).BaseNamespace())
+			if err != nil {
+				log.Errorf("ipns cache key invalid: %s", r.Key)
+				continue
+			}
+			if e, ok := c.get(string(name)); ok {
+				entries = append(entries, e)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *persistentCache) clear() error {
+	res, err := c.ds.Query(dsquery.Query{
+		Prefix:   ipnsCachePrefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		// entries may be pruned meanwhile
+		if err := c.ds.Delete(ds.RawKey(e.Key)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// persistentCacheGet returns the entry of name in the persistent cache, if
+// it can still be served. Entries which cannot are removed.
+func (ns *mpns) persistentCacheGet(name string) (CacheEntry, bool) {
+	if ns.dscache == nil {
+		return CacheEntry{}, false
+	}
+	e, ok := ns.dscache.get(name)
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	if ns.dscache.servable(e, time.Now()) {
+		return e, true
+	}
+	ns.dscache.remove(name)
+	return CacheEntry{}, false
+}
+
+// revalidate resolves name again in the background and updates its cache
+// entry
+func (ns *mpns) revalidate(name string, options opts.ResolveOpts) {
+	ns.revalidatingLk.Lock()
+	if _, ok := ns.revalidating[name]; ok {
+		ns.revalidatingLk.Unlock()
+		return
+	}
+	ns.revalidating[name] = struct{}{}
+	ns.revalidatingLk.Unlock()
+
+	go func() {
+		defer func() {
+			ns.revalidatingLk.Lock()
+			delete(ns.revalidating, name)
+			ns.revalidatingLk.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+
+		var best onceResult
+		for res := range ns.resolverFor(name).resolveOnceAsync(ctx, name, options) {
+			if res.err == nil {
+				best = res
+			}
+		}
+		if best == (onceResult{}) {
+			log.Debugf("failed to revalidate the cache entry of %s", name)
+			return
+		}
+		ns.cacheSet(name, best.value, best.ttl, best.eol)
+	}()
+}
+
+// CachedNames implements CachingNameSystem.
+func (ns *mpns) CachedNames(ctx context.Context) ([]CacheEntry, error) {
+	byName := make(map[string]CacheEntry)
+	if ns.cache != nil {
+		for _, k := range ns.cache.Keys() {
+			name := k.(string)
+			v, ok := ns.cache.Peek(name)
+			if !ok {
+				continue
+			}
+			e := v.(cacheEntry)
+			if e.err != nil {
+				continue
+			}
+			byName[name] = CacheEntry{
+				Name:    name,
+				Value:   e.val,
+				Expires: e.expires,
+				EOL:     e.eol,
+			}
+		}
+	}
+	if ns.dscache != nil {
+		persisted, err := ns.dscache.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range persisted {
+			byName[e.Name] = e
+		}
+	}
+
+	entries := make([]CacheEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// ClearCache implements CachingNameSystem.
+func (ns *mpns) ClearCache() error {
+	if ns.cache != nil {
+		ns.cache.Purge()
+	}
+	if ns.dscache != nil {
+		return ns.dscache.clear()
+	}
+	return nil
+}
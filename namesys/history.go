@@ -0,0 +1,91 @@
+package namesys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	pb "github.com/ipfs/go-ipns/pb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	base32 "github.com/whyrusleeping/base32"
+)
+
+// IpnsHistorySize is the number of records kept in the publish history of
+// each key. Older records are dropped.
+const IpnsHistorySize = 16
+
+const ipnsHistoryPrefix = "/ipns-history/"
+
+// IpnsHistoryDsKey returns the datastore key under which the history of the
+// records published for id is stored
+func IpnsHistoryDsKey(id peer.ID) ds.Key {
+	return ds.NewKey(ipnsHistoryPrefix + base32.RawStdEncoding.EncodeToString([]byte(id)))
+}
+
+func ipnsHistoryEntryKey(id peer.ID, seq uint64) ds.Key {
+	// fixed width so that the keys sort by sequence number
+	return IpnsHistoryDsKey(id).ChildString(fmt.Sprintf("%016X", seq))
+}
+
+// History returns the records this node published for id, newest first.
+// Republishing a value does not add an entry, only publishing a new value
+// does.
+func (p *IpnsPublisher) History(ctx context.Context, id peer.ID) ([]*pb.IpnsEntry, error) {
+	query, err := p.ds.Query(dsquery.Query{
+		Prefix: IpnsHistoryDsKey(id).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer query.Close()
+
+	var entries []*pb.IpnsEntry
+	for {
+		select {
+		case result, ok := <-query.Next():
+			if !ok {
+				sort.Slice(entries, func(i, j int) bool {
+					return entries[i].GetSequence() > entries[j].GetSequence()
+				})
+				return entries, nil
+			}
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			e := new(pb.IpnsEntry)
+			if err := proto.Unmarshal(result.Value, e); err != nil {
+				log.Error("found an invalid IPNS entry in the history:", err)
+				continue
+			}
+			entries = append(entries, e)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// addToHistory records a published entry in the history of id, replacing the
+// entry with the same sequence number if any, and drops the oldest entries
+// beyond IpnsHistorySize.
+func (p *IpnsPublisher) addToHistory(ctx context.Context, id peer.ID, entry *pb.IpnsEntry, data []byte) error {
+	if err := p.ds.Put(ipnsHistoryEntryKey(id, entry.GetSequence()), data); err != nil {
+		return err
+	}
+
+	entries, err := p.History(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(entries) <= IpnsHistorySize {
+		return nil
+	}
+	for _, e := range entries[IpnsHistorySize:] {
+		if err := p.ds.Delete(ipnsHistoryEntryKey(id, e.GetSequence())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package namesys
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
@@ -30,22 +31,42 @@ type mpns struct {
 	ipnsPublisher                               Publisher
 
 	cache *lru.Cache
+
+	// optional cache kept across restarts
+	dscache        *persistentCache
+	revalidatingLk sync.Mutex
+	revalidating   map[string]struct{}
+}
+
+// Option configures the name system
+type Option func(*mpns)
+
+// WithDNSResolver resolves domain names with the given resolver, rather than
+// one using the system resolver
+func WithDNSResolver(r *DNSResolver) Option {
+	return func(ns *mpns) {
+		ns.dnsResolver = r
+	}
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
+func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int, options ...Option) NameSystem {
 	var cache *lru.Cache
 	if cachesize > 0 {
 		cache, _ = lru.New(cachesize)
 	}
 
-	return &mpns{
+	ns := &mpns{
 		dnsResolver:      NewDNSResolver(),
 		proquintResolver: new(ProquintResolver),
 		ipnsResolver:     NewIpnsResolver(r),
 		ipnsPublisher:    NewIpnsPublisher(r, ds),
 		cache:            cache,
 	}
+	for _, opt := range options {
+		opt(ns)
+	}
+	return ns
 }
 
 const DefaultResolverCacheTTL = time.Minute
@@ -82,6 +103,10 @@ func (ns *mpns) ResolveAsync(ctx context.Context, name string, options ...opts.R
 
 // resolveOnce implements resolver.
 func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.ResolveOpts) <-chan onceResult {
+	if r, ok := registeredResolver(name); ok {
+		return resolveRegistered(ctx, r, name, options)
+	}
+
 	out := make(chan onceResult, 1)
 
 	if !strings.HasPrefix(name, ipnsPrefix) {
@@ -97,7 +122,8 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 
 	key := segments[2]
 
-	if p, ok := ns.cacheGet(key); ok {
+	// attach the rest of the path to a cached value
+	emitCached := func(p path.Path) <-chan onceResult {
 		if len(segments) > 3 {
 			var err error
 			p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[3])
@@ -111,20 +137,27 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 		return out
 	}
 
-	// Resolver selection:
-	// 1. if it is a multihash resolve through "ipns".
-	// 2. if it is a domain name, resolve through "dns"
-	// 3. otherwise resolve through the "proquint" resolver
+	if entry, ok := ns.cacheGet(key); ok {
+		if entry.err != nil {
+			out <- onceResult{err: entry.err}
+			close(out)
+			return out
+		}
+		return emitCached(entry.val)
+	}
 
-	var res resolver
-	if _, err := mh.FromB58String(key); err == nil {
-		res = ns.ipnsResolver
-	} else if isd.IsDomain(key) {
-		res = ns.dnsResolver
-	} else {
-		res = ns.proquintResolver
+	if entry, ok := ns.persistentCacheGet(key); ok {
+		if time.Now().Before(entry.Expires) {
+			if ns.cache != nil {
+				ns.cache.Add(key, cacheEntry{val: entry.Value, expires: entry.Expires, eol: entry.EOL})
+			}
+		} else {
+			ns.revalidate(key, options)
+		}
+		return emitCached(entry.Value)
 	}
 
+	res := ns.resolverFor(key)
 	resCh := res.resolveOnceAsync(ctx, key, options)
 	var best onceResult
 	go func() {
@@ -134,12 +167,16 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 			case res, ok := <-resCh:
 				if !ok {
 					if best != (onceResult{}) {
-						ns.cacheSet(key, best.value, best.ttl)
+						ns.cacheSet(key, best.value, best.ttl, best.eol)
 					}
 					return
 				}
 				if res.err == nil {
 					best = res
+				} else if res.ttl > 0 {
+					// a failure which can be cached, such as a
+					// missing dnslink record
+					ns.cacheSetError(key, res.err, res.ttl)
 				}
 				p := res.value
 
@@ -162,6 +199,19 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 	return out
 }
 
+// resolverFor selects the resolver of a name:
+// 1. if it is a multihash resolve through "ipns".
+// 2. if it is a domain name, resolve through "dns"
+// 3. otherwise resolve through the "proquint" resolver
+func (ns *mpns) resolverFor(key string) resolver {
+	if _, err := mh.FromB58String(key); err == nil {
+		return ns.ipnsResolver
+	} else if isd.IsDomain(key) {
+		return ns.dnsResolver
+	}
+	return ns.proquintResolver
+}
+
 func emitOnceResult(ctx context.Context, outCh chan<- onceResult, r onceResult) {
 	select {
 	case outCh <- r:
@@ -186,6 +236,6 @@ func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.
 	if ttEol := time.Until(eol); ttEol < ttl {
 		ttl = ttEol
 	}
-	ns.cacheSet(peer.IDB58Encode(id), value, ttl)
+	ns.cacheSet(peer.IDB58Encode(id), value, ttl, eol)
 	return nil
 }
@@ -3,10 +3,13 @@ package namesys
 import (
 	"context"
 	"fmt"
+	"sort"
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
 	offroute "github.com/ipfs/go-ipfs-routing/offline"
 	ipns "github.com/ipfs/go-ipns"
 	path "github.com/ipfs/go-path"
@@ -113,3 +116,120 @@ func TestPublishWithCache0(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPersistentCache(t *testing.T) {
+	ctx := context.Background()
+	cacheStore := dssync.MutexWrap(ds.NewMapDatastore())
+	routingStore := dssync.MutexWrap(ds.NewMapDatastore())
+	routing := offroute.NewOfflineRouter(routingStore, mockrouting.MockValidator{})
+
+	priv, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "/ipns/" + pid.Pretty()
+	p1 := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+	p2 := path.FromString("/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr")
+
+	nsys := NewNameSystem(routing, cacheStore, 0, WithPersistentCache(cacheStore, true))
+	if err := nsys.PublishWithEOL(ctx, priv, p1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a name system over an empty routing system still finds the cached name
+	empty := offroute.NewOfflineRouter(dssync.MutexWrap(ds.NewMapDatastore()), mockrouting.MockValidator{})
+	restarted := NewNameSystem(empty, cacheStore, 0, WithPersistentCache(cacheStore, true))
+	testResolution(t, restarted, name, 1, p1.String(), nil)
+
+	// once expired, the cached value is served while the name is resolved
+	// again
+	if err := NewIpnsPublisher(routing, ds.NewMapDatastore()).Publish(ctx, priv, p2); err != nil {
+		t.Fatal(err)
+	}
+	newPersistentCache(cacheStore, true).put(pid.Pretty(), p1, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+
+	restarted = NewNameSystem(routing, cacheStore, 0, WithPersistentCache(cacheStore, true))
+	testResolution(t, restarted, name, 1, p1.String(), nil)
+	for i := 0; ; i++ {
+		entries, err := restarted.(CachingNameSystem).CachedNames(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 1 && entries[0].Value == p2 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the stale entry was not revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testResolution(t, restarted, name, 1, p2.String(), nil)
+
+	// without serving stale entries, expired names are resolved first
+	newPersistentCache(cacheStore, true).put(pid.Pretty(), p1, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	restarted = NewNameSystem(routing, cacheStore, 0, WithPersistentCache(cacheStore, false))
+	testResolution(t, restarted, name, 1, p2.String(), nil)
+
+	if err := restarted.(CachingNameSystem).ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := restarted.(CachingNameSystem).CachedNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected an empty cache, got %d entries", len(entries))
+	}
+}
+
+func TestPersistentCachePrune(t *testing.T) {
+	ctx := context.Background()
+	cacheStore := dssync.MutexWrap(ds.NewMapDatastore())
+	p := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+	now := time.Now()
+
+	c := newPersistentCache(cacheStore, true)
+	c.lastPrune = now
+	c.put("fresh", p, now.Add(time.Minute), now.Add(time.Hour))
+	c.put("stale", p, now.Add(-time.Minute), now.Add(time.Hour))
+	c.put("dead", p, now.Add(-time.Hour), now.Add(-time.Minute))
+
+	names := func() []string {
+		entries, err := c.list(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if err := c.prune(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 2 || got[0] != "fresh" || got[1] != "stale" {
+		t.Fatalf("expected the dead entry to be pruned, got %v", got)
+	}
+
+	c.serveStale = false
+	if err := c.prune(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 1 || got[0] != "fresh" {
+		t.Fatalf("expected the stale entry to be pruned, got %v", got)
+	}
+
+	// names resolved without a known EOL, such as dnslinks, are not persisted
+	nsys := NewNameSystem(nil, cacheStore, 0, WithPersistentCache(cacheStore, true)).(*mpns)
+	nsys.cacheSet("example.com", p, time.Minute, time.Time{})
+	if _, ok := c.get("example.com"); ok {
+		t.Fatal("dnslink should not be persisted")
+	}
+}
@@ -183,6 +183,9 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 	if err := p.ds.Put(IpnsDsKey(id), data); err != nil {
 		return nil, err
 	}
+	if err := p.addToHistory(ctx, id, entry, data); err != nil {
+		log.Errorf("failed to record the IPNS record of %s in its history: %s", id, err)
+	}
 	return entry, nil
 }
 
@@ -3,6 +3,7 @@ package namesys
 import (
 	"context"
 	"crypto/rand"
+	"fmt"
 	"testing"
 	"time"
 
@@ -10,7 +11,9 @@ import (
 	dssync "github.com/ipfs/go-datastore/sync"
 	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
 	ipns "github.com/ipfs/go-ipns"
+	path "github.com/ipfs/go-path"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	testutil "github.com/libp2p/go-libp2p-testing/net"
@@ -110,3 +113,58 @@ func TestRSAPublisher(t *testing.T) {
 func TestEd22519Publisher(t *testing.T) {
 	testNamekeyPublisher(t, ci.Ed25519, ds.ErrNotFound, false)
 }
+
+func TestPublishHistory(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	p := NewIpnsPublisher(offroute.NewOfflineRouter(dstore, mockrouting.MockValidator{}), dstore)
+
+	privKey, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eol := time.Now().Add(time.Hour)
+	publish := func(value string) {
+		if err := p.PublishWithEOL(ctx, privKey, path.Path(value), eol); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < IpnsHistorySize+4; i++ {
+		publish(fmt.Sprintf("/ipfs/value%d", i))
+	}
+	// republishing the current value does not add an entry
+	publish(fmt.Sprintf("/ipfs/value%d", IpnsHistorySize+3))
+
+	entries, err := p.History(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != IpnsHistorySize {
+		t.Fatalf("expected %d entries, got %d", IpnsHistorySize, len(entries))
+	}
+	for i, e := range entries {
+		seq := uint64(IpnsHistorySize + 3 - i)
+		if e.GetSequence() != seq {
+			t.Fatalf("expected entry %d to have sequence %d, got %d", i, seq, e.GetSequence())
+		}
+		if value := fmt.Sprintf("/ipfs/value%d", seq); string(e.GetValue()) != value {
+			t.Fatalf("expected entry %d to have value %s, got %s", i, value, e.GetValue())
+		}
+	}
+
+	// publishing an earlier value again gets a new sequence number
+	publish("/ipfs/value10")
+	entries, err = p.History(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].GetSequence() != IpnsHistorySize+4 || string(entries[0].GetValue()) != "/ipfs/value10" {
+		t.Fatalf("unexpected newest entry: %d %s", entries[0].GetSequence(), entries[0].GetValue())
+	}
+}
@@ -0,0 +1,105 @@
+package namesys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	path "github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+)
+
+var (
+	registryLk sync.RWMutex
+	// resolvers of the names under custom prefixes, such as /ulord/<name>
+	registry = make(map[string]Resolver)
+)
+
+// RegisterResolver makes the name systems resolve the names under
+// /<prefix>/ with r, as ipfs resolve and the gateway do for /ipns/ names. The
+// resolver should resolve them to /ipfs/ or /ipns/ paths.
+func RegisterResolver(prefix string, r Resolver) error {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || strings.Contains(prefix, "/") {
+		return fmt.Errorf("invalid name prefix %q", prefix)
+	}
+	switch prefix {
+	case "ipfs", "ipns", "ipld":
+		return fmt.Errorf("the /%s/ prefix is reserved", prefix)
+	}
+
+	registryLk.Lock()
+	defer registryLk.Unlock()
+	if _, ok := registry[prefix]; ok {
+		return fmt.Errorf("a resolver is already registered for /%s/", prefix)
+	}
+	registry[prefix] = r
+	return nil
+}
+
+// RegisteredPrefixes returns the prefixes with a registered resolver, such as
+// "/ulord"
+func RegisteredPrefixes() []string {
+	registryLk.RLock()
+	defer registryLk.RUnlock()
+	prefixes := make([]string, 0, len(registry))
+	for prefix := range registry {
+		prefixes = append(prefixes, "/"+prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// HasRegisteredResolver returns whether name, such as /ulord/name/a/file, is
+// under a prefix with a registered resolver
+func HasRegisteredResolver(name string) bool {
+	_, ok := registeredResolver(name)
+	return ok
+}
+
+func registeredResolver(name string) (Resolver, bool) {
+	segments := strings.SplitN(name, "/", 3)
+	if len(segments) < 3 || segments[0] != "" {
+		return nil, false
+	}
+	registryLk.RLock()
+	defer registryLk.RUnlock()
+	r, ok := registry[segments[1]]
+	return r, ok
+}
+
+// resolveRegistered resolves one step of a name under a custom prefix with
+// its registered resolver, the resulting /ipns/ paths are then resolved by the
+// name system as usual.
+func resolveRegistered(ctx context.Context, r Resolver, name string, options opts.ResolveOpts) <-chan onceResult {
+	out := make(chan onceResult, 1)
+	segments := strings.SplitN(name, "/", 4)
+	if segments[2] == "" {
+		out <- onceResult{err: ErrResolveFailed}
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		resCh := r.ResolveAsync(ctx, strings.Join(segments[:3], "/"),
+			opts.Depth(1),
+			opts.DhtRecordCount(options.DhtRecordCount),
+			opts.DhtTimeout(options.DhtTimeout),
+		)
+		for res := range resCh {
+			p, err := res.Path, res.Err
+			if err == ErrResolveRecursion {
+				// the name system carries on with the resolution
+				err = nil
+			}
+			if err == nil && len(segments) > 3 {
+				p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[3])
+			}
+			emitOnceResult(ctx, out, onceResult{value: p, err: err})
+		}
+	}()
+	return out
+}
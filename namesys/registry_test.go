@@ -0,0 +1,61 @@
+package namesys
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	path "github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+)
+
+type mapResolver map[string]string
+
+func (m mapResolver) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
+	p, ok := m[name]
+	if !ok {
+		return "", ErrResolveFailed
+	}
+	return path.ParsePath(p)
+}
+
+func (m mapResolver) ResolveAsync(ctx context.Context, name string, options ...opts.ResolveOpt) <-chan Result {
+	out := make(chan Result, 1)
+	p, err := m.Resolve(ctx, name, options...)
+	out <- Result{Path: p, Err: err}
+	close(out)
+	return out
+}
+
+func TestRegisteredResolver(t *testing.T) {
+	r := mapResolver{
+		"/testchain/site": "/ipns/ipfs.example.com",
+		"/testchain/file": "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr",
+	}
+	if err := RegisterResolver("testchain", r); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterResolver("/testchain/", r); err == nil {
+		t.Fatal("expected registering a prefix twice to fail")
+	}
+	if err := RegisterResolver("ipns", r); err == nil {
+		t.Fatal("expected registering /ipns/ to fail")
+	}
+	if !HasRegisteredResolver("/testchain/site/a") || HasRegisteredResolver("/othername/site") {
+		t.Fatal("unexpected registered prefixes")
+	}
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	mock := newMockDNS()
+	ns := NewNameSystem(offroute.NewOfflineRouter(dstore, mockrouting.MockValidator{}), dstore, 0,
+		WithDNSResolver(&DNSResolver{lookupTXT: mock.lookupTXT}))
+
+	testResolution(t, ns, "/testchain/file", opts.DefaultDepthLimit, "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr", nil)
+	testResolution(t, ns, "/testchain/file/a/b", opts.DefaultDepthLimit, "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr/a/b", nil)
+	testResolution(t, ns, "/testchain/site", 1, "/ipns/ipfs.example.com", ErrResolveRecursion)
+	testResolution(t, ns, "/testchain/site", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, ns, "/testchain/missing", opts.DefaultDepthLimit, "", ErrResolveFailed)
+}
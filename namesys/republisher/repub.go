@@ -3,6 +3,8 @@ package republisher
 import (
 	"context"
 	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	keystore "github.com/ipfs/go-ipfs/keystore"
@@ -35,6 +37,52 @@ var FailureRetryInterval = time.Minute * 5
 // DefaultRecordLifetime is the default lifetime for IPNS records
 const DefaultRecordLifetime = time.Hour * 24
 
+// SelfKeyName is the name of the node's own key in Policies and Status
+const SelfKeyName = "self"
+
+// Policy sets how the records of a key are republished
+type Policy struct {
+	// Interval between republishes, Republisher.Interval when zero
+	Interval time.Duration
+
+	// how long republished records are valid for, Republisher.RecordLifetime
+	// when zero
+	Lifetime time.Duration
+
+	// Disabled keys are not republished
+	Disabled bool
+}
+
+// KeyStatus is the republishing state of a key
+type KeyStatus struct {
+	Name     string
+	ID       peer.ID
+	Interval time.Duration
+	Lifetime time.Duration
+	Disabled bool
+
+	// Published tells whether this node has a record to republish for the key
+	Published bool
+
+	// LastRepublish is when the record was last republished, zero if never
+	LastRepublish time.Time
+
+	// LastAttempt is when the record was last due, and LastError why it
+	// failed to be republished then, if it did
+	LastAttempt time.Time
+	LastError   string
+
+	// NextRepublish is when the record is next due
+	NextRepublish time.Time
+}
+
+type keyState struct {
+	lastRepublish time.Time
+	lastAttempt   time.Time
+	lastErr       string
+	next          time.Time
+}
+
 type Republisher struct {
 	ns   namesys.Publisher
 	ds   ds.Datastore
@@ -45,6 +93,14 @@ type Republisher struct {
 
 	// how long records that are republished should be valid for
 	RecordLifetime time.Duration
+
+	// Policies overrides Interval and RecordLifetime for some keys, by key
+	// name. The node's own key is named SelfKeyName.
+	Policies map[string]Policy
+
+	lk      sync.Mutex
+	states  map[string]*keyState
+	nextRun time.Time
 }
 
 // NewRepublisher creates a new Republisher
@@ -56,68 +112,164 @@ func NewRepublisher(ns namesys.Publisher, ds ds.Datastore, self ic.PrivKey, ks k
 		ks:             ks,
 		Interval:       DefaultRebroadcastInterval,
 		RecordLifetime: DefaultRecordLifetime,
+		states:         make(map[string]*keyState),
 	}
 }
 
 func (rp *Republisher) Run(proc goprocess.Process) {
-	timer := time.NewTimer(InitialRebroadcastDelay)
-	defer timer.Stop()
-	if rp.Interval < InitialRebroadcastDelay {
-		timer.Reset(rp.Interval)
+	delay := InitialRebroadcastDelay
+	if rp.Interval < delay {
+		delay = rp.Interval
 	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	rp.setNextRun(time.Now().Add(delay))
 
 	for {
 		select {
 		case <-timer.C:
-			timer.Reset(rp.Interval)
-			err := rp.republishEntries(proc)
-			if err != nil {
-				log.Info("republisher failed to republish: ", err)
-				if FailureRetryInterval < rp.Interval {
-					timer.Reset(FailureRetryInterval)
-				}
-			}
+			next := rp.republishEntries(proc)
+			rp.setNextRun(next)
+			timer.Reset(time.Until(next))
 		case <-proc.Closing():
 			return
 		}
 	}
 }
 
-func (rp *Republisher) republishEntries(p goprocess.Process) error {
+// policy returns the policy of a key, with the defaults filled in
+func (rp *Republisher) policy(name string) Policy {
+	p := rp.Policies[name]
+	if p.Interval == 0 {
+		p.Interval = rp.Interval
+	}
+	if p.Lifetime == 0 {
+		p.Lifetime = rp.RecordLifetime
+	}
+	return p
+}
+
+func (rp *Republisher) setNextRun(t time.Time) {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	rp.nextRun = t
+}
+
+func (rp *Republisher) keyNames() ([]string, error) {
+	names := []string{SelfKeyName}
+	if rp.ks != nil {
+		keyNames, err := rp.ks.List()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, keyNames...)
+	}
+	return names, nil
+}
+
+func (rp *Republisher) getKey(name string) (ic.PrivKey, error) {
+	if name == SelfKeyName {
+		return rp.self, nil
+	}
+	return rp.ks.Get(name)
+}
+
+// republishEntries republishes the records which are due, and returns when
+// it should be called next. A key failing to be republished does not stop
+// the others from being republished.
+func (rp *Republisher) republishEntries(p goprocess.Process) time.Time {
 	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
 	defer cancel()
 
+	now := time.Now()
+	next := now.Add(rp.Interval)
+
 	// TODO: Use rp.ipns.ListPublished(). We can't currently *do* that
 	// because:
 	// 1. There's no way to get keys from the keystore by ID.
 	// 2. We don't actually have access to the IPNS publisher.
-	err := rp.republishEntry(ctx, rp.self)
+	names, err := rp.keyNames()
 	if err != nil {
-		return err
+		log.Errorf("republisher failed to list the keys: %s", err)
+		if retry := now.Add(FailureRetryInterval); retry.Before(next) {
+			next = retry
+		}
+		return next
 	}
 
-	if rp.ks != nil {
-		keyNames, err := rp.ks.List()
-		if err != nil {
-			return err
+	rp.pruneStates(names)
+	for _, name := range names {
+		due, ok := rp.republishKey(ctx, name, now)
+		if ok && due.Before(next) {
+			next = due
 		}
-		for _, name := range keyNames {
-			priv, err := rp.ks.Get(name)
-			if err != nil {
-				return err
-			}
-			err = rp.republishEntry(ctx, priv)
-			if err != nil {
-				return err
-			}
+	}
+	return next
+}
+
+// republishKey republishes the record of a key if it is due, and returns
+// when it is next due. It returns false for disabled keys.
+func (rp *Republisher) republishKey(ctx context.Context, name string, now time.Time) (time.Time, bool) {
+	policy := rp.policy(name)
+	if policy.Disabled {
+		return time.Time{}, false
+	}
+
+	rp.lk.Lock()
+	st, ok := rp.states[name]
+	if !ok {
+		st = new(keyState)
+		rp.states[name] = st
+	}
+	due := st.next
+	rp.lk.Unlock()
+	if now.Before(due) {
+		return due, true
+	}
 
+	priv, err := rp.getKey(name)
+	if err == nil {
+		err = rp.republishEntry(ctx, priv, policy.Lifetime)
+	}
+
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	st.lastAttempt = now
+	st.next = now.Add(policy.Interval)
+	switch err {
+	case nil:
+		st.lastRepublish = now
+		st.lastErr = ""
+	case errNoEntry:
+		// nothing was published with this key
+		st.lastErr = ""
+	default:
+		log.Errorf("republisher failed to republish the record of key %s: %s", name, err)
+		st.lastErr = err.Error()
+		if FailureRetryInterval < policy.Interval {
+			st.next = now.Add(FailureRetryInterval)
 		}
 	}
+	return st.next, true
+}
+
+// pruneStates forgets the keys which were removed
+func (rp *Republisher) pruneStates(names []string) {
+	keep := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		keep[name] = struct{}{}
+	}
 
-	return nil
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+	for name := range rp.states {
+		if _, ok := keep[name]; !ok {
+			delete(rp.states, name)
+		}
+	}
 }
 
-func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) error {
+func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey, lifetime time.Duration) error {
 	id, err := peer.IDFromPrivateKey(priv)
 	if err != nil {
 		return err
@@ -128,17 +280,65 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 	// Look for it locally only
 	p, err := rp.getLastVal(id)
 	if err != nil {
-		if err == errNoEntry {
-			return nil
-		}
 		return err
 	}
 
 	// update record with same sequence number
-	eol := time.Now().Add(rp.RecordLifetime)
+	eol := time.Now().Add(lifetime)
 	return rp.ns.PublishWithEOL(ctx, priv, p, eol)
 }
 
+// Status returns the republishing state of the keys, sorted by name with the
+// node's own key first
+func (rp *Republisher) Status() ([]KeyStatus, error) {
+	names, err := rp.keyNames()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names[1:])
+
+	out := make([]KeyStatus, 0, len(names))
+	for _, name := range names {
+		policy := rp.policy(name)
+		s := KeyStatus{
+			Name:     name,
+			Interval: policy.Interval,
+			Lifetime: policy.Lifetime,
+			Disabled: policy.Disabled,
+		}
+
+		priv, err := rp.getKey(name)
+		if err == nil {
+			s.ID, err = peer.IDFromPrivateKey(priv)
+		}
+		if err == nil {
+			_, err = rp.getLastVal(s.ID)
+			s.Published = err == nil
+		}
+		if err != nil && err != errNoEntry {
+			s.LastError = err.Error()
+		}
+
+		rp.lk.Lock()
+		if st, ok := rp.states[name]; ok && !s.Disabled {
+			s.LastRepublish = st.lastRepublish
+			s.LastAttempt = st.lastAttempt
+			if st.lastErr != "" {
+				s.LastError = st.lastErr
+			}
+			s.NextRepublish = st.next
+		}
+		if !s.Disabled && s.NextRepublish.IsZero() {
+			// not seen by the republisher yet
+			s.NextRepublish = rp.nextRun
+		}
+		rp.lk.Unlock()
+
+		out = append(out, s)
+	}
+	return out, nil
+}
+
 func (rp *Republisher) getLastVal(id peer.ID) (path.Path, error) {
 	// Look for it locally only
 	val, err := rp.ds.Get(namesys.IpnsDsKey(id))
@@ -13,7 +13,9 @@ import (
 	. "github.com/ipfs/go-ipfs/namesys/republisher"
 	path "github.com/ipfs/go-path"
 
+	ipns "github.com/ipfs/go-ipns"
 	goprocess "github.com/jbenet/goprocess"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 )
@@ -112,6 +114,73 @@ func TestRepublish(t *testing.T) {
 	}
 }
 
+func TestRepublishPolicies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nd, err := core.NewNode(ctx, &core.BuildCfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nd.Repo.Keystore().Put("other", other); err != nil {
+		t.Fatal(err)
+	}
+
+	p := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	rp := namesys.NewIpnsPublisher(nd.Routing, nd.Repo.Datastore())
+	for _, k := range []ci.PrivKey{nd.PrivateKey, other} {
+		if err := rp.PublishWithEOL(ctx, k, p, time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repub := NewRepublisher(rp, nd.Repo.Datastore(), nd.PrivateKey, nd.Repo.Keystore())
+	repub.Interval = time.Second
+	repub.Policies = map[string]Policy{
+		SelfKeyName: {Lifetime: time.Hour},
+		"other":     {Disabled: true},
+	}
+
+	proc := goprocess.Go(repub.Run)
+	defer proc.Close()
+	time.Sleep(time.Second * 2)
+
+	status, err := repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[0].Name != SelfKeyName || status[1].Name != "other" {
+		t.Fatalf("unexpected keys: %v", status)
+	}
+
+	self := status[0]
+	if !self.Published || self.LastRepublish.IsZero() || self.LastError != "" {
+		t.Fatalf("expected self to be republished: %+v", self)
+	}
+	if self.Lifetime != time.Hour || !self.NextRepublish.After(self.LastRepublish) {
+		t.Fatalf("unexpected policy for self: %+v", self)
+	}
+	entry, err := rp.GetPublished(ctx, nd.Identity, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eol, err := ipns.GetEOL(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(eol) < time.Minute*30 {
+		t.Fatalf("expected the record to be republished with the key lifetime, valid until %s", eol)
+	}
+
+	if s := status[1]; !s.Disabled || !s.LastAttempt.IsZero() || !s.NextRepublish.IsZero() {
+		t.Fatalf("expected other not to be republished: %+v", s)
+	}
+}
+
 func verifyResolution(nodes []*core.IpfsNode, key string, exp path.Path) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
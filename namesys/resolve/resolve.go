@@ -21,9 +21,10 @@ var log = logging.Logger("nsresolv")
 var ErrNoNamesys = errors.New(
 	"core/resolve: no Namesys on IpfsNode - can't resolve ipns entry")
 
-// ResolveIPNS resolves /ipns paths
+// ResolveIPNS resolves /ipns paths, and the paths under prefixes with a
+// resolver registered with namesys.RegisterResolver
 func ResolveIPNS(ctx context.Context, nsys namesys.NameSystem, p path.Path) (path.Path, error) {
-	if strings.HasPrefix(p.String(), "/ipns/") {
+	if strings.HasPrefix(p.String(), "/ipns/") || namesys.HasRegisteredResolver(p.String()) {
 		evt := log.EventBegin(ctx, "resolveIpnsPath")
 		defer evt.Done()
 		// resolve ipns paths
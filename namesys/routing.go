@@ -133,9 +133,11 @@ func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, option
 				if entry.Ttl != nil {
 					ttl = time.Duration(*entry.Ttl)
 				}
-				switch eol, err := ipns.GetEOL(entry); err {
+				eol, err := ipns.GetEOL(entry)
+				switch err {
 				case ipns.ErrUnrecognizedValidity:
 					// No EOL.
+					eol = time.Time{}
 				case nil:
 					ttEol := time.Until(eol)
 					if ttEol < 0 {
@@ -150,7 +152,7 @@ func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, option
 					return
 				}
 
-				emitOnceResult(ctx, out, onceResult{value: p, ttl: ttl})
+				emitOnceResult(ctx, out, onceResult{value: p, ttl: ttl, eol: eol})
 			case <-ctx.Done():
 				return
 			}
@@ -0,0 +1,109 @@
+package dspinner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-ipfs/pin"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+var (
+	// dagPinRootKey is where the default pinner stores the root of its pin
+	// set DAG, and dagPinInfoPrefix where it stores the pin labels.
+	dagPinRootKey    = ds.NewKey("/local/pins")
+	dagPinInfoPrefix = ds.NewKey("/local/pininfo")
+)
+
+// ConvertFromDAG migrates the pins stored by the default pinner, as a pin set
+// DAG, to one datastore key per pin, and marks the datastore as managed by
+// this pinner. It returns the number of converted pins.
+//
+// The conversion can safely be run again if it was interrupted. Once it
+// completed, the pin set DAG is no longer referenced and its blocks get
+// removed by the next garbage collection.
+func ConvertFromDAG(ctx context.Context, d ds.Datastore, dserv, internal ipld.DAGService) (int, error) {
+	has, err := d.Has(dagPinRootKey)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		// nothing was ever pinned
+		return 0, Init(d)
+	}
+
+	old, err := pin.LoadPinner(d, dserv, internal)
+	if err != nil {
+		return 0, err
+	}
+
+	// write the pins in a batch when the datastore supports it
+	var w ds.Write = d
+	commit := func() error { return nil }
+	if bds, ok := d.(ds.Batching); ok {
+		b, err := bds.Batch()
+		if err != nil {
+			return 0, err
+		}
+		w, commit = b, b.Commit
+	}
+
+	count := 0
+	convert := func(prefix ds.Key, keys []cid.Cid) error {
+		for _, c := range keys {
+			info, _ := old.PinInfo(c)
+			if err := putPin(w, prefix, c, info); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}
+
+	if err := convert(recursivePrefix, old.RecursiveKeys()); err != nil {
+		return 0, fmt.Errorf("cannot convert recursive pins: %v", err)
+	}
+	if err := convert(directPrefix, old.DirectKeys()); err != nil {
+		return 0, fmt.Errorf("cannot convert direct pins: %v", err)
+	}
+	if err := commit(); err != nil {
+		return 0, err
+	}
+
+	if err := Init(d); err != nil {
+		return 0, err
+	}
+
+	// Only drop the old state once the new one is complete.
+	if err := deleteDAGState(d); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+func deleteDAGState(d ds.Datastore) error {
+	res, err := d.Query(dsq.Query{Prefix: dagPinInfoPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := d.Delete(ds.RawKey(e.Key)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+
+	err = d.Delete(dagPinRootKey)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,719 @@
+// Package dspinner implements a pin.Pinner which stores each pin as its own
+// key in the datastore. Unlike the default pinner, it does not keep the pin
+// sets in memory nor rewrite them as a whole on Flush, so pinning and
+// unpinning stay cheap with millions of pins.
+package dspinner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-ipfs/dagutils"
+	"github.com/ipfs/go-ipfs/pin"
+	mdag "github.com/ipfs/go-merkledag"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pin/dspinner")
+
+var (
+	// versionKey marks a datastore whose pins are managed by this pinner
+	versionKey = ds.NewKey("/pins/version")
+
+	recursivePrefix = ds.NewKey("/pins/recursive")
+	directPrefix    = ds.NewKey("/pins/direct")
+
+	// expiryPrefix indexes the pins which expire, under keys ordered by
+	// expiry time: /pins/expiry/<time>/<recursive|direct>/<cid>
+	expiryPrefix = ds.NewKey("/pins/expiry")
+)
+
+const currentVersion = "1"
+
+// pinner implements the pin.Pinner interface
+type pinner struct {
+	lock   sync.RWMutex
+	dserv  ipld.DAGService
+	dstore ds.Datastore
+}
+
+// New creates a pinner storing its pins in the given datastore. The
+// datastore should have been initialized with Init or ConvertFromDAG.
+func New(dstore ds.Datastore, dserv ipld.DAGService) pin.Pinner {
+	return &pinner{
+		dserv:  dserv,
+		dstore: dstore,
+	}
+}
+
+// Initialized returns whether the pins of the given datastore are managed by
+// this pinner.
+func Initialized(d ds.Datastore) (bool, error) {
+	v, err := d.Get(versionKey)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+
+	if string(v) != currentVersion {
+		return false, fmt.Errorf("unsupported datastore pinner version %q", v)
+	}
+	return true, nil
+}
+
+// Init marks the given datastore as managed by this pinner.
+func Init(d ds.Datastore) error {
+	return d.Put(versionKey, []byte(currentVersion))
+}
+
+func pinKey(prefix ds.Key, c cid.Cid) ds.Key {
+	return prefix.Child(dshelp.CidToDsKey(c))
+}
+
+// expiryTime formats expiry times so that they sort as strings
+func expiryTime(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+func expiryKey(t time.Time, prefix ds.Key, c cid.Cid) ds.Key {
+	return expiryPrefix.ChildString(expiryTime(t)).ChildString(prefix.BaseNamespace()).Child(dshelp.CidToDsKey(c))
+}
+
+// Pin the given node, optionally recursive
+func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	err := p.dserv.Add(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	c := node.Cid()
+
+	if recurse {
+		has, err := p.has(recursivePrefix, c)
+		if err != nil || has {
+			return err
+		}
+
+		p.lock.Unlock()
+		// fetch entire graph
+		err = mdag.FetchGraph(ctx, c, p.dserv)
+		p.lock.Lock()
+		if err != nil {
+			return err
+		}
+
+		has, err = p.has(recursivePrefix, c)
+		if err != nil || has {
+			return err
+		}
+
+		// a direct pin becomes recursive, and keeps its label
+		info, _, err := p.get(directPrefix, c)
+		if err != nil {
+			return err
+		}
+		if err := p.put(recursivePrefix, c, info); err != nil {
+			return err
+		}
+		return p.delete(directPrefix, c)
+	}
+
+	p.lock.Unlock()
+	_, err = p.dserv.Get(ctx, c)
+	p.lock.Lock()
+	if err != nil {
+		return err
+	}
+
+	has, err := p.has(recursivePrefix, c)
+	if err != nil {
+		return err
+	}
+	if has {
+		return fmt.Errorf("%s already pinned recursively", c.String())
+	}
+
+	has, err = p.has(directPrefix, c)
+	if err != nil || has {
+		return err
+	}
+	return p.put(directPrefix, c, pin.Info{})
+}
+
+// Unpin a given key
+func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	has, err := p.has(recursivePrefix, c)
+	if err != nil {
+		return err
+	}
+	if has {
+		if !recursive {
+			return fmt.Errorf("%s is pinned recursively", c)
+		}
+		return p.delete(recursivePrefix, c)
+	}
+
+	has, err = p.has(directPrefix, c)
+	if err != nil {
+		return err
+	}
+	if has {
+		return p.delete(directPrefix, c)
+	}
+	return pin.ErrNotPinned
+}
+
+// IsPinned returns whether or not the given key is pinned
+// and an explanation of why its pinned
+func (p *pinner) IsPinned(c cid.Cid) (string, bool, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.isPinnedWithType(c, pin.Any)
+}
+
+// IsPinnedWithType returns whether or not the given cid is pinned with the
+// given pin type, as well as returning the type of pin its pinned with.
+func (p *pinner) IsPinnedWithType(c cid.Cid, mode pin.Mode) (string, bool, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.isPinnedWithType(c, mode)
+}
+
+func (p *pinner) isPinnedWithType(c cid.Cid, mode pin.Mode) (string, bool, error) {
+	switch mode {
+	case pin.Any, pin.Direct, pin.Indirect, pin.Recursive, pin.Internal:
+	default:
+		err := fmt.Errorf("invalid Pin Mode '%d', must be one of {%d, %d, %d, %d, %d}",
+			mode, pin.Direct, pin.Indirect, pin.Recursive, pin.Internal, pin.Any)
+		return "", false, err
+	}
+
+	if mode == pin.Recursive || mode == pin.Any {
+		has, err := p.has(recursivePrefix, c)
+		if err != nil {
+			return "", false, err
+		}
+		if has {
+			return "recursive", true, nil
+		}
+	}
+	if mode == pin.Recursive {
+		return "", false, nil
+	}
+
+	if mode == pin.Direct || mode == pin.Any {
+		has, err := p.has(directPrefix, c)
+		if err != nil {
+			return "", false, err
+		}
+		if has {
+			return "direct", true, nil
+		}
+	}
+
+	// this pinner keeps no internal objects
+	if mode == pin.Direct || mode == pin.Internal {
+		return "", false, nil
+	}
+
+	// Default is Indirect
+	var via string
+	visitedSet := cid.NewSet()
+	err := p.forEachKey(recursivePrefix, func(rc cid.Cid) (bool, error) {
+		has, err := hasChild(p.dserv, rc, c, visitedSet.Visit)
+		if err != nil {
+			return false, err
+		}
+		if has {
+			via = rc.String()
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return via, via != "", nil
+}
+
+// CheckIfPinned Checks if a set of keys are pinned, more efficient than
+// calling IsPinned for each key, returns the pinned status of cid(s)
+func (p *pinner) CheckIfPinned(cids ...cid.Cid) ([]pin.Pinned, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	pinned := make([]pin.Pinned, 0, len(cids))
+	toCheck := cid.NewSet()
+
+	// First check for non-Indirect pins directly
+	for _, c := range cids {
+		isRecursive, err := p.has(recursivePrefix, c)
+		if err != nil {
+			return nil, err
+		}
+		isDirect, err := p.has(directPrefix, c)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case isRecursive:
+			pinned = append(pinned, pin.Pinned{Key: c, Mode: pin.Recursive})
+		case isDirect:
+			pinned = append(pinned, pin.Pinned{Key: c, Mode: pin.Direct})
+		default:
+			toCheck.Add(c)
+		}
+	}
+
+	// Now walk all recursive pins to check for indirect pins
+	var checkChildren func(cid.Cid, cid.Cid) error
+	checkChildren = func(rk, parentKey cid.Cid) error {
+		links, err := ipld.GetLinks(context.TODO(), p.dserv, parentKey)
+		if err != nil {
+			return err
+		}
+		for _, lnk := range links {
+			c := lnk.Cid
+
+			if toCheck.Has(c) {
+				pinned = append(pinned,
+					pin.Pinned{Key: c, Mode: pin.Indirect, Via: rk})
+				toCheck.Remove(c)
+			}
+
+			err := checkChildren(rk, c)
+			if err != nil {
+				return err
+			}
+
+			if toCheck.Len() == 0 {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	if toCheck.Len() > 0 {
+		err := p.forEachKey(recursivePrefix, func(rk cid.Cid) (bool, error) {
+			err := checkChildren(rk, rk)
+			return toCheck.Len() > 0, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Anything left in toCheck is not pinned
+	for _, k := range toCheck.Keys() {
+		pinned = append(pinned, pin.Pinned{Key: k, Mode: pin.NotPinned})
+	}
+
+	return pinned, nil
+}
+
+// RemovePinWithMode is for manually editing the pin structure.
+// Use with care! If used improperly, garbage collection may not
+// be successful.
+func (p *pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var err error
+	switch mode {
+	case pin.Direct:
+		err = p.delete(directPrefix, c)
+	case pin.Recursive:
+		err = p.delete(recursivePrefix, c)
+	default:
+		// programmer error, panic OK
+		panic("unrecognized pin type")
+	}
+	if err != nil {
+		log.Errorf("failed to remove pin of %s: %s", c, err)
+	}
+}
+
+// PinWithMode allows the user to have fine grained control over pin
+// counts
+func (p *pinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var err error
+	switch mode {
+	case pin.Recursive:
+		err = p.put(recursivePrefix, c, pin.Info{})
+	case pin.Direct:
+		err = p.put(directPrefix, c, pin.Info{})
+	}
+	if err != nil {
+		log.Errorf("failed to pin %s: %s", c, err)
+	}
+}
+
+// Update updates a recursive pin from one cid to another
+// this is more efficient than simply pinning the new one and unpinning the
+// old one
+func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	info, has, err := p.get(recursivePrefix, from)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return fmt.Errorf("'from' cid was not recursively pinned already")
+	}
+
+	err = dagutils.DiffEnumerate(ctx, p.dserv, from, to)
+	if err != nil {
+		return err
+	}
+
+	if err := p.put(recursivePrefix, to, info); err != nil {
+		return err
+	}
+	if unpin {
+		return p.delete(recursivePrefix, from)
+	}
+	return nil
+}
+
+// Flush is a no-op, as pins are written to the datastore as they change
+func (p *pinner) Flush() error {
+	return nil
+}
+
+// DirectKeys returns a slice containing the directly pinned keys
+func (p *pinner) DirectKeys() []cid.Cid {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	keys, err := p.keys(directPrefix)
+	if err != nil {
+		log.Errorf("failed to list direct pins: %s", err)
+	}
+	return keys
+}
+
+// RecursiveKeys returns a slice containing the recursively pinned keys
+func (p *pinner) RecursiveKeys() []cid.Cid {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	keys, err := p.keys(recursivePrefix)
+	if err != nil {
+		log.Errorf("failed to list recursive pins: %s", err)
+	}
+	return keys
+}
+
+// DirectKeysChan streams the directly pinned keys, without loading them all
+// in memory.
+func (p *pinner) DirectKeysChan(ctx context.Context) <-chan pin.StreamedCid {
+	return p.keysChan(ctx, directPrefix)
+}
+
+// RecursiveKeysChan streams the recursively pinned keys, without loading
+// them all in memory.
+func (p *pinner) RecursiveKeysChan(ctx context.Context) <-chan pin.StreamedCid {
+	return p.keysChan(ctx, recursivePrefix)
+}
+
+// InternalPins returns nothing, as this pinner does not store its state in
+// the DAG
+func (p *pinner) InternalPins() []cid.Cid {
+	return nil
+}
+
+// PinInfo returns the label attached to a direct or recursive pin
+func (p *pinner) PinInfo(c cid.Cid) (pin.Info, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, prefix := range []ds.Key{recursivePrefix, directPrefix} {
+		info, has, err := p.get(prefix, c)
+		if err != nil {
+			log.Errorf("failed to read pin of %s: %s", c, err)
+			return pin.Info{}, false
+		}
+		if has {
+			return info, !info.IsEmpty()
+		}
+	}
+	return pin.Info{}, false
+}
+
+// SetPinInfo attaches a label to a direct or recursive pin
+func (p *pinner) SetPinInfo(c cid.Cid, info pin.Info) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, prefix := range []ds.Key{recursivePrefix, directPrefix} {
+		has, err := p.has(prefix, c)
+		if err != nil {
+			return err
+		}
+		if has {
+			return p.put(prefix, c, info)
+		}
+	}
+	return pin.ErrNotPinned
+}
+
+// ExpiredKeys returns the direct and recursive pins whose expiry passed at
+// the given time. Only the entries of the expiry index which are due are
+// read, entries left over by pins which changed since are dropped.
+func (p *pinner) ExpiredKeys(now time.Time) ([]cid.Cid, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	res, err := p.dstore.Query(dsq.Query{
+		Prefix:   expiryPrefix.String(),
+		KeysOnly: true,
+		Orders:   []dsq.Order{dsq.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	due := expiryTime(now)
+	var out []cid.Cid
+	var stale []ds.Key
+	for {
+		r, ok := res.NextSync()
+		if !ok {
+			break
+		}
+		if r.Error != nil {
+			res.Close()
+			return nil, r.Error
+		}
+
+		k := ds.RawKey(r.Key)
+		parts := k.Namespaces()
+		if len(parts) != 5 {
+			log.Errorf("invalid pin expiry key %s", r.Key)
+			stale = append(stale, k)
+			continue
+		}
+		if parts[2] > due {
+			// the following entries expire later
+			break
+		}
+
+		prefix := ds.NewKey("/pins").ChildString(parts[3])
+		c, err := dshelp.DsKeyToCid(ds.NewKey(parts[4]))
+		if err != nil {
+			log.Errorf("invalid pin expiry key %s: %s", r.Key, err)
+			stale = append(stale, k)
+			continue
+		}
+		info, has, err := p.get(prefix, c)
+		if err != nil {
+			res.Close()
+			return nil, err
+		}
+		if !has || !info.Expired(now) || expiryTime(info.Expires) != parts[2] {
+			stale = append(stale, k)
+			continue
+		}
+		out = append(out, c)
+	}
+	res.Close()
+
+	for _, k := range stale {
+		if err := p.dstore.Delete(k); err != nil && err != ds.ErrNotFound {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (p *pinner) has(prefix ds.Key, c cid.Cid) (bool, error) {
+	return p.dstore.Has(pinKey(prefix, c))
+}
+
+func (p *pinner) get(prefix ds.Key, c cid.Cid) (pin.Info, bool, error) {
+	var info pin.Info
+	b, err := p.dstore.Get(pinKey(prefix, c))
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return info, false, nil
+	default:
+		return info, false, err
+	}
+
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &info); err != nil {
+			return info, true, fmt.Errorf("invalid pin of %s: %s", c, err)
+		}
+	}
+	return info, true, nil
+}
+
+func (p *pinner) put(prefix ds.Key, c cid.Cid, info pin.Info) error {
+	old, has, err := p.get(prefix, c)
+	if err != nil {
+		return err
+	}
+	if has && !old.Expires.IsZero() && !old.Expires.Equal(info.Expires) {
+		if err := p.deleteKey(expiryKey(old.Expires, prefix, c)); err != nil {
+			return err
+		}
+	}
+	return putPin(p.dstore, prefix, c, info)
+}
+
+func (p *pinner) delete(prefix ds.Key, c cid.Cid) error {
+	// a pin whose label cannot be read leaves a stale expiry entry at
+	// worst, which ExpiredKeys drops
+	if info, has, err := p.get(prefix, c); err == nil && has && !info.Expires.IsZero() {
+		if err := p.deleteKey(expiryKey(info.Expires, prefix, c)); err != nil {
+			return err
+		}
+	}
+	return p.deleteKey(pinKey(prefix, c))
+}
+
+func (p *pinner) deleteKey(k ds.Key) error {
+	err := p.dstore.Delete(k)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (p *pinner) keys(prefix ds.Key) ([]cid.Cid, error) {
+	res, err := p.dstore.Query(dsq.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var out []cid.Cid
+	for r := range res.Next() {
+		if r.Error != nil {
+			return out, r.Error
+		}
+		c, err := keyToCid(r.Key)
+		if err != nil {
+			log.Errorf("invalid pin key %s: %s", r.Key, err)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// forEachKey calls fn with the pins under prefix, until it returns false
+func (p *pinner) forEachKey(prefix ds.Key, fn func(cid.Cid) (bool, error)) error {
+	res, err := p.dstore.Query(dsq.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		c, err := keyToCid(r.Key)
+		if err != nil {
+			log.Errorf("invalid pin key %s: %s", r.Key, err)
+			continue
+		}
+		more, err := fn(c)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pinner) keysChan(ctx context.Context, prefix ds.Key) <-chan pin.StreamedCid {
+	out := make(chan pin.StreamedCid, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(out)
+		err := p.forEachKey(prefix, func(c cid.Cid) (bool, error) {
+			select {
+			case out <- pin.StreamedCid{C: c}:
+				return true, nil
+			case <-ctx.Done():
+				return false, nil
+			}
+		})
+		if err != nil {
+			select {
+			case out <- pin.StreamedCid{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// putPin stores a pin along with its label, if any, and indexes its expiry
+func putPin(w ds.Write, prefix ds.Key, c cid.Cid, info pin.Info) error {
+	var b []byte
+	if !info.IsEmpty() {
+		var err error
+		if b, err = json.Marshal(info); err != nil {
+			return err
+		}
+	}
+	if err := w.Put(pinKey(prefix, c), b); err != nil {
+		return err
+	}
+	if info.Expires.IsZero() {
+		return nil
+	}
+	return w.Put(expiryKey(info.Expires, prefix, c), nil)
+}
+
+func keyToCid(k string) (cid.Cid, error) {
+	return dshelp.DsKeyToCid(ds.NewKey(ds.RawKey(k).BaseNamespace()))
+}
+
+// hasChild recursively looks for a Cid among the children of a root Cid.
+// The visit function can be used to shortcut already-visited branches.
+func hasChild(ng ipld.NodeGetter, root cid.Cid, child cid.Cid, visit func(cid.Cid) bool) (bool, error) {
+	links, err := ipld.GetLinks(context.TODO(), ng, root)
+	if err != nil {
+		return false, err
+	}
+	for _, lnk := range links {
+		c := lnk.Cid
+		if lnk.Cid.Equals(child) {
+			return true, nil
+		}
+		if visit(c) {
+			has, err := hasChild(ng, c, child, visit)
+			if err != nil {
+				return false, err
+			}
+
+			if has {
+				return has, nil
+			}
+		}
+	}
+	return false, nil
+}
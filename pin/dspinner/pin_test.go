@@ -0,0 +1,340 @@
+package dspinner
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/pin"
+
+	bs "github.com/ipfs/go-blockservice"
+	mdag "github.com/ipfs/go-merkledag"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	util "github.com/ipfs/go-ipfs-util"
+)
+
+var rand = util.NewTimeSeededRand()
+
+func randNode() (*mdag.ProtoNode, cid.Cid) {
+	nd := new(mdag.ProtoNode)
+	nd.SetData(make([]byte, 32))
+	_, err := io.ReadFull(rand, nd.Data())
+	if err != nil {
+		panic(err)
+	}
+	k := nd.Cid()
+	return nd, k
+}
+
+func assertPinned(t *testing.T, p pin.Pinner, c cid.Cid, failmsg string) {
+	_, pinned, err := p.IsPinned(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pinned {
+		t.Fatal(failmsg)
+	}
+}
+
+func assertUnpinned(t *testing.T, p pin.Pinner, c cid.Cid, failmsg string) {
+	_, pinned, err := p.IsPinned(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pinned {
+		t.Fatal(failmsg)
+	}
+}
+
+func TestPinnerBasic(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+
+	if err := Init(dstore); err != nil {
+		t.Fatal(err)
+	}
+	p := New(dstore, dserv)
+
+	a, ak := randNode()
+	if err := dserv.Add(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin A{}
+	if err := p.Pin(ctx, a, false); err != nil {
+		t.Fatal(err)
+	}
+	assertPinned(t, p, ak, "Failed to find key")
+
+	// create new node c, to be indirectly pinned through b
+	c, ck := randNode()
+	if err := dserv.Add(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create new node b, to be parent to a and c
+	b, _ := randNode()
+	if err := b.AddNodeLink("child", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddNodeLink("otherchild", c); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	bk := b.Cid()
+
+	// recursively pin B{A,C}
+	if err := p.Pin(ctx, b, true); err != nil {
+		t.Fatal(err)
+	}
+
+	assertPinned(t, p, ck, "child of recursively pinned node not found")
+	assertPinned(t, p, bk, "Recursively pinned node not found..")
+
+	if err := p.Unpin(ctx, bk, false); err == nil {
+		t.Fatal("expected a non recursive unpin of a recursive pin to fail")
+	}
+	if err := p.Unpin(ctx, bk, true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, ck, "child of unpinned node should not be pinned")
+
+	// pins are persisted without any Flush
+	np := New(dstore, dserv)
+	assertPinned(t, np, ak, "Could not find pinned node!")
+	assertUnpinned(t, np, bk, "unpinned node should stay unpinned")
+
+	if len(np.DirectKeys()) != 1 || len(np.RecursiveKeys()) != 0 {
+		t.Fatal("unexpected pin sets")
+	}
+}
+
+func TestPinInfo(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := New(dstore, dserv)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, n2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Pin(ctx, n1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetPinInfo(c1, pin.Info{Name: "site"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a direct pin keeps its label when it becomes recursive
+	if err := p.Pin(ctx, n1, true); err != nil {
+		t.Fatal(err)
+	}
+	if info, ok := p.PinInfo(c1); !ok || info.Name != "site" {
+		t.Fatal("label should be kept")
+	}
+
+	if err := p.Update(ctx, c1, c2, true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, c1, "c1 should no longer be pinned")
+	if info, ok := p.PinInfo(c2); !ok || info.Name != "site" {
+		t.Fatal("pin update should keep the label")
+	}
+}
+
+func TestExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := New(dstore, dserv)
+
+	now := time.Now()
+	nodes := make([]cid.Cid, 3)
+	for i := range nodes {
+		n, c := randNode()
+		if err := dserv.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Pin(ctx, n, i != 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SetPinInfo(c, pin.Info{Expires: now.Add(time.Duration(i+1) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = c
+	}
+
+	// the third pin is made permanent again
+	if err := p.SetPinInfo(nodes[2], pin.Info{}); err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(5 * time.Minute)
+	expired, err := p.ExpiredKeys(now.Add(90 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || !expired[0].Equals(nodes[0]) {
+		t.Fatalf("expected only the first pin to be expired, got %v", expired)
+	}
+
+	removed, err := pin.RemoveExpired(p, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 expired pins to be removed, got %d", len(removed))
+	}
+	assertUnpinned(t, p, nodes[0], "expired direct pin should be removed")
+	assertUnpinned(t, p, nodes[1], "expired recursive pin should be removed")
+	assertPinned(t, p, nodes[2], "permanent pin should be kept")
+
+	res, err := dstore.Query(dsq.Query{Prefix: expiryPrefix.String(), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the expiry index to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestKeysChan(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+
+	if err := Init(dstore); err != nil {
+		t.Fatal(err)
+	}
+	p := New(dstore, dserv)
+
+	pinned := cid.NewSet()
+	for i := 0; i < 3; i++ {
+		nd, k := randNode()
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+		pinned.Add(k)
+	}
+
+	streamed := cid.NewSet()
+	for k := range p.RecursiveKeysChan(ctx) {
+		if k.Err != nil {
+			t.Fatal(k.Err)
+		}
+		streamed.Add(k.C)
+	}
+	if streamed.Len() != pinned.Len() {
+		t.Fatalf("expected %d recursive pins, got %d", pinned.Len(), streamed.Len())
+	}
+	for k := range p.DirectKeysChan(ctx) {
+		t.Fatalf("unexpected direct pin %s", k.C)
+	}
+
+	// a cancelled listing is closed without listing everything
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	for range p.RecursiveKeysChan(cctx) {
+	}
+}
+
+func TestConvertFromDAG(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	old := pin.NewPinner(dstore, dserv, dserv)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, n2); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Pin(ctx, n1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Pin(ctx, n2, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.SetPinInfo(c1, pin.Info{Name: "site"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := ConvertFromDAG(ctx, dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 converted pins, got %d", n)
+	}
+
+	ok, err := Initialized(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("datastore should be marked as converted")
+	}
+	if has, _ := dstore.Has(dagPinRootKey); has {
+		t.Fatal("old pin state should be removed")
+	}
+
+	p := New(dstore, dserv)
+	if _, ok, _ := p.IsPinnedWithType(c1, pin.Recursive); !ok {
+		t.Fatal("recursive pin should be converted")
+	}
+	if _, ok, _ := p.IsPinnedWithType(c2, pin.Direct); !ok {
+		t.Fatal("direct pin should be converted")
+	}
+	if info, ok := p.PinInfo(c1); !ok || info.Name != "site" {
+		t.Fatal("pin label should be converted")
+	}
+}
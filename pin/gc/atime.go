@@ -0,0 +1,107 @@
+package gc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+// accessResolution is the precision of the recorded access times
+const accessResolution = time.Minute
+
+// AccessLog records when blocks were last read or written, so that eviction
+// can remove the least recently used blocks first. Accesses are kept in
+// memory until Flush stores them in the datastore.
+type AccessLog struct {
+	dstore ds.Datastore
+
+	lock  sync.Mutex
+	dirty map[cid.Cid]time.Time
+}
+
+// NewAccessLog returns an access log stored in the given datastore
+func NewAccessLog(d ds.Datastore) *AccessLog {
+	return &AccessLog{
+		dstore: namespace.Wrap(d, ds.NewKey("/local/atime")),
+		dirty:  make(map[cid.Cid]time.Time),
+	}
+}
+
+// Touch records an access to the given block
+func (l *AccessLog) Touch(c cid.Cid) {
+	now := time.Now().Truncate(accessResolution)
+
+	l.lock.Lock()
+	l.dirty[c] = now
+	l.lock.Unlock()
+}
+
+// Flush stores the accesses recorded since the last Flush
+func (l *AccessLog) Flush() error {
+	l.lock.Lock()
+	dirty := l.dirty
+	l.dirty = make(map[cid.Cid]time.Time)
+	l.lock.Unlock()
+
+	for c, t := range dirty {
+		v := strconv.FormatInt(t.Unix(), 10)
+		if err := l.dstore.Put(dshelp.CidToDsKey(c), []byte(v)); err != nil {
+			// keep what could not be written for the next Flush
+			l.lock.Lock()
+			for c, t := range dirty {
+				if _, ok := l.dirty[c]; !ok {
+					l.dirty[c] = t
+				}
+			}
+			l.lock.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Forget drops the access times of the given blocks, once they are removed
+func (l *AccessLog) Forget(keys []cid.Cid) error {
+	l.lock.Lock()
+	for _, c := range keys {
+		delete(l.dirty, c)
+	}
+	l.lock.Unlock()
+
+	for _, c := range keys {
+		if err := l.dstore.Delete(dshelp.CidToDsKey(c)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastAccess returns when the given block was last accessed, or the zero
+// time if no access was recorded since access times are recorded
+func (l *AccessLog) LastAccess(c cid.Cid) (time.Time, error) {
+	l.lock.Lock()
+	t, ok := l.dirty[c]
+	l.lock.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	v, err := l.dstore.Get(dshelp.CidToDsKey(c))
+	if err == ds.ErrNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	secs, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		log.Errorf("invalid access time for %s: %s", c, err)
+		return time.Time{}, nil
+	}
+	return time.Unix(secs, 0), nil
+}
@@ -2,10 +2,13 @@
 package gc
 
 import (
+	"container/heap"
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	pin "github.com/ipfs/go-ipfs/pin"
@@ -27,8 +30,16 @@ var log = logging.Logger("gc")
 type Result struct {
 	KeyRemoved cid.Cid
 	Error      error
+
+	// Size is the size of the removed object in bytes, or -1 if it could
+	// not be determined.
+	Size int
 }
 
+// sweepBatchSize is the number of unmarked blocks deleted in each critical
+// section of a concurrent garbage collection
+const sweepBatchSize = 256
+
 // GC performs a mark and sweep garbage collection of the blocks in the blockstore
 // first, it creates a 'marked' set and adds to it the following:
 // - all recursively pinned blocks, plus all of their descendants (recursively)
@@ -36,15 +47,35 @@ type Result struct {
 // - all directly pinned blocks
 // - all blocks utilized internally by the pinner
 //
+// Pins whose expiry has passed are ignored, even if they have not been
+// removed from the pinner yet.
+//
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
-func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+//
+// When the blockstore is a TrackingBlockstore, the GCLock is not held while
+// marking. Blocks are then deleted in small batches, each one under the
+// GCLock: blocks written since the GC started are kept, and the pins made in
+// the meantime are marked before each batch.
+//
+// The marked set is kept in memory, unless another MarkSet is given with
+// WithMarkSet.
+func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, opts ...Option) <-chan Result {
 	ctx, cancel := context.WithCancel(ctx)
-
-	elock := log.EventBegin(ctx, "GC.lockWait")
-	unlocker := bs.GCLock()
-	elock.Done()
-	elock = log.EventBegin(ctx, "GC.locked")
+	o := processOptions(opts)
+
+	tbs, concurrent := bs.(*TrackingBlockstore)
+
+	var unlocker bstore.Unlocker
+	var elock *logging.EventInProgress
+	if concurrent {
+		tbs.startTracking()
+	} else {
+		elock = log.EventBegin(ctx, "GC.lockWait")
+		unlocker = bs.GCLock()
+		elock.Done()
+		elock = log.EventBegin(ctx, "GC.locked")
+	}
 	emark := log.EventBegin(ctx, "GC.mark")
 
 	bsrv := bserv.New(bs, offline.Exchange(bs))
@@ -55,10 +86,28 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 	go func() {
 		defer cancel()
 		defer close(output)
-		defer unlocker.Unlock()
-		defer elock.Done()
+		if concurrent {
+			defer tbs.stopTracking()
+		} else {
+			defer unlocker.Unlock()
+			defer elock.Done()
+		}
 
-		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		// snapshot the pins before marking, so that the ones made while
+		// marking are found when sweeping
+		var sw *sweeper
+		if concurrent {
+			var err error
+			if sw, err = newSweeper(ctx, tbs, pn, ds); err != nil {
+				select {
+				case output <- Result{Error: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+
+		gcs, err := o.newMarkSet()
 		if err != nil {
 			select {
 			case output <- Result{Error: err}:
@@ -66,6 +115,15 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			}
 			return
 		}
+		defer closeMarkSet(gcs)
+
+		if err := markColoredSet(ctx, pn, ds, bestEffortRoots, gcs, output); err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
 		emark.Append(logging.LoggableMap{
 			"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
 		})
@@ -82,8 +140,51 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 		}
 
 		errors := false
+		aborted := false
 		var removed uint64
+		var alog *AccessLog
+		if concurrent {
+			alog = tbs.AccessLog()
+		}
+
+		// deleteBatch removes the given blocks, unless they were marked in
+		// the meantime, and reports the results. It returns false when GC
+		// must stop.
+		deleteBatch := func(batch []cid.Cid) bool {
+			var results []Result
+			if concurrent {
+				var err error
+				unlock := bs.GCLock()
+				results, err = sw.sweep(ctx, gcs, batch)
+				unlock.Unlock()
+				if err != nil {
+					aborted = true
+					select {
+					case output <- Result{Error: err}:
+					case <-ctx.Done():
+					}
+					return false
+				}
+			} else {
+				results = deleteBlocks(bs, batch)
+			}
+			forgetRemoved(alog, results)
+
+			for _, r := range results {
+				removed++
+				if r.Error != nil {
+					errors = true
+				}
+				select {
+				case output <- r:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
 
+		var batch []cid.Cid
 	loop:
 		for ctx.Err() == nil { // select may not notice that we're "done".
 			select {
@@ -91,33 +192,31 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 				if !ok {
 					break loop
 				}
-				if !gcs.Has(k) {
-					err := bs.DeleteBlock(k)
-					removed++
-					if err != nil {
-						errors = true
-						select {
-						case output <- Result{Error: &CannotDeleteBlockError{k, err}}:
-						case <-ctx.Done():
-							break loop
-						}
-						// continue as error is non-fatal
-						continue loop
-					}
-					select {
-					case output <- Result{KeyRemoved: k}:
-					case <-ctx.Done():
+				if gcs.Has(k) {
+					continue
+				}
+				batch = append(batch, k)
+				if !concurrent || len(batch) >= sweepBatchSize {
+					if !deleteBatch(batch) {
+						batch = nil
 						break loop
 					}
+					batch = batch[:0]
 				}
 			case <-ctx.Done():
 				break loop
 			}
 		}
+		if len(batch) > 0 && ctx.Err() == nil {
+			deleteBatch(batch)
+		}
 		esweep.Append(logging.LoggableMap{
 			"whiteSetSize": fmt.Sprintf("%d", removed),
 		})
 		esweep.Done()
+		if aborted {
+			return
+		}
 		if errors {
 			select {
 			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
@@ -145,10 +244,233 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 	return output
 }
 
+// deleteBlocks removes the given blocks, returning one Result per block
+func deleteBlocks(bs bstore.Blockstore, keys []cid.Cid) []Result {
+	results := make([]Result, 0, len(keys))
+	for _, k := range keys {
+		size := blockSize(bs, k)
+		if err := bs.DeleteBlock(k); err != nil {
+			// continue as error is non-fatal
+			results = append(results, Result{Error: &CannotDeleteBlockError{k, err}})
+			continue
+		}
+		results = append(results, Result{KeyRemoved: k, Size: size})
+	}
+	return results
+}
+
+// forgetRemoved drops the access times of the removed blocks from the log,
+// if there is one
+func forgetRemoved(alog *AccessLog, results []Result) {
+	if alog == nil {
+		return
+	}
+	keys := make([]cid.Cid, 0, len(results))
+	for _, r := range results {
+		if r.Error == nil {
+			keys = append(keys, r.KeyRemoved)
+		}
+	}
+	if err := alog.Forget(keys); err != nil {
+		log.Errorf("failed to drop access times of removed blocks: %s", err)
+	}
+}
+
+func blockSize(bs bstore.Blockstore, k cid.Cid) int {
+	size, err := bs.GetSize(k)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// DryRun marks the live blocks and walks the blockstore like GC does, but
+// without removing anything. It returns a Result for each block GC would
+// remove. As the GCLock is not taken, blocks added in the meantime may be
+// reported too.
+func DryRun(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, opts ...Option) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+	o := processOptions(opts)
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		gcs, err := o.newMarkSet()
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		defer closeMarkSet(gcs)
+
+		if err := markColoredSet(ctx, pn, ds, bestEffortRoots, gcs, output); err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		for ctx.Err() == nil {
+			select {
+			case k, ok := <-keychan:
+				if !ok {
+					return
+				}
+				if gcs.Has(k) {
+					continue
+				}
+				select {
+				case output <- Result{KeyRemoved: k, Size: blockSize(bs, k)}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output
+}
+
+// sweeper deletes the unmarked blocks of a concurrent garbage collection,
+// marking the pins made since the collection started first.
+type sweeper struct {
+	bs *TrackingBlockstore
+	pn pin.Pinner
+	ng ipld.NodeGetter
+
+	pinGen uint64
+	roots  *cid.Set
+}
+
+func newSweeper(ctx context.Context, bs *TrackingBlockstore, pn pin.Pinner, ng ipld.NodeGetter) (*sweeper, error) {
+	sw := &sweeper{
+		bs:     bs,
+		pn:     pn,
+		ng:     ng,
+		pinGen: bs.pinGeneration(),
+		roots:  cid.NewSet(),
+	}
+	err := forEachPin(ctx, pn.RecursiveKeysChan, pin.ExpiredSet(pn, time.Now()), func(k cid.Cid) error {
+		sw.roots.Add(k)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range pn.InternalPins() {
+		sw.roots.Add(k)
+	}
+	return sw, nil
+}
+
+// sweep must be called with the GCLock held
+func (sw *sweeper) sweep(ctx context.Context, gcs MarkSet, batch []cid.Cid) ([]Result, error) {
+	if err := sw.markNewPins(ctx, gcs); err != nil {
+		return nil, err
+	}
+
+	keys := make([]cid.Cid, 0, len(batch))
+	for _, k := range batch {
+		if !gcs.Has(k) && !sw.bs.wasWritten(k) {
+			keys = append(keys, k)
+		}
+	}
+	return deleteBlocks(sw.bs, keys), nil
+}
+
+// markNewPins marks the pins made since the last call, if any pin lock was
+// taken in the meantime
+func (sw *sweeper) markNewPins(ctx context.Context, gcs MarkSet) error {
+	gen := sw.bs.pinGeneration()
+	if gen == sw.pinGen {
+		return nil
+	}
+	sw.pinGen = gen
+
+	expired := pin.ExpiredSet(sw.pn, time.Now())
+	var roots []cid.Cid
+	addRoot := func(k cid.Cid) error {
+		if sw.roots.Visit(k) {
+			roots = append(roots, k)
+		}
+		return nil
+	}
+	if err := forEachPin(ctx, sw.pn.RecursiveKeysChan, expired, addRoot); err != nil {
+		return err
+	}
+	for _, k := range sw.pn.InternalPins() {
+		addRoot(k)
+	}
+
+	// Walk the new pins on their own: a block already marked as a direct
+	// pin does not have its descendants marked.
+	visited := cid.NewSet()
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, sw.ng, c)
+		if err != nil {
+			return nil, &CannotFetchLinksError{c, err}
+		}
+		return links, nil
+	}
+	if err := Descendants(ctx, getLinks, visited, roots); err != nil {
+		return err
+	}
+	visited.ForEach(func(c cid.Cid) error {
+		gcs.Add(c)
+		return nil
+	})
+
+	return forEachPin(ctx, sw.pn.DirectKeysChan, expired, func(k cid.Cid) error {
+		gcs.Add(k)
+		return nil
+	})
+}
+
+// forEachPin calls fn with the unexpired pins listed by keys, until it fails.
+// An interrupted listing is an error, as the pins it missed would otherwise
+// be collected.
+func forEachPin(ctx context.Context, keys func(context.Context) <-chan pin.StreamedCid, expired *cid.Set, fn func(cid.Cid) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for k := range keys(ctx) {
+		if k.Err != nil {
+			return k.Err
+		}
+		if expired.Has(k.C) {
+			continue
+		}
+		if err := fn(k.C); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
 // Descendants recursively finds all the descendants of the given roots and
-// adds them to the given cid.Set, using the provided dag.GetLinks function
+// adds them to the given MarkSet, using the provided dag.GetLinks function
 // to walk the tree.
-func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots []cid.Cid) error {
+func Descendants(ctx context.Context, getLinks dag.GetLinks, set MarkSet, roots []cid.Cid) error {
 	verifyGetLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
 		err := verifcid.ValidateCid(c)
 		if err != nil {
@@ -187,10 +509,18 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 // ColoredSet computes the set of nodes in the graph that are pinned by the
 // pins in the given pinner.
 func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
-	// KeySet currently implemented in memory, in the future, may be bloom filter or
-	// disk backed to conserve memory.
-	errors := false
 	gcs := cid.NewSet()
+	if err := markColoredSet(ctx, pn, ng, bestEffortRoots, gcs, output); err != nil {
+		return nil, err
+	}
+	return gcs, nil
+}
+
+// markColoredSet adds the nodes pinned by the pins in the given pinner to
+// the given MarkSet
+func markColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, gcs MarkSet, output chan<- Result) error {
+	errors := false
+	expired := pin.ExpiredSet(pn, time.Now())
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
 		if err != nil {
@@ -203,13 +533,15 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	err := Descendants(ctx, getLinks, gcs, pn.RecursiveKeys())
+	err := forEachPin(ctx, pn.RecursiveKeysChan, expired, func(k cid.Cid) error {
+		return Descendants(ctx, getLinks, gcs, []cid.Cid{k})
+	})
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
@@ -231,12 +563,16 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
-	for _, k := range pn.DirectKeys() {
+	err = forEachPin(ctx, pn.DirectKeysChan, expired, func(k cid.Cid) error {
 		gcs.Add(k)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	err = Descendants(ctx, getLinks, gcs, pn.InternalPins())
@@ -245,15 +581,209 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
 	if errors {
-		return nil, ErrCannotFetchAllLinks
+		return ErrCannotFetchAllLinks
 	}
 
-	return gcs, nil
+	return nil
+}
+
+// Evict removes unmarked blocks, least recently used first, until at least
+// toFree bytes were freed or no unmarked block is left. The blocks are
+// marked as GC does, and access times are taken from the given log: blocks
+// without a recorded access are removed first.
+func Evict(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, alog *AccessLog, toFree uint64, opts ...Option) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+	o := processOptions(opts)
+
+	tbs, concurrent := bs.(*TrackingBlockstore)
+
+	var unlocker bstore.Unlocker
+	if concurrent {
+		tbs.startTracking()
+	} else {
+		unlocker = bs.GCLock()
+	}
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+		if concurrent {
+			defer tbs.stopTracking()
+		} else {
+			defer unlocker.Unlock()
+		}
+
+		emit := func(r Result) bool {
+			select {
+			case output <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var sw *sweeper
+		if concurrent {
+			var err error
+			if sw, err = newSweeper(ctx, tbs, pn, ds); err != nil {
+				emit(Result{Error: err})
+				return
+			}
+		}
+
+		gcs, err := o.newMarkSet()
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+		defer closeMarkSet(gcs)
+
+		if err := markColoredSet(ctx, pn, ds, bestEffortRoots, gcs, output); err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		candidates, err := evictionCandidates(ctx, bs, gcs, alog, toFree)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		errors := false
+		var freed uint64
+		for len(candidates) > 0 && freed < toFree && ctx.Err() == nil {
+			// take just enough blocks to free the remaining space
+			var batch []cid.Cid
+			var batchSize uint64
+			for len(candidates) > 0 && len(batch) < sweepBatchSize && freed+batchSize < toFree {
+				batch = append(batch, candidates[0].key)
+				if candidates[0].size > 0 {
+					batchSize += uint64(candidates[0].size)
+				}
+				candidates = candidates[1:]
+			}
+
+			var results []Result
+			if concurrent {
+				unlock := bs.GCLock()
+				results, err = sw.sweep(ctx, gcs, batch)
+				unlock.Unlock()
+				if err != nil {
+					emit(Result{Error: err})
+					return
+				}
+			} else {
+				results = deleteBlocks(bs, batch)
+			}
+			forgetRemoved(alog, results)
+
+			for _, r := range results {
+				if r.Error != nil {
+					errors = true
+				} else if r.Size > 0 {
+					freed += uint64(r.Size)
+				}
+				if !emit(r) {
+					return
+				}
+			}
+		}
+
+		if errors && !emit(Result{Error: ErrCannotDeleteSomeBlocks}) {
+			return
+		}
+
+		gds, ok := dstor.(dstore.GCDatastore)
+		if !ok {
+			return
+		}
+		if err := gds.CollectGarbage(); err != nil {
+			emit(Result{Error: err})
+		}
+	}()
+
+	return output
+}
+
+type evictionCandidate struct {
+	key    cid.Cid
+	size   int
+	access time.Time
+}
+
+// freed is the space removing the block frees, as far as it is known
+func (c evictionCandidate) freed() uint64 {
+	if c.size > 0 {
+		return uint64(c.size)
+	}
+	return 0
+}
+
+// candidateHeap is a heap of eviction candidates, most recently used first
+type candidateHeap []evictionCandidate
+
+func (h candidateHeap) Len() int            { return len(h) }
+func (h candidateHeap) Less(i, j int) bool  { return h[i].access.After(h[j].access) }
+func (h candidateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateHeap) Push(x interface{}) { *h = append(*h, x.(evictionCandidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// evictionCandidates returns the least recently used unmarked blocks which
+// free toFree bytes, least recently used first. The blockstore is streamed,
+// and only the blocks which may be evicted are kept in memory.
+func evictionCandidates(ctx context.Context, bs bstore.Blockstore, gcs MarkSet, alog *AccessLog, toFree uint64) ([]evictionCandidate, error) {
+	keychan, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &candidateHeap{}
+	var total uint64
+	for k := range keychan {
+		if gcs.Has(k) {
+			continue
+		}
+		access, err := alog.LastAccess(k)
+		if err != nil {
+			return nil, err
+		}
+		if total >= toFree && h.Len() > 0 && !access.Before((*h)[0].access) {
+			// more recently used than all the blocks kept so far
+			continue
+		}
+
+		c := evictionCandidate{key: k, size: blockSize(bs, k), access: access}
+		heap.Push(h, c)
+		total += c.freed()
+		// drop the most recently used blocks which are not needed anymore
+		for h.Len() > 0 && total-(*h)[0].freed() >= toFree {
+			total -= heap.Pop(h).(evictionCandidate).freed()
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	candidates := []evictionCandidate(*h)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].access.Before(candidates[j].access)
+	})
+	return candidates, nil
 }
 
 // ErrCannotFetchAllLinks is returned as the last Result in the GC output
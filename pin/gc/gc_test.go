@@ -0,0 +1,240 @@
+package gc
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func setup() (*TrackingBlockstore, ipld.DAGService, pin.Pinner) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	return bs, dserv, pin.NewPinner(dstore, dserv, dserv)
+}
+
+func newNode(t *testing.T, bs bstore.Blockstore, data string) *dag.ProtoNode {
+	nd := dag.NodeWithData([]byte(data))
+	if err := bs.Put(nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	bs, _, pinner := setup()
+
+	kept := newNode(t, bs, "kept")
+	removed := newNode(t, bs, "removed")
+	if err := pinner.Pin(ctx, kept, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []cid.Cid
+	for res := range GC(ctx, bs, nil, pinner, nil) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		got = append(got, res.KeyRemoved)
+	}
+	if len(got) != 1 || !got[0].Equals(removed.Cid()) {
+		t.Fatalf("unexpected removed blocks: %v", got)
+	}
+	if has, _ := bs.Has(kept.Cid()); !has {
+		t.Fatal("pinned block was removed")
+	}
+}
+
+func TestSweepKeepsChangesDuringGC(t *testing.T) {
+	ctx := context.Background()
+	bs, dserv, pinner := setup()
+
+	child := newNode(t, bs, "child")
+	parent := dag.NodeWithData([]byte("parent"))
+	if err := parent.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(parent); err != nil {
+		t.Fatal(err)
+	}
+	garbage := newNode(t, bs, "garbage")
+
+	bs.startTracking()
+	defer bs.stopTracking()
+	sw, err := newSweeper(ctx, bs, pinner, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcs := cid.NewSet()
+
+	// while marking: an existing tree gets pinned, and a block is written
+	unlock := bs.PinLock()
+	if err := pinner.Pin(ctx, parent, true); err != nil {
+		t.Fatal(err)
+	}
+	unlock.Unlock()
+	written := newNode(t, bs, "written")
+
+	results, err := sw.sweep(ctx, gcs, []cid.Cid{child.Cid(), parent.Cid(), garbage.Cid(), written.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].KeyRemoved.Equals(garbage.Cid()) {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	for _, nd := range []*dag.ProtoNode{child, parent, written} {
+		if has, _ := bs.Has(nd.Cid()); !has {
+			t.Fatalf("block %s should be kept", nd.Cid())
+		}
+	}
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	bs, _, pinner := setup()
+
+	pinned := newNode(t, bs, "pinned")
+	oldest := newNode(t, bs, "oldest")
+	older := newNode(t, bs, "older")
+	recent := newNode(t, bs, "recent")
+	if err := pinner.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	alog := NewAccessLog(ds.NewMapDatastore())
+	bs.SetAccessLog(alog)
+	now := time.Now()
+	for i, nd := range []*dag.ProtoNode{recent, older, oldest, pinned} {
+		v := strconv.FormatInt(now.Add(-time.Duration(i)*time.Hour).Unix(), 10)
+		if err := alog.dstore.Put(dshelp.CidToDsKey(nd.Cid()), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toFree := uint64(len(oldest.RawData()) + len(older.RawData()))
+	var got []cid.Cid
+	for res := range Evict(ctx, bs, nil, pinner, nil, alog, toFree) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		got = append(got, res.KeyRemoved)
+	}
+	if len(got) != 2 || !got[0].Equals(oldest.Cid()) || !got[1].Equals(older.Cid()) {
+		t.Fatalf("unexpected evicted blocks: %v", got)
+	}
+	for _, nd := range []*dag.ProtoNode{pinned, recent} {
+		if has, _ := bs.Has(nd.Cid()); !has {
+			t.Fatalf("block %s should be kept", nd.Cid())
+		}
+	}
+
+	access, err := alog.LastAccess(oldest.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !access.IsZero() {
+		t.Fatal("access time of evicted block should be dropped")
+	}
+}
+
+func TestGCWithDiskMarkSet(t *testing.T) {
+	ctx := context.Background()
+	bs, _, pinner := setup()
+
+	// a chain of nodes, so that walking it relies on the mark set
+	var chain []*dag.ProtoNode
+	var prev *dag.ProtoNode
+	for i := 0; i < 50; i++ {
+		nd := dag.NodeWithData([]byte(strconv.Itoa(i)))
+		if prev != nil {
+			if err := nd.AddNodeLink("prev", prev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, nd)
+		prev = nd
+	}
+	if err := pinner.Pin(ctx, prev, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var garbage []cid.Cid
+	for i := 0; i < 50; i++ {
+		garbage = append(garbage, newNode(t, bs, "garbage"+strconv.Itoa(i)).Cid())
+	}
+
+	// a tiny Bloom filter, with many false positives
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	var marks *DiskMarkSet
+	newMarks := func() (MarkSet, error) {
+		var err error
+		marks, err = NewDiskMarkSet(dstore, 1)
+		return marks, err
+	}
+
+	removed := cid.NewSet()
+	for res := range GC(ctx, bs, nil, pinner, nil, WithMarkSet(newMarks)) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed.Add(res.KeyRemoved)
+	}
+	for _, nd := range chain {
+		if has, _ := bs.Has(nd.Cid()); !has {
+			t.Fatalf("pinned block %s was removed", nd.Cid())
+		}
+	}
+	for _, c := range removed.Keys() {
+		found := false
+		for _, g := range garbage {
+			found = found || g.Equals(c)
+		}
+		if !found {
+			t.Fatalf("unexpected removed block %s", c)
+		}
+	}
+	if removed.Len() != len(garbage) {
+		t.Fatalf("expected the %d garbage blocks to be removed, got %d", len(garbage), removed.Len())
+	}
+	if marks.Len() < len(chain) {
+		t.Fatalf("expected at least %d marks, got %d", len(chain), marks.Len())
+	}
+
+	res, err := dstore.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Fatalf("%d marks left in the datastore", len(left))
+	}
+}
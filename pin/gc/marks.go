@@ -0,0 +1,219 @@
+package gc
+
+import (
+	"io"
+
+	bloom "github.com/ipfs/bbloom"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+// MarkSet is the set of blocks a garbage collection marks as live. A
+// *cid.Set is a MarkSet kept in memory.
+type MarkSet interface {
+	// Add marks c
+	Add(c cid.Cid)
+
+	// Visit marks c, and returns whether it was not marked yet. It must be
+	// exact: a block wrongly reported as marked would not have its
+	// descendants marked.
+	Visit(c cid.Cid) bool
+
+	// Has returns whether c is marked. It may report unmarked blocks as
+	// marked, which only keeps them until a later collection, but never the
+	// opposite.
+	Has(c cid.Cid) bool
+
+	// Len returns the number of marked blocks
+	Len() int
+}
+
+var _ MarkSet = (*cid.Set)(nil)
+
+// Option configures a garbage collection
+type Option func(*options)
+
+type options struct {
+	newMarkSet func() (MarkSet, error)
+}
+
+// WithMarkSet makes the collection mark the live blocks in the set returned
+// by newSet, instead of an in-memory cid.Set. The set is closed once the
+// collection is done if it implements io.Closer.
+func WithMarkSet(newSet func() (MarkSet, error)) Option {
+	return func(o *options) {
+		o.newMarkSet = newSet
+	}
+}
+
+func processOptions(opts []Option) *options {
+	o := &options{
+		newMarkSet: func() (MarkSet, error) {
+			return cid.NewSet(), nil
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func closeMarkSet(gcs MarkSet) {
+	if c, ok := gcs.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Errorf("failed to remove the GC mark set: %s", err)
+		}
+	}
+}
+
+// diskMarkBatchSize is the number of marks written to the datastore at once
+const diskMarkBatchSize = 4096
+
+// bloomHashCount is the number of hashes of the Bloom filter of a
+// DiskMarkSet
+const bloomHashCount = 7
+
+// DiskMarkSet is a MarkSet stored in a datastore, for repos whose live
+// blocks do not fit in memory. A Bloom filter of bounded size saves the
+// datastore lookups of most unmarked blocks, and the datastore confirms the
+// others.
+//
+// Datastore errors never lose marks: the block is walked again while
+// marking, and kept while sweeping.
+type DiskMarkSet struct {
+	dstore  ds.Batching
+	filter  *bloom.Bloom
+	pending *cid.Set
+	count   int
+}
+
+// NewDiskMarkSet returns an empty mark set stored in the given datastore,
+// with a Bloom filter of bloomSize bytes. Marks left over by an interrupted
+// collection are removed.
+func NewDiskMarkSet(d ds.Batching, bloomSize uint64) (*DiskMarkSet, error) {
+	filter, err := bloom.New(float64(bloomSize*8), bloomHashCount)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DiskMarkSet{
+		dstore:  namespace.Wrap(d, ds.NewKey("/local/gcmarks")),
+		filter:  filter,
+		pending: cid.NewSet(),
+	}
+	if err := s.clear(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add implements MarkSet.Add
+func (s *DiskMarkSet) Add(c cid.Cid) {
+	s.Visit(c)
+}
+
+// Visit implements MarkSet.Visit
+func (s *DiskMarkSet) Visit(c cid.Cid) bool {
+	if s.filter.Has(c.Bytes()) {
+		if has, err := s.stored(c); err == nil && has {
+			return false
+		}
+	}
+
+	s.filter.Add(c.Bytes())
+	s.pending.Add(c)
+	s.count++
+	if s.pending.Len() >= diskMarkBatchSize {
+		if err := s.flush(); err != nil {
+			log.Errorf("failed to store GC marks: %s", err)
+		}
+	}
+	return true
+}
+
+// Has implements MarkSet.Has. Only the blocks the Bloom filter reports as
+// marked are looked up in the datastore.
+func (s *DiskMarkSet) Has(c cid.Cid) bool {
+	if !s.filter.Has(c.Bytes()) {
+		return false
+	}
+	has, err := s.stored(c)
+	return err != nil || has
+}
+
+// Len implements MarkSet.Len
+func (s *DiskMarkSet) Len() int {
+	return s.count
+}
+
+// Close removes the marks from the datastore
+func (s *DiskMarkSet) Close() error {
+	s.pending = cid.NewSet()
+	return s.clear()
+}
+
+// stored returns whether c was marked, looking it up in the datastore
+func (s *DiskMarkSet) stored(c cid.Cid) (bool, error) {
+	if s.pending.Has(c) {
+		return true, nil
+	}
+	has, err := s.dstore.Has(dshelp.CidToDsKey(c))
+	if err != nil {
+		log.Errorf("failed to look up GC mark of %s: %s", c, err)
+	}
+	return has, err
+}
+
+// flush writes the pending marks. On failure, they stay pending.
+func (s *DiskMarkSet) flush() error {
+	b, err := s.dstore.Batch()
+	if err != nil {
+		return err
+	}
+	err = s.pending.ForEach(func(c cid.Cid) error {
+		return b.Put(dshelp.CidToDsKey(c), []byte{})
+	})
+	if err != nil {
+		return err
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+	s.pending = cid.NewSet()
+	return nil
+}
+
+func (s *DiskMarkSet) clear() error {
+	res, err := s.dstore.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	b, err := s.dstore.Batch()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		if err := b.Delete(ds.RawKey(r.Key)); err != nil {
+			return err
+		}
+		n++
+		if n%diskMarkBatchSize == 0 {
+			if err := b.Commit(); err != nil {
+				return err
+			}
+			if b, err = s.dstore.Batch(); err != nil {
+				return err
+			}
+		}
+	}
+	return b.Commit()
+}
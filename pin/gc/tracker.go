@@ -0,0 +1,127 @@
+package gc
+
+import (
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// TrackingBlockstore is a GCBlockstore which keeps track, while a garbage
+// collection runs, of the blocks written to it and of the pin locks taken.
+// This lets GC mark the live blocks without holding the GCLock: the blocks
+// written in the meantime are kept, and the pins are looked at again
+// whenever they may have changed.
+//
+// It also records the block accesses in an AccessLog, when one is set.
+type TrackingBlockstore struct {
+	bstore.GCBlockstore
+
+	lock      sync.Mutex
+	trackers  int
+	written   *cid.Set
+	pinGen    uint64
+	accessLog *AccessLog
+}
+
+var _ bstore.GCBlockstore = (*TrackingBlockstore)(nil)
+
+// NewTrackingBlockstore wraps the given blockstore. It must be used for all
+// the writes to the blockstore, and to take the pin locks.
+func NewTrackingBlockstore(bs bstore.GCBlockstore) *TrackingBlockstore {
+	return &TrackingBlockstore{GCBlockstore: bs}
+}
+
+// SetAccessLog starts recording block accesses in the given log
+func (bs *TrackingBlockstore) SetAccessLog(l *AccessLog) {
+	bs.lock.Lock()
+	bs.accessLog = l
+	bs.lock.Unlock()
+}
+
+// AccessLog returns the log block accesses are recorded in, if any
+func (bs *TrackingBlockstore) AccessLog() *AccessLog {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	return bs.accessLog
+}
+
+// Get implements Blockstore.Get
+func (bs *TrackingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := bs.GCBlockstore.Get(c)
+	if err == nil {
+		if l := bs.AccessLog(); l != nil {
+			l.Touch(c)
+		}
+	}
+	return b, err
+}
+
+// Put implements Blockstore.Put
+func (bs *TrackingBlockstore) Put(b blocks.Block) error {
+	bs.track(b.Cid())
+	return bs.GCBlockstore.Put(b)
+}
+
+// PutMany implements Blockstore.PutMany
+func (bs *TrackingBlockstore) PutMany(bls []blocks.Block) error {
+	for _, b := range bls {
+		bs.track(b.Cid())
+	}
+	return bs.GCBlockstore.PutMany(bls)
+}
+
+// PinLock implements GCLocker.PinLock
+func (bs *TrackingBlockstore) PinLock() bstore.Unlocker {
+	bs.lock.Lock()
+	bs.pinGen++
+	bs.lock.Unlock()
+	return bs.GCBlockstore.PinLock()
+}
+
+// track records a block that is about to be written. It is recorded before
+// the write so that GC never sees the block without knowing it is new.
+func (bs *TrackingBlockstore) track(c cid.Cid) {
+	bs.lock.Lock()
+	if bs.trackers > 0 {
+		bs.written.Add(c)
+	}
+	l := bs.accessLog
+	bs.lock.Unlock()
+
+	if l != nil {
+		l.Touch(c)
+	}
+}
+
+func (bs *TrackingBlockstore) startTracking() {
+	bs.lock.Lock()
+	if bs.trackers == 0 {
+		bs.written = cid.NewSet()
+	}
+	bs.trackers++
+	bs.lock.Unlock()
+}
+
+func (bs *TrackingBlockstore) stopTracking() {
+	bs.lock.Lock()
+	bs.trackers--
+	if bs.trackers == 0 {
+		bs.written = nil
+	}
+	bs.lock.Unlock()
+}
+
+func (bs *TrackingBlockstore) wasWritten(c cid.Cid) bool {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	return bs.written != nil && bs.written.Has(c)
+}
+
+// pinGeneration changes every time a pin lock is taken
+func (bs *TrackingBlockstore) pinGeneration() uint64 {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	return bs.pinGen
+}
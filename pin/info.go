@@ -0,0 +1,257 @@
+package pin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+// pinInfoDatastorePrefix is the datastore namespace under which the
+// labels of direct and recursive pins are stored, one key per pin.
+var pinInfoDatastorePrefix = ds.NewKey("/local/pininfo")
+
+// Info is the optional, user supplied label of a direct or recursive pin.
+// It allows to tell why some content is pinned, and by whom, and for how
+// long it should stay pinned.
+type Info struct {
+	Name string            `json:",omitempty"`
+	Meta map[string]string `json:",omitempty"`
+
+	// Expires is the time after which the pin is dropped. The zero value
+	// means the pin never expires, and is left out of the JSON encoding.
+	Expires time.Time
+}
+
+// MarshalJSON leaves out the expiry of the pins which never expire
+func (i Info) MarshalJSON() ([]byte, error) {
+	type plainInfo Info
+	out := struct {
+		plainInfo
+		Expires *time.Time `json:",omitempty"`
+	}{plainInfo: plainInfo(i)}
+	if !i.Expires.IsZero() {
+		out.Expires = &i.Expires
+	}
+	return json.Marshal(out)
+}
+
+// IsEmpty returns whether the Info carries neither a name, metadata nor an
+// expiry.
+func (i Info) IsEmpty() bool {
+	return i.Name == "" && len(i.Meta) == 0 && i.Expires.IsZero()
+}
+
+// Expired returns whether the pin has an expiry which passed at the given
+// time.
+func (i Info) Expired(now time.Time) bool {
+	return !i.Expires.IsZero() && !now.Before(i.Expires)
+}
+
+// Merge returns the label of a pin added again with the given label. The name
+// and metadata given replace the existing ones. The expiry is kept, as it is
+// set when pinning, see repinExpiry.
+func (i Info) Merge(info Info) Info {
+	merged := i
+	if info.Name != "" {
+		merged.Name = info.Name
+	}
+	if len(info.Meta) > 0 {
+		merged.Meta = info.Meta
+	}
+	return merged
+}
+
+// repinExpiry returns the expiry of a pin added with the given expiry, when
+// it was pinned already with the current one. Pinning again without an expiry
+// makes the pin permanent, while a permanent pin stays permanent, so that the
+// garbage collector does not drop content meant to stay: it must be unpinned
+// first to be made to expire.
+func repinExpiry(pinned bool, current, expires time.Time) time.Time {
+	if pinned && current.IsZero() {
+		return time.Time{}
+	}
+	return expires
+}
+
+// HasNamePrefix returns whether the name of the pin starts with the given
+// prefix. An empty prefix matches every pin, named or not.
+func (i Info) HasNamePrefix(prefix string) bool {
+	return strings.HasPrefix(i.Name, prefix)
+}
+
+// ParseMeta parses metadata given as a comma separated list of key=value
+// pairs, as accepted on the command line.
+func ParseMeta(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	meta := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid pin metadata %q, must be of the form key=value", kv)
+		}
+		meta[parts[0]] = parts[1]
+	}
+	return meta, nil
+}
+
+// FormatMeta is the inverse of ParseMeta. Keys are sorted so the output is
+// stable.
+func FormatMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + meta[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func pinInfoKey(c cid.Cid) ds.Key {
+	return pinInfoDatastorePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// loadInfo reads all the pin labels stored in the given datastore.
+func loadInfo(d ds.Datastore) (map[cid.Cid]Info, error) {
+	res, err := d.Query(dsq.Query{Prefix: pinInfoDatastorePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	infos := make(map[cid.Cid]Info)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+
+		c, err := dshelp.DsKeyToCid(ds.NewKey(ds.RawKey(r.Key).BaseNamespace()))
+		if err != nil {
+			log.Errorf("invalid pin info key %s: %s", r.Key, err)
+			continue
+		}
+
+		var info Info
+		if err := json.Unmarshal(r.Value, &info); err != nil {
+			log.Errorf("invalid pin info for %s: %s", c, err)
+			continue
+		}
+		infos[c] = info
+	}
+	return infos, nil
+}
+
+// storeInfo persists the labels of the given cids. Cids without a label
+// get their stored label removed.
+func storeInfo(d ds.Datastore, infos map[cid.Cid]Info, cids []cid.Cid) error {
+	for _, c := range cids {
+		info, ok := infos[c]
+		if !ok {
+			err := d.Delete(pinInfoKey(c))
+			if err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			continue
+		}
+
+		b, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := d.Put(pinInfoKey(c), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddInfo merges the label given to a pin added again into its current
+// label, see Info.Merge. It returns whether the label changed, in which case
+// the pinner must be flushed.
+func AddInfo(p Pinner, c cid.Cid, info Info) (bool, error) {
+	old, ok := p.PinInfo(c)
+	if !ok && info.IsEmpty() {
+		return false, nil
+	}
+	if err := p.SetPinInfo(c, old.Merge(info)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExpiredSet returns the set of the pins whose expiry passed at the given
+// time. When the pinner fails to list them, the set is empty, so that no pin
+// is treated as expired.
+func ExpiredSet(p Pinner, now time.Time) *cid.Set {
+	set := cid.NewSet()
+	expired, err := p.ExpiredKeys(now)
+	if err != nil {
+		log.Errorf("failed to list expired pins: %s", err)
+		return set
+	}
+	for _, c := range expired {
+		set.Add(c)
+	}
+	return set
+}
+
+// FilterExpired returns the given keys minus the ones whose pin expired at
+// the given time. Expired pins no longer protect their content from the
+// garbage collector, even before they get removed from the pinner.
+func FilterExpired(p Pinner, keys []cid.Cid, now time.Time) []cid.Cid {
+	expired := ExpiredSet(p, now)
+	if expired.Len() == 0 {
+		return keys
+	}
+
+	out := make([]cid.Cid, 0, len(keys))
+	for _, c := range keys {
+		if !expired.Has(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// RemoveExpired removes the direct and recursive pins whose expiry passed at
+// the given time, and flushes the pinner if any was removed. Callers should
+// hold the blockstore PinLock.
+func RemoveExpired(p Pinner, now time.Time) ([]cid.Cid, error) {
+	expired, err := p.ExpiredKeys(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []cid.Cid
+	for _, c := range expired {
+		for _, mode := range []Mode{Recursive, Direct} {
+			_, pinned, err := p.IsPinnedWithType(c, mode)
+			if err != nil {
+				return removed, err
+			}
+			if pinned {
+				p.RemovePinWithMode(c, mode)
+				removed = append(removed, c)
+				break
+			}
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, p.Flush()
+}
@@ -0,0 +1,423 @@
+// Package jobs implements background pinning. Pin jobs are queued in the
+// datastore and processed by a small set of workers, so that fetching large
+// DAGs neither blocks the client nor loses track of what is left to pin when
+// the node restarts.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	query "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+var log = logging.Logger("pin/jobs")
+
+// State is the state of a pin job
+type State string
+
+// Job states
+const (
+	Queued   State = "queued"
+	Running  State = "running"
+	Done     State = "done"
+	Failed   State = "failed"
+	Canceled State = "canceled"
+)
+
+// Finished returns whether a job in this state will not be processed
+// anymore.
+func (s State) Finished() bool {
+	return s == Done || s == Failed || s == Canceled
+}
+
+// retention is how long finished jobs are remembered
+const retention = 24 * time.Hour
+
+// pruneInterval is how often the finished jobs past their retention are
+// removed
+const pruneInterval = time.Hour
+
+// nextIDKey stores the ID of the next job, so that the IDs of pruned jobs are
+// not reused
+var nextIDKey = datastore.NewKey("/next-id")
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("no such pin job")
+
+// PinFunc pins the given cid, fetching its DAG if needed. The given context
+// carries a merkledag.ProgressTracker. A non-zero expireIn is counted from
+// when the pin is made, once the DAG is fetched.
+type PinFunc func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error
+
+// Job is a request to pin some content in the background
+type Job struct {
+	ID        string
+	Cid       cid.Cid
+	Recursive bool
+	ExpireIn  time.Duration `json:",omitempty"`
+	Info      pin.Info
+	State     State
+	Err       string `json:",omitempty"`
+	Created   time.Time
+	Updated   time.Time
+
+	// Progress is the number of nodes fetched so far. It is only tracked
+	// while the job is running.
+	Progress int `json:"-"`
+}
+
+type running struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	canceled bool
+	progress *dag.ProgressTracker
+}
+
+// Manager queues and runs pin jobs
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ds     datastore.Datastore
+	pin    PinFunc
+
+	lock    sync.Mutex
+	jobs    map[string]*Job
+	pending []string
+	running map[string]*running
+	nextID  uint64
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewManager loads the pin jobs stored in the datastore and starts the given
+// number of workers. Jobs which were queued or running when the node stopped
+// are resumed.
+func NewManager(ctx context.Context, ds datastore.Datastore, pinFn PinFunc, workers int) (*Manager, error) {
+	cctx, cancel := context.WithCancel(ctx)
+	m := &Manager{
+		ctx:     cctx,
+		cancel:  cancel,
+		ds:      namespace.Wrap(ds, datastore.NewKey("/pinjobs")),
+		pin:     pinFn,
+		jobs:    make(map[string]*Job),
+		running: make(map[string]*running),
+		nextID:  1,
+		wake:    make(chan struct{}, 1),
+	}
+
+	if err := m.load(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	m.wg.Add(1)
+	go m.pruner()
+	return m, nil
+}
+
+// Close stops the workers. Running jobs are interrupted and resumed on the
+// next start.
+func (m *Manager) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
+
+// Add queues a new pin job. A non-zero expireIn makes the pin expire that long
+// after the job made it.
+func (m *Manager) Add(c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) (Job, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	id := m.nextID
+	if err := m.ds.Put(nextIDKey, []byte(strconv.FormatUint(id+1, 10))); err != nil {
+		return Job{}, err
+	}
+	m.nextID++
+
+	now := time.Now()
+	j := &Job{
+		ID:        strconv.FormatUint(id, 10),
+		Cid:       c,
+		Recursive: recursive,
+		ExpireIn:  expireIn,
+		Info:      info,
+		State:     Queued,
+		Created:   now,
+		Updated:   now,
+	}
+	if err := m.store(j); err != nil {
+		return Job{}, err
+	}
+
+	m.jobs[j.ID] = j
+	m.pending = append(m.pending, j.ID)
+	m.notify()
+	return *j, nil
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return m.snapshot(j), nil
+}
+
+// List returns all known jobs, oldest first
+func (m *Manager) List() []Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	out := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		out = append(out, m.snapshot(j))
+	}
+	sortJobs(out)
+	return out
+}
+
+// Cancel stops a queued or running job
+func (m *Manager) Cancel(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if j.State.Finished() {
+		return fmt.Errorf("pin job %s already %s", id, j.State)
+	}
+
+	if r, ok := m.running[id]; ok {
+		// the worker records the cancellation
+		r.canceled = true
+		r.cancel()
+		return nil
+	}
+
+	for i, pid := range m.pending {
+		if pid == id {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			break
+		}
+	}
+	return m.finish(j, Canceled, nil)
+}
+
+func (m *Manager) snapshot(j *Job) Job {
+	out := *j
+	if r, ok := m.running[j.ID]; ok {
+		out.Progress = r.progress.Value()
+	}
+	return out
+}
+
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		j, r := m.next()
+		if j == nil {
+			select {
+			case <-m.wake:
+				continue
+			case <-m.ctx.Done():
+				return
+			}
+		}
+
+		// wake another worker in case more jobs are pending
+		m.notify()
+
+		err := m.pin(r.ctx, j.Cid, j.Recursive, j.ExpireIn, j.Info)
+
+		m.lock.Lock()
+		r.cancel()
+		delete(m.running, j.ID)
+		switch {
+		case r.canceled:
+			m.logErr(m.finish(j, Canceled, nil))
+		case m.ctx.Err() != nil:
+			// shutting down, the job is resumed on the next start
+		case err == nil:
+			m.logErr(m.finish(j, Done, nil))
+		default:
+			m.logErr(m.finish(j, Failed, err))
+		}
+		m.lock.Unlock()
+	}
+}
+
+func (m *Manager) pruner() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.lock.Lock()
+			err := m.prune(now)
+			m.lock.Unlock()
+			if err != nil {
+				log.Errorf("failed to prune pin jobs: %s", err)
+			}
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// prune forgets the jobs which finished more than retention ago
+func (m *Manager) prune(now time.Time) error {
+	for id, j := range m.jobs {
+		if !j.State.Finished() || now.Sub(j.Updated) <= retention {
+			continue
+		}
+		if err := m.ds.Delete(datastore.NewKey(id)); err != nil {
+			return err
+		}
+		delete(m.jobs, id)
+	}
+	return nil
+}
+
+// next pops the next pending job and marks it as running
+func (m *Manager) next() (*Job, *running) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.pending) == 0 || m.ctx.Err() != nil {
+		return nil, nil
+	}
+	id := m.pending[0]
+	m.pending = m.pending[1:]
+
+	j := m.jobs[id]
+	j.State = Running
+	j.Updated = time.Now()
+	m.logErr(m.store(j))
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	r := &running{
+		cancel:   cancel,
+		progress: new(dag.ProgressTracker),
+	}
+	r.ctx = r.progress.DeriveContext(ctx)
+	m.running[id] = r
+	return j, r
+}
+
+func (m *Manager) finish(j *Job, s State, err error) error {
+	j.State = s
+	j.Updated = time.Now()
+	if err != nil {
+		j.Err = err.Error()
+	}
+	return m.store(j)
+}
+
+func (m *Manager) logErr(err error) {
+	if err != nil {
+		log.Errorf("failed to store pin job: %s", err)
+	}
+}
+
+func (m *Manager) store(j *Job) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return m.ds.Put(datastore.NewKey(j.ID), b)
+}
+
+func (m *Manager) load() error {
+	res, err := m.ds.Query(query.Query{})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	var jobs []Job
+	for _, e := range entries {
+		if e.Key == nextIDKey.String() {
+			id, err := strconv.ParseUint(string(e.Value), 10, 64)
+			if err != nil {
+				log.Errorf("invalid next pin job ID %q: %s", e.Value, err)
+			} else if id > m.nextID {
+				m.nextID = id
+			}
+			continue
+		}
+
+		var j Job
+		if err := json.Unmarshal(e.Value, &j); err != nil {
+			log.Errorf("invalid pin job %s: %s", e.Key, err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sortJobs(jobs)
+
+	for i := range jobs {
+		j := &jobs[i]
+		if id, err := strconv.ParseUint(j.ID, 10, 64); err == nil && id >= m.nextID {
+			m.nextID = id + 1
+		}
+
+		if !j.State.Finished() {
+			j.State = Queued
+			m.pending = append(m.pending, j.ID)
+		}
+		m.jobs[j.ID] = j
+	}
+	if err := m.prune(time.Now()); err != nil {
+		return err
+	}
+
+	if len(m.pending) > 0 {
+		log.Infof("resuming %d pin jobs", len(m.pending))
+	}
+	return nil
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, k int) bool {
+		a, _ := strconv.ParseUint(jobs[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(jobs[k].ID, 10, 64)
+		return a < b
+	})
+}
@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func testCid(s string) cid.Cid {
+	return cid.NewCidV0(u.Hash([]byte(s)))
+}
+
+func waitState(t *testing.T, m *Manager, id string, s State) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.State == s {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach state %s", id, s)
+	return Job{}
+}
+
+func TestJobDone(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	pinned := make(chan cid.Cid, 1)
+	pinFn := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		if expireIn != time.Hour {
+			t.Errorf("expected the expiry to be counted from the pin, got %s", expireIn)
+		}
+		pinned <- c
+		return nil
+	}
+
+	m, err := NewManager(context.Background(), dstore, pinFn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	c := testCid("a")
+	j, err := m.Add(c, true, time.Hour, pin.Info{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-pinned; !got.Equals(c) {
+		t.Fatalf("pinned %s, expected %s", got, c)
+	}
+	j = waitState(t, m, j.ID, Done)
+	if j.Info.Name != "a" {
+		t.Fatal("job should keep the pin label")
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	started := make(chan struct{}, 1)
+	pinFn := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	m, err := NewManager(context.Background(), dstore, pinFn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	running, err := m.Add(testCid("a"), true, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// the only worker is busy, so this one stays queued
+	queued, err := m.Add(testCid("b"), true, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Cancel(queued.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, queued.ID, Canceled)
+
+	if err := m.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, running.ID, Canceled)
+
+	if err := m.Cancel(running.ID); err == nil {
+		t.Fatal("canceling a finished job should fail")
+	}
+	if err := m.Cancel("42"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestJobResume(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	started := make(chan struct{}, 1)
+	blocking := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	m, err := NewManager(context.Background(), dstore, blocking, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := m.Add(testCid("a"), false, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := make(chan cid.Cid, 1)
+	pinFn := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		pinned <- c
+		return nil
+	}
+	m, err = NewManager(context.Background(), dstore, pinFn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	<-pinned
+	waitState(t, m, j.ID, Done)
+
+	// new jobs must not reuse the IDs of stored ones
+	nj, err := m.Add(testCid("b"), false, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nj.ID == j.ID {
+		t.Fatal("job ID reused after restart")
+	}
+}
+
+func TestJobPrune(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	pinFn := func(ctx context.Context, c cid.Cid, recursive bool, expireIn time.Duration, info pin.Info) error {
+		return nil
+	}
+
+	m, err := NewManager(context.Background(), dstore, pinFn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := m.Add(testCid("a"), false, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j = waitState(t, m, j.ID, Done)
+
+	m.lock.Lock()
+	err = m.prune(j.Updated.Add(retention + time.Second))
+	m.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(j.ID); err != ErrNotFound {
+		t.Fatalf("expected the finished job to be pruned, got %v", err)
+	}
+
+	// the ID of a pruned job is not reused, even after a restart
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewManager(context.Background(), dstore, pinFn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	nj, err := m.Add(testCid("b"), false, 0, pin.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nj.ID == j.ID {
+		t.Fatal("job ID of a pruned job reused")
+	}
+}
@@ -0,0 +1,445 @@
+package pin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// pinNamespacePrefix is the datastore namespace under which the holders of
+// namespaced pins are stored, as /<cid>/<namespace> keys whose value is the
+// pin mode, followed by the expiry of the pin if it has one.
+var pinNamespacePrefix = ds.NewKey("/local/pinns")
+
+// DefaultNamespace holds the pins made without a namespace
+const DefaultNamespace = "default"
+
+// Namespaces scopes pins to namespaces, so that applications sharing a node
+// cannot unpin each other's content. The Pinner holds the union of the pins
+// of all the namespaces: content stays pinned as long as one namespace holds
+// it, recursively if one of them holds it recursively, and its pin expires
+// with the last expiring pin of the namespaces.
+//
+// The pin of a namespace which expired no longer counts as held. The Pinner
+// catches up the next time the content is pinned or unpinned in a namespace.
+//
+// Pins which were never made in a namespace other than the default one are
+// not recorded, so that the Pinner alone keeps working for them. Content
+// pinned with the Pinner directly must be recorded with RecordPin.
+//
+// Callers must hold the PinLock, and Flush the Pinner afterwards.
+type Namespaces struct {
+	dstore ds.Datastore
+	pinner Pinner
+}
+
+// NewNamespaces returns the pin namespaces stored in the given datastore
+func NewNamespaces(d ds.Datastore, p Pinner) *Namespaces {
+	return &Namespaces{dstore: d, pinner: p}
+}
+
+// Holder is the pin a namespace holds on some content
+type Holder struct {
+	Mode Mode
+
+	// Expires is when the pin of the namespace expires, zero if it does not
+	Expires time.Time
+}
+
+func (h Holder) expired(now time.Time) bool {
+	return !h.Expires.IsZero() && !h.Expires.After(now)
+}
+
+// ValidateNamespace checks that the namespace name can be stored
+func ValidateNamespace(ns string) error {
+	if ns == "" || strings.Contains(ns, "/") {
+		return fmt.Errorf("invalid pin namespace %q", ns)
+	}
+	return nil
+}
+
+// Pin pins the node in the given namespace, until the given expiry unless it
+// is zero
+func (n *Namespaces) Pin(ctx context.Context, ns string, node ipld.Node, recursive bool, expires time.Time) error {
+	if err := ValidateNamespace(ns); err != nil {
+		return err
+	}
+
+	c := node.Cid()
+	holders, err := n.Holders(c)
+	if err != nil {
+		return err
+	}
+	if ns == DefaultNamespace && len(holders) == 0 {
+		_, pinned := n.pinnedMode(c)
+		info, _ := n.pinner.PinInfo(c)
+		if err := n.pinner.Pin(ctx, node, recursive); err != nil {
+			return err
+		}
+		return n.setExpiry(c, repinExpiry(pinned, info.Expires, expires))
+	}
+
+	mode := Direct
+	if recursive {
+		mode = Recursive
+	}
+	if holders[ns].Mode == Recursive && mode == Direct {
+		return fmt.Errorf("%s already pinned recursively in namespace %s", c, ns)
+	}
+
+	if len(holders) == 0 {
+		// the existing pin, if any, was made without a namespace
+		if cur, ok := n.pinnedMode(c); ok {
+			info, _ := n.pinner.PinInfo(c)
+			h := Holder{Mode: cur, Expires: info.Expires}
+			holders[DefaultNamespace] = h
+			if err := n.put(c, DefaultNamespace, h); err != nil {
+				return err
+			}
+		}
+	}
+	cur, pinned := holders[ns]
+	h := Holder{Mode: mode, Expires: repinExpiry(pinned, cur.Expires, expires)}
+	holders[ns] = h
+
+	if want := unionMode(holders); want == Recursive {
+		err = n.pinner.Pin(ctx, node, true)
+	} else if _, ok := n.pinnedMode(c); !ok {
+		err = n.pinner.Pin(ctx, node, false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := n.put(c, ns, h); err != nil {
+		return err
+	}
+	return n.sync(c, holders)
+}
+
+// RecordPin records a pin made with the Pinner directly, such as the root of
+// added files, as held by the default namespace, so that the content stays
+// pinned when the other namespaces holding it unpin it. The pin does not
+// expire. It does nothing for content no namespace holds.
+func (n *Namespaces) RecordPin(c cid.Cid, mode Mode) error {
+	holders, err := n.Holders(c)
+	if err != nil || len(holders) == 0 {
+		return err
+	}
+
+	h := Holder{Mode: mode}
+	if holders[DefaultNamespace].Mode == Recursive {
+		h.Mode = Recursive
+	}
+	holders[DefaultNamespace] = h
+	if err := n.put(c, DefaultNamespace, h); err != nil {
+		return err
+	}
+	return n.sync(c, holders)
+}
+
+// Unpin removes the pin the given namespace holds on c. The content is only
+// unpinned once no namespace holds it anymore.
+func (n *Namespaces) Unpin(ctx context.Context, ns string, c cid.Cid, recursive bool) error {
+	if err := ValidateNamespace(ns); err != nil {
+		return err
+	}
+
+	holders, err := n.Holders(c)
+	if err != nil {
+		return err
+	}
+	if len(holders) == 0 {
+		if ns == DefaultNamespace {
+			return n.pinner.Unpin(ctx, c, recursive)
+		}
+		return fmt.Errorf("%s is not pinned in namespace %s", c, ns)
+	}
+
+	h, ok := holders[ns]
+	if !ok {
+		if ns == DefaultNamespace {
+			return fmt.Errorf("%s is pinned in namespaces %s, use --namespace", c, strings.Join(holderNames(holders), ", "))
+		}
+		return fmt.Errorf("%s is not pinned in namespace %s", c, ns)
+	}
+	if h.Mode == Recursive && !recursive {
+		return fmt.Errorf("%s is pinned recursively in namespace %s", c, ns)
+	}
+
+	delete(holders, ns)
+	if err := n.delete(c, ns); err != nil {
+		return err
+	}
+
+	if len(holders) == 0 {
+		return n.pinner.Unpin(ctx, c, true)
+	}
+	return n.sync(c, holders)
+}
+
+// Update pins to recursively in the given namespace, with the name and
+// metadata of the recursive pin the namespace holds on from, and removes that
+// pin if unpin is set.
+func (n *Namespaces) Update(ctx context.Context, ns string, from cid.Cid, to ipld.Node, unpin bool) error {
+	holders, err := n.Holders(from)
+	if err != nil {
+		return err
+	}
+	info, _ := n.pinner.PinInfo(from)
+
+	h, ok := holders[ns]
+	if len(holders) == 0 && ns == DefaultNamespace {
+		// a pin made without a namespace
+		h.Mode, ok = n.pinnedMode(from)
+		h.Expires = info.Expires
+	}
+	if !ok || h.Mode != Recursive {
+		return fmt.Errorf("%s is not pinned recursively in namespace %s", from, ns)
+	}
+
+	if err := n.Pin(ctx, ns, to, true, h.Expires); err != nil {
+		return err
+	}
+	if info.Name != "" || len(info.Meta) > 0 {
+		cur, _ := n.pinner.PinInfo(to.Cid())
+		cur.Name, cur.Meta = info.Name, info.Meta
+		if err := n.pinner.SetPinInfo(to.Cid(), cur); err != nil {
+			return err
+		}
+	}
+
+	if !unpin {
+		return nil
+	}
+	return n.Unpin(ctx, ns, from, true)
+}
+
+// sync makes the Pinner pin c as the remaining holders need
+func (n *Namespaces) sync(c cid.Cid, holders map[string]Holder) error {
+	if cur, _ := n.pinnedMode(c); cur == Recursive && unionMode(holders) == Direct {
+		info, _ := n.pinner.PinInfo(c)
+		n.pinner.RemovePinWithMode(c, Recursive)
+		n.pinner.PinWithMode(c, Direct)
+		if !info.IsEmpty() {
+			if err := n.pinner.SetPinInfo(c, info); err != nil {
+				return err
+			}
+		}
+	}
+	if err := n.setExpiry(c, unionExpiry(holders)); err != nil {
+		return err
+	}
+
+	if _, ok := holders[DefaultNamespace]; ok && len(holders) == 1 {
+		// back to a plain pin
+		return n.delete(c, DefaultNamespace)
+	}
+	return nil
+}
+
+// setExpiry makes the pin on c expire at the given time, keeping its label
+func (n *Namespaces) setExpiry(c cid.Cid, expires time.Time) error {
+	info, _ := n.pinner.PinInfo(c)
+	if info.Expires.Equal(expires) {
+		return nil
+	}
+	info.Expires = expires
+	return n.pinner.SetPinInfo(c, info)
+}
+
+// Holders returns the namespaces holding a pin on c, with their pin. It is
+// empty for content which is not pinned, or only pinned without a namespace.
+func (n *Namespaces) Holders(c cid.Cid) (map[string]Holder, error) {
+	prefix := pinNamespacePrefix.Child(dshelp.CidToDsKey(c))
+	res, err := n.dstore.Query(dsq.Query{Prefix: prefix.String() + "/"})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	holders := make(map[string]Holder, len(entries))
+	for _, e := range entries {
+		h, err := parseHolder(e)
+		if err != nil {
+			return nil, err
+		}
+		ns := ds.RawKey(e.Key).BaseNamespace()
+		if h.expired(now) {
+			if err := n.delete(c, ns); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		holders[ns] = h
+	}
+
+	if len(holders) > 0 {
+		if _, ok := n.pinnedMode(c); !ok {
+			// the pin was removed behind our back, e.g. because it expired
+			for ns := range holders {
+				if err := n.delete(c, ns); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]Holder{}, nil
+		}
+	}
+	return holders, nil
+}
+
+// Ls returns the pins held by the given namespace
+func (n *Namespaces) Ls(ns string) (map[cid.Cid]Mode, error) {
+	if err := ValidateNamespace(ns); err != nil {
+		return nil, err
+	}
+
+	res, err := n.dstore.Query(dsq.Query{Prefix: pinNamespacePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	recorded := make(map[cid.Cid]map[string]Holder)
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		c, err := dshelp.DsKeyToCid(ds.NewKey(k.Parent().BaseNamespace()))
+		if err != nil {
+			return nil, err
+		}
+		h, err := parseHolder(e)
+		if err != nil {
+			return nil, err
+		}
+		if recorded[c] == nil {
+			recorded[c] = make(map[string]Holder)
+		}
+		recorded[c][k.BaseNamespace()] = h
+	}
+
+	out := make(map[cid.Cid]Mode)
+	for c, holders := range recorded {
+		if h, ok := holders[ns]; ok && !h.expired(now) {
+			if _, pinned := n.pinnedMode(c); pinned {
+				out[c] = h.Mode
+			}
+		}
+	}
+
+	if ns == DefaultNamespace {
+		// plus all the pins made without a namespace
+		for _, c := range n.pinner.RecursiveKeys() {
+			if recorded[c] == nil {
+				out[c] = Recursive
+			}
+		}
+		for _, c := range n.pinner.DirectKeys() {
+			if recorded[c] == nil {
+				out[c] = Direct
+			}
+		}
+	}
+	return out, nil
+}
+
+// pinnedMode returns how the Pinner pins c, if it does
+func (n *Namespaces) pinnedMode(c cid.Cid) (Mode, bool) {
+	if _, ok, _ := n.pinner.IsPinnedWithType(c, Recursive); ok {
+		return Recursive, true
+	}
+	if _, ok, _ := n.pinner.IsPinnedWithType(c, Direct); ok {
+		return Direct, true
+	}
+	return NotPinned, false
+}
+
+func (n *Namespaces) key(c cid.Cid, ns string) ds.Key {
+	return pinNamespacePrefix.Child(dshelp.CidToDsKey(c)).ChildString(ns)
+}
+
+func (n *Namespaces) put(c cid.Cid, ns string, h Holder) error {
+	s, _ := ModeToString(h.Mode)
+	if !h.Expires.IsZero() {
+		s += " " + h.Expires.UTC().Format(time.RFC3339Nano)
+	}
+	return n.dstore.Put(n.key(c, ns), []byte(s))
+}
+
+// parseHolder parses a namespace record
+func parseHolder(e dsq.Entry) (Holder, error) {
+	fields := strings.Fields(string(e.Value))
+	if len(fields) == 0 || len(fields) > 2 {
+		return Holder{}, fmt.Errorf("invalid namespace record %s: %q", e.Key, e.Value)
+	}
+
+	var h Holder
+	var ok bool
+	if h.Mode, ok = StringToMode(fields[0]); !ok {
+		return Holder{}, fmt.Errorf("invalid pin mode %q in namespace record %s", fields[0], e.Key)
+	}
+	if len(fields) == 2 {
+		var err error
+		if h.Expires, err = time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+			return Holder{}, fmt.Errorf("invalid expiry in namespace record %s: %s", e.Key, err)
+		}
+	}
+	return h, nil
+}
+
+func (n *Namespaces) delete(c cid.Cid, ns string) error {
+	err := n.dstore.Delete(n.key(c, ns))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// unionMode returns the mode the Pinner must pin with to satisfy all the
+// holders
+func unionMode(holders map[string]Holder) Mode {
+	for _, h := range holders {
+		if h.Mode == Recursive {
+			return Recursive
+		}
+	}
+	return Direct
+}
+
+// unionExpiry returns when the last of the holders' pins expires, or the
+// zero time if one of them does not expire
+func unionExpiry(holders map[string]Holder) time.Time {
+	var last time.Time
+	for _, h := range holders {
+		if h.Expires.IsZero() {
+			return time.Time{}
+		}
+		if h.Expires.After(last) {
+			last = h.Expires
+		}
+	}
+	return last
+}
+
+func holderNames(holders map[string]Holder) []string {
+	names := make([]string, 0, len(holders))
+	for ns := range holders {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names
+}
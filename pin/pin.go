@@ -146,9 +146,36 @@ type Pinner interface {
 	// DirectKeys returns all recursively pinned cids
 	RecursiveKeys() []cid.Cid
 
+	// DirectKeysChan streams the directly pinned cids. The listing stops
+	// when ctx is done, or after sending the error which interrupted it.
+	DirectKeysChan(ctx context.Context) <-chan StreamedCid
+
+	// RecursiveKeysChan streams the recursively pinned cids, like
+	// DirectKeysChan.
+	RecursiveKeysChan(ctx context.Context) <-chan StreamedCid
+
 	// InternalPins returns all cids kept pinned for the internal state of the
 	// pinner
 	InternalPins() []cid.Cid
+
+	// PinInfo returns the label attached to a direct or recursive pin, and
+	// whether there is one.
+	PinInfo(cid.Cid) (Info, bool)
+
+	// SetPinInfo attaches a label to a direct or recursive pin, replacing any
+	// previous one. An empty Info removes the label.
+	SetPinInfo(cid.Cid, Info) error
+
+	// ExpiredKeys returns the direct and recursive pins whose expiry passed
+	// at the given time.
+	ExpiredKeys(now time.Time) ([]cid.Cid, error)
+}
+
+// StreamedCid is a cid sent by the KeysChan methods of a Pinner, or the error
+// which interrupted the listing.
+type StreamedCid struct {
+	C   cid.Cid
+	Err error
 }
 
 // Pinned represents CID which has been pinned with a pinning strategy.
@@ -191,6 +218,11 @@ type pinner struct {
 	dserv       ipld.DAGService
 	internal    ipld.DAGService // dagservice used to store internal objects
 	dstore      ds.Datastore
+
+	// Labels of direct and recursive pins, and the cids whose label has
+	// changed since the last Flush.
+	info      map[cid.Cid]Info
+	dirtyInfo *cid.Set
 }
 
 // NewPinner creates a new pinner using the given datastore as a backend
@@ -206,6 +238,8 @@ func NewPinner(dstore ds.Datastore, serv, internal ipld.DAGService) Pinner {
 		dstore:      dstore,
 		internal:    internal,
 		internalPin: cid.NewSet(),
+		info:        make(map[cid.Cid]Info),
+		dirtyInfo:   cid.NewSet(),
 	}
 }
 
@@ -274,10 +308,12 @@ func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
 			return fmt.Errorf("%s is pinned recursively", c)
 		}
 		p.recursePin.Remove(c)
+		p.removeInfo(c)
 		return nil
 	}
 	if p.directPin.Has(c) {
 		p.directPin.Remove(c)
+		p.removeInfo(c)
 		return nil
 	}
 	return ErrNotPinned
@@ -430,6 +466,7 @@ func (p *pinner) RemovePinWithMode(c cid.Cid, mode Mode) {
 		// programmer error, panic OK
 		panic("unrecognized pin type")
 	}
+	p.removeInfo(c)
 }
 
 func cidSetWithValues(cids []cid.Cid) *cid.Set {
@@ -488,6 +525,22 @@ func LoadPinner(d ds.Datastore, dserv, internal ipld.DAGService) (Pinner, error)
 
 	p.internalPin = internalset
 
+	{ // load pin labels
+		info, err := loadInfo(d)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load pin labels: %v", err)
+		}
+		p.info = info
+		p.dirtyInfo = cid.NewSet()
+
+		// labels of pins removed before the last flush are garbage
+		for c := range p.info {
+			if !p.recursePin.Has(c) && !p.directPin.Has(c) {
+				p.removeInfo(c)
+			}
+		}
+	}
+
 	// assign services
 	p.dserv = dserv
 	p.dstore = d
@@ -512,6 +565,32 @@ func (p *pinner) RecursiveKeys() []cid.Cid {
 	return p.recursePin.Keys()
 }
 
+// DirectKeysChan streams the directly pinned keys
+func (p *pinner) DirectKeysChan(ctx context.Context) <-chan StreamedCid {
+	return streamKeys(ctx, p.DirectKeys())
+}
+
+// RecursiveKeysChan streams the recursively pinned keys
+func (p *pinner) RecursiveKeysChan(ctx context.Context) <-chan StreamedCid {
+	return streamKeys(ctx, p.RecursiveKeys())
+}
+
+// streamKeys sends keys on a channel, until ctx is done
+func streamKeys(ctx context.Context, keys []cid.Cid) <-chan StreamedCid {
+	out := make(chan StreamedCid)
+	go func() {
+		defer close(out)
+		for _, c := range keys {
+			select {
+			case out <- StreamedCid{C: c}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
 // Update updates a recursive pin from one cid to another
 // this is more efficient than simply pinning the new one and unpinning the
 // old one
@@ -529,8 +608,12 @@ func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error
 	}
 
 	p.recursePin.Add(to)
+	if info, ok := p.info[from]; ok {
+		p.setInfo(to, info)
+	}
 	if unpin {
 		p.recursePin.Remove(from)
+		p.removeInfo(from)
 	}
 	return nil
 }
@@ -584,6 +667,11 @@ func (p *pinner) Flush() error {
 		return fmt.Errorf("cannot store pin state: %v", err)
 	}
 	p.internalPin = internalset
+
+	if err := storeInfo(p.dstore, p.info, p.dirtyInfo.Keys()); err != nil {
+		return fmt.Errorf("cannot store pin labels: %v", err)
+	}
+	p.dirtyInfo = cid.NewSet()
 	return nil
 }
 
@@ -610,6 +698,57 @@ func (p *pinner) PinWithMode(c cid.Cid, mode Mode) {
 	}
 }
 
+// PinInfo returns the label attached to a direct or recursive pin
+func (p *pinner) PinInfo(c cid.Cid) (Info, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	info, ok := p.info[c]
+	return info, ok
+}
+
+// SetPinInfo attaches a label to a direct or recursive pin. The label is
+// persisted on the next Flush.
+func (p *pinner) SetPinInfo(c cid.Cid, info Info) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.recursePin.Has(c) && !p.directPin.Has(c) {
+		return ErrNotPinned
+	}
+	if info.IsEmpty() {
+		p.removeInfo(c)
+	} else {
+		p.setInfo(c, info)
+	}
+	return nil
+}
+
+// ExpiredKeys returns the direct and recursive pins whose expiry passed at
+// the given time. The labels are kept in memory, so only the labelled pins
+// are looked at.
+func (p *pinner) ExpiredKeys(now time.Time) ([]cid.Cid, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var out []cid.Cid
+	for c, info := range p.info {
+		if info.Expired(now) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (p *pinner) setInfo(c cid.Cid, info Info) {
+	p.info[c] = info
+	p.dirtyInfo.Add(c)
+}
+
+func (p *pinner) removeInfo(c cid.Cid) {
+	if _, ok := p.info[c]; ok {
+		delete(p.info, c)
+		p.dirtyInfo.Add(c)
+	}
+}
+
 // hasChild recursively looks for a Cid among the children of a root Cid.
 // The visit function can be used to shortcut already-visited branches.
 func hasChild(ng ipld.NodeGetter, root cid.Cid, child cid.Cid, visit func(cid.Cid) bool) (bool, error) {
@@ -2,6 +2,7 @@ package pin
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"testing"
 	"time"
@@ -414,3 +415,409 @@ func TestPinUpdate(t *testing.T) {
 	assertPinned(t, p, c2, "c2 should be pinned still")
 	assertPinned(t, p, c1, "c1 should be pinned now")
 }
+
+func TestPinInfo(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, n2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.SetPinInfo(c1, Info{Name: "site"}); err != ErrNotPinned {
+		t.Fatal("expected labelling an unpinned cid to fail")
+	}
+
+	if err := p.Pin(ctx, n1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	info := Info{Name: "site", Meta: map[string]string{"owner": "web"}}
+	if err := p.SetPinInfo(c1, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := np.PinInfo(c1)
+	if !ok || got.Name != "site" || got.Meta["owner"] != "web" {
+		t.Fatalf("pin label was not persisted: %v", got)
+	}
+
+	if err := np.Update(ctx, c1, c2, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.PinInfo(c1); ok {
+		t.Fatal("label of the old pin should be gone")
+	}
+	if got, ok := np.PinInfo(c2); !ok || got.Name != "site" {
+		t.Fatal("pin update should keep the label")
+	}
+
+	if err := np.Unpin(ctx, c2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := np.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err = LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.PinInfo(c2); ok {
+		t.Fatal("label should be removed along with the pin")
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	meta, err := ParseMeta("owner=web,ticket=a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["owner"] != "web" || meta["ticket"] != "a=b" {
+		t.Fatalf("unexpected metadata: %v", meta)
+	}
+	if s := FormatMeta(meta); s != "owner=web,ticket=a=b" {
+		t.Fatalf("unexpected formatting: %s", s)
+	}
+	if _, err := ParseMeta("owner"); err == nil {
+		t.Fatal("expected malformed metadata to fail")
+	}
+}
+
+func TestPinExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, n2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, n1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, n2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := p.SetPinInfo(c1, Info{Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetPinInfo(c2, Info{Expires: now.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(2 * time.Minute)
+	if keys := FilterExpired(p, p.DirectKeys(), later); len(keys) != 0 {
+		t.Fatal("expired direct pin should be filtered out")
+	}
+	if keys := FilterExpired(p, p.RecursiveKeys(), later); len(keys) != 1 {
+		t.Fatal("unexpired recursive pin should be kept")
+	}
+
+	removed, err := RemoveExpired(p, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || !removed[0].Equals(c2) {
+		t.Fatalf("expected only %s to be removed, got %v", c2, removed)
+	}
+	assertUnpinned(t, p, c2, "expired pin should be removed")
+	assertPinned(t, p, c1, "unexpired pin should be kept")
+
+	p, err = LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, c2, "removal of the expired pin should be flushed")
+	if _, ok := p.PinInfo(c2); ok {
+		t.Fatal("label of the expired pin should be gone")
+	}
+}
+
+func TestInfoMerge(t *testing.T) {
+	b, err := json.Marshal(Info{Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"Name":"site"}` {
+		t.Fatalf("permanent pins should have no expiry in JSON, got %s", b)
+	}
+
+	expires := time.Now().Add(time.Hour).Round(0)
+	var info Info
+	b, err = json.Marshal(Info{Name: "site", Expires: expires})
+	if err == nil {
+		err = json.Unmarshal(b, &info)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "site" || !info.Expires.Equal(expires) {
+		t.Fatalf("label did not survive JSON: %+v", info)
+	}
+
+	merged := info.Merge(Info{Meta: map[string]string{"k": "v"}})
+	if merged.Name != "site" || merged.Meta["k"] != "v" || !merged.Expires.Equal(expires) {
+		t.Fatalf("merging should keep the name and the expiry: %+v", merged)
+	}
+}
+
+func TestRepinExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+	nss := NewNamespaces(dstore, p)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+	for _, n := range []*mdag.ProtoNode{n1, n2} {
+		if err := dserv.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expires := time.Now().Add(time.Hour)
+
+	// a permanent pin stays permanent
+	if err := nss.Pin(ctx, DefaultNamespace, n1, true, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, DefaultNamespace, n1, true, expires); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.PinInfo(c1); !info.Expires.IsZero() {
+		t.Fatalf("permanent pin made to expire: %+v", info)
+	}
+	if err := nss.Pin(ctx, "app1", n1, true, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, "app1", n1, true, expires); err != nil {
+		t.Fatal(err)
+	}
+	if holders, _ := nss.Holders(c1); !holders["app1"].Expires.IsZero() {
+		t.Fatalf("permanent pin of a namespace made to expire: %+v", holders)
+	}
+
+	// an expiring pin is made permanent
+	if err := nss.Pin(ctx, DefaultNamespace, n2, true, expires); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.PinInfo(c2); !info.Expires.Equal(expires) {
+		t.Fatalf("expected the pin to expire: %+v", info)
+	}
+	if err := nss.Pin(ctx, DefaultNamespace, n2, true, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.PinInfo(c2); !info.Expires.IsZero() {
+		t.Fatalf("expected the pin to be permanent: %+v", info)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+	nss := NewNamespaces(dstore, p)
+	n1, c1 := randNode()
+	n2, c2 := randNode()
+
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, n2); err != nil {
+		t.Fatal(err)
+	}
+
+	// a plain pin, later shared with a namespace
+	if err := p.Pin(ctx, n1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, "app1", n1, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, "app1", n2, true, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, "app2", n2, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	holders, err := nss.Holders(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holders[DefaultNamespace].Mode != Recursive || holders["app1"].Mode != Direct {
+		t.Fatalf("unexpected holders: %v", holders)
+	}
+
+	pins, err := nss.Ls("app1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 || pins[c1] != Direct || pins[c2] != Recursive {
+		t.Fatalf("unexpected pins in app1: %v", pins)
+	}
+
+	// a plain unpin cannot remove the pins of namespaces
+	if err := nss.Unpin(ctx, DefaultNamespace, c2, true); err == nil {
+		t.Fatal("unpinning another namespace's pin should fail")
+	}
+
+	if err := nss.Unpin(ctx, "app1", c2, true); err != nil {
+		t.Fatal(err)
+	}
+	assertPinned(t, p, c2, "c2 is still held by app2")
+	if _, ok, _ := p.IsPinnedWithType(c2, Direct); !ok {
+		t.Fatal("c2 should now only be pinned directly")
+	}
+
+	if err := nss.Unpin(ctx, "app2", c2, false); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, c2, "c2 is no longer held")
+
+	// once app1 drops c1, it is a plain pin again
+	if err := nss.Unpin(ctx, "app1", c1, false); err != nil {
+		t.Fatal(err)
+	}
+	holders, err = nss.Holders(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 0 {
+		t.Fatalf("expected no holders, got %v", holders)
+	}
+	if err := nss.Unpin(ctx, DefaultNamespace, c1, true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, c1, "c1 is no longer held")
+}
+
+func TestNamespaceRecordPin(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+	nss := NewNamespaces(dstore, p)
+	n1, c1 := randNode()
+	if err := dserv.Add(ctx, n1); err != nil {
+		t.Fatal(err)
+	}
+
+	// content held by a namespace, then added again, as 'ipfs add' does
+	if err := nss.Pin(ctx, "app1", n1, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	p.PinWithMode(c1, Recursive)
+	if err := nss.RecordPin(c1, Recursive); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nss.Unpin(ctx, "app1", c1, false); err != nil {
+		t.Fatal(err)
+	}
+	assertPinned(t, p, c1, "c1 is still held by the default namespace")
+	if _, ok, _ := p.IsPinnedWithType(c1, Recursive); !ok {
+		t.Fatal("c1 should still be pinned recursively")
+	}
+}
+
+func TestNamespaceExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+	p := NewPinner(dstore, dserv, dserv)
+	nss := NewNamespaces(dstore, p)
+
+	nd, c := randNode()
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	soon, later := now.Add(time.Hour), now.Add(2*time.Hour)
+	if err := nss.Pin(ctx, "app1", nd, true, soon); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Pin(ctx, "app2", nd, true, later); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pin lasts until the last namespace's pin expires
+	if info, _ := p.PinInfo(c); !info.Expires.Equal(later) {
+		t.Fatalf("expected the pin to expire at %s, got %s", later, info.Expires)
+	}
+	if ExpiredSet(p, soon.Add(time.Minute)).Has(c) {
+		t.Fatal("the pin of app2 did not expire yet")
+	}
+
+	// a namespace pinning without expiry keeps the content pinned
+	if err := nss.Pin(ctx, "app3", nd, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.PinInfo(c); !info.Expires.IsZero() {
+		t.Fatalf("expected the pin not to expire, got %s", info.Expires)
+	}
+
+	if err := nss.Unpin(ctx, "app3", c, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := nss.Unpin(ctx, "app2", c, true); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.PinInfo(c); !info.Expires.Equal(soon) {
+		t.Fatalf("expected the pin to expire at %s, got %s", soon, info.Expires)
+	}
+}
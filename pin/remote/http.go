@@ -0,0 +1,156 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListResult is the body of a GET /pins response
+type ListResult struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
+
+// Error is the body of an error response
+type Error struct {
+	Error ErrorReason `json:"error"`
+}
+
+// ErrorReason describes why a request failed
+type ErrorReason struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+// HTTPClient is a Client for services implementing the HTTP pinning service
+// API
+type HTTPClient struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+var _ Client = (*HTTPClient)(nil)
+
+// NewHTTPClient returns a client for the service at the given endpoint,
+// e.g. "https://pins.example.com/api/v1", authenticating with the given
+// access token.
+func NewHTTPClient(endpoint, key string) *HTTPClient {
+	return &HTTPClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		key:      key,
+		client:   http.DefaultClient,
+	}
+}
+
+// Add implements Client.Add
+func (c *HTTPClient) Add(ctx context.Context, p Pin) (PinStatus, error) {
+	var st PinStatus
+	err := c.do(ctx, "POST", "/pins", p, &st)
+	return st, err
+}
+
+// Get implements Client.Get
+func (c *HTTPClient) Get(ctx context.Context, requestID string) (PinStatus, error) {
+	var st PinStatus
+	err := c.do(ctx, "GET", "/pins/"+url.PathEscape(requestID), nil, &st)
+	return st, err
+}
+
+// Ls implements Client.Ls
+func (c *HTTPClient) Ls(ctx context.Context, opts ListOptions) ([]PinStatus, error) {
+	q := url.Values{}
+	if len(opts.Cids) > 0 {
+		cids := make([]string, len(opts.Cids))
+		for i, k := range opts.Cids {
+			cids[i] = k.String()
+		}
+		q.Set("cid", strings.Join(cids, ","))
+	}
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	if len(opts.Status) > 0 {
+		status := make([]string, len(opts.Status))
+		for i, s := range opts.Status {
+			status[i] = string(s)
+		}
+		q.Set("status", strings.Join(status, ","))
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	path := "/pins"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var res ListResult
+	if err := c.do(ctx, "GET", path, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// Rm implements Client.Rm
+func (c *HTTPClient) Rm(ctx context.Context, requestID string) error {
+	return c.do(ctx, "DELETE", "/pins/"+url.PathEscape(requestID), nil, nil)
+}
+
+func (c *HTTPClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var e Error
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &e) == nil && e.Error.Reason != "" {
+			if e.Error.Details != "" {
+				return fmt.Errorf("remote pinning service: %s: %s", e.Error.Reason, e.Error.Details)
+			}
+			return fmt.Errorf("remote pinning service: %s", e.Error.Reason)
+		}
+		return fmt.Errorf("remote pinning service: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
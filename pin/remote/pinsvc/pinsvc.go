@@ -0,0 +1,230 @@
+// Package pinsvc is a small reference implementation of the HTTP pinning
+// service API. It keeps the pin requests in memory and is meant to run next
+// to the tests of the remote pinning client, not to store anything for real.
+package pinsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// PinFunc pins the content of a request. It is called in the background,
+// and the request is marked as pinned or failed depending on its result.
+type PinFunc func(ctx context.Context, p remote.Pin) error
+
+// Service is an http.Handler serving the pinning service API
+type Service struct {
+	ctx       context.Context
+	key       string
+	pin       PinFunc
+	delegates []string
+
+	lock   sync.Mutex
+	pins   map[string]*remote.PinStatus
+	nextID uint64
+}
+
+// New returns a service which only accepts requests carrying the given
+// access token, and pins content with the given function. A nil PinFunc
+// marks every request as pinned right away. The delegates are returned with
+// each pin request.
+func New(ctx context.Context, key string, pinFn PinFunc, delegates ...string) *Service {
+	return &Service{
+		ctx:       ctx,
+		key:       key,
+		pin:       pinFn,
+		delegates: delegates,
+		pins:      make(map[string]*remote.PinStatus),
+		nextID:    1,
+	}
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.key {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid access token")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/pins" && r.Method == "GET":
+		s.list(w, r)
+	case path == "/pins" && r.Method == "POST":
+		s.add(w, r)
+	case strings.HasPrefix(path, "/pins/") && r.Method == "GET":
+		s.get(w, strings.TrimPrefix(path, "/pins/"))
+	case strings.HasPrefix(path, "/pins/") && r.Method == "DELETE":
+		s.remove(w, strings.TrimPrefix(path, "/pins/"))
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "unsupported request")
+	}
+}
+
+func (s *Service) add(w http.ResponseWriter, r *http.Request) {
+	var p remote.Pin
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if _, err := cid.Decode(p.Cid); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid cid: "+err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	st := &remote.PinStatus{
+		RequestID: strconv.FormatUint(s.nextID, 10),
+		Status:    remote.Queued,
+		Created:   time.Now(),
+		Pin:       p,
+		Delegates: s.delegates,
+	}
+	s.nextID++
+	if s.pin == nil {
+		st.Status = remote.Pinned
+	}
+	s.pins[st.RequestID] = st
+	out := *st
+	s.lock.Unlock()
+
+	if s.pin != nil {
+		go s.run(st.RequestID, p)
+	}
+	writeJSON(w, http.StatusAccepted, out)
+}
+
+func (s *Service) run(id string, p remote.Pin) {
+	s.setStatus(id, remote.Pinning)
+	if err := s.pin(s.ctx, p); err != nil {
+		s.setStatus(id, remote.Failed)
+		return
+	}
+	s.setStatus(id, remote.Pinned)
+}
+
+func (s *Service) setStatus(id string, status remote.Status) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// the request may have been removed in the meantime
+	if st, ok := s.pins[id]; ok {
+		st.Status = status
+	}
+}
+
+func (s *Service) get(w http.ResponseWriter, id string) {
+	s.lock.Lock()
+	st, ok := s.pins[id]
+	var out remote.PinStatus
+	if ok {
+		out = *st
+	}
+	s.lock.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Service) remove(w http.ResponseWriter, id string) {
+	s.lock.Lock()
+	_, ok := s.pins[id]
+	delete(s.pins, id)
+	s.lock.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// list returns the requests matching the query, oldest first. As in the
+// API, only pinned requests are returned unless other states are asked for.
+func (s *Service) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	cids := make(map[string]bool)
+	for _, c := range splitList(q.Get("cid")) {
+		k, err := cid.Decode(c)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid cid: "+err.Error())
+			return
+		}
+		cids[k.String()] = true
+	}
+
+	status := map[remote.Status]bool{remote.Pinned: true}
+	if sl := splitList(q.Get("status")); len(sl) > 0 {
+		status = make(map[remote.Status]bool)
+		for _, st := range sl {
+			status[remote.Status(st)] = true
+		}
+	}
+
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid limit")
+			return
+		}
+	}
+
+	name := q.Get("name")
+
+	s.lock.Lock()
+	var res []remote.PinStatus
+	for _, st := range s.pins {
+		if !status[st.Status] || (name != "" && st.Pin.Name != name) {
+			continue
+		}
+		if len(cids) > 0 {
+			k, _ := cid.Decode(st.Pin.Cid)
+			if !cids[k.String()] {
+				continue
+			}
+		}
+		res = append(res, *st)
+	}
+	s.lock.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		a, _ := strconv.ParseUint(res[i].RequestID, 10, 64)
+		b, _ := strconv.ParseUint(res[j].RequestID, 10, 64)
+		return a < b
+	})
+	count := len(res)
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	writeJSON(w, http.StatusOK, remote.ListResult{Count: count, Results: res})
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, reason, details string) {
+	writeJSON(w, code, remote.Error{Error: remote.ErrorReason{Reason: reason, Details: details}})
+}
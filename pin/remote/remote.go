@@ -0,0 +1,76 @@
+// Package remote implements a client for remote pinning services, which pin
+// content on behalf of a node so that it does not have to store it itself.
+//
+// The services are reached over the HTTP pinning service API: pins are
+// created with POST /pins, listed with GET /pins, looked up with
+// GET /pins/{requestid} and removed with DELETE /pins/{requestid}. Requests
+// are authenticated with a bearer token.
+package remote
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// Status is the state of a pin request on a remote service
+type Status string
+
+// Pin request states
+const (
+	Queued  Status = "queued"
+	Pinning Status = "pinning"
+	Pinned  Status = "pinned"
+	Failed  Status = "failed"
+)
+
+// ErrNotFound is returned for unknown pin requests
+var ErrNotFound = errors.New("remote pin not found")
+
+// Pin is the content a remote service is asked to pin
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is a pin request, as tracked by a remote service
+type PinStatus struct {
+	RequestID string    `json:"requestid"`
+	Status    Status    `json:"status"`
+	Created   time.Time `json:"created"`
+	Pin       Pin       `json:"pin"`
+
+	// Delegates are the multiaddrs of the peers that will fetch the
+	// content, which the requesting node should connect to.
+	Delegates []string `json:"delegates"`
+}
+
+// ListOptions filters the pins returned by Client.Ls. Empty fields match
+// any pin, except for Status: services only return pinned requests unless
+// other states are asked for.
+type ListOptions struct {
+	Cids   []cid.Cid
+	Name   string
+	Status []Status
+	Limit  int
+}
+
+// Client talks to a remote pinning service. HTTPClient is the default
+// implementation; others can be used through the same interface.
+type Client interface {
+	// Add asks the service to pin the given content
+	Add(ctx context.Context, p Pin) (PinStatus, error)
+
+	// Get returns the pin request with the given ID
+	Get(ctx context.Context, requestID string) (PinStatus, error)
+
+	// Ls lists the pin requests matching the given options
+	Ls(ctx context.Context, opts ListOptions) ([]PinStatus, error)
+
+	// Rm removes a pin request
+	Rm(ctx context.Context, requestID string) error
+}
@@ -0,0 +1,136 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+	pinsvc "github.com/ipfs/go-ipfs/pin/remote/pinsvc"
+
+	cid "github.com/ipfs/go-cid"
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func testCid(s string) cid.Cid {
+	return cid.NewCidV0(u.Hash([]byte(s)))
+}
+
+func TestAddLsRm(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(pinsvc.New(ctx, "secret", nil, "/ip4/127.0.0.1/tcp/4001"))
+	defer srv.Close()
+
+	c := remote.NewHTTPClient(srv.URL, "secret")
+
+	a, b := testCid("a"), testCid("b")
+	st, err := c.Add(ctx, remote.Pin{Cid: a.String(), Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != remote.Pinned || len(st.Delegates) != 1 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if _, err := c.Add(ctx, remote.Pin{Cid: b.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := c.Ls(ctx, remote.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 pins, got %d", len(all))
+	}
+
+	named, err := c.Ls(ctx, remote.ListOptions{Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(named) != 1 || named[0].Pin.Cid != a.String() {
+		t.Fatalf("unexpected pins: %+v", named)
+	}
+
+	byCid, err := c.Ls(ctx, remote.ListOptions{Cids: []cid.Cid{b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byCid) != 1 || byCid[0].Pin.Cid != b.String() {
+		t.Fatalf("unexpected pins: %+v", byCid)
+	}
+
+	if err := c.Rm(ctx, st.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, st.RequestID); err != remote.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := c.Rm(ctx, st.RequestID); err != remote.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPinFunc(t *testing.T) {
+	ctx := context.Background()
+	pinFn := func(ctx context.Context, p remote.Pin) error {
+		if p.Name == "bad" {
+			return errors.New("cannot fetch")
+		}
+		return nil
+	}
+	srv := httptest.NewServer(pinsvc.New(ctx, "secret", pinFn))
+	defer srv.Close()
+
+	c := remote.NewHTTPClient(srv.URL, "secret")
+
+	good, err := c.Add(ctx, remote.Pin{Cid: testCid("a").String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := c.Add(ctx, remote.Pin{Cid: testCid("b").String(), Name: "bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(id string, s remote.Status) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			st, err := c.Get(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Status == s {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("request %s did not reach status %s", id, s)
+	}
+	wait(good.RequestID, remote.Pinned)
+	wait(bad.RequestID, remote.Failed)
+
+	failed, err := c.Ls(ctx, remote.ListOptions{Status: []remote.Status{remote.Failed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].RequestID != bad.RequestID {
+		t.Fatalf("unexpected pins: %+v", failed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(pinsvc.New(ctx, "secret", nil))
+	defer srv.Close()
+
+	if _, err := remote.NewHTTPClient(srv.URL, "wrong").Ls(ctx, remote.ListOptions{}); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+
+	c := remote.NewHTTPClient(srv.URL, "secret")
+	if _, err := c.Add(ctx, remote.Pin{Cid: "not a cid"}); err == nil {
+		t.Fatal("expected an invalid cid to be rejected")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	coredag "github.com/ipfs/go-ipfs/core/coredag"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 	plugin "github.com/ipfs/go-ipfs/plugin"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
@@ -105,6 +106,12 @@ func (loader *PluginLoader) Inject() error {
 				return err
 			}
 		}
+		if pl, ok := pl.(plugin.PluginNamesys); ok {
+			err := injectNamesysPlugin(pl)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -152,6 +159,14 @@ func injectDatastorePlugin(pl plugin.PluginDatastore) error {
 	return fsrepo.AddDatastoreConfigHandler(pl.DatastoreTypeName(), pl.DatastoreConfigParser())
 }
 
+func injectNamesysPlugin(pl plugin.PluginNamesys) error {
+	r, err := pl.NameResolver()
+	if err != nil {
+		return err
+	}
+	return namesys.RegisterResolver(pl.NamePrefix(), r)
+}
+
 func injectIPLDPlugin(pl plugin.PluginIPLD) error {
 	err := pl.RegisterBlockDecoders(ipld.DefaultBlockDecoder)
 	if err != nil {
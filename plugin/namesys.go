@@ -0,0 +1,18 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/namesys"
+)
+
+// PluginNamesys is an interface that can be implemented to resolve the names
+// under a custom prefix, such as /ulord/<name>, the same way as /ipns/ names
+type PluginNamesys interface {
+	Plugin
+
+	// NamePrefix returns the prefix of the names the plugin resolves, such
+	// as "ulord"
+	NamePrefix() string
+	// NameResolver returns the resolver of these names, resolving them to
+	// /ipfs/ or /ipns/ paths
+	NameResolver() (namesys.Resolver, error)
+}
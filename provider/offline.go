@@ -23,6 +23,14 @@ func (op *offlineProvider) Provide(cid.Cid) error {
 	return nil
 }
 
-func (op *offlineProvider) Reprovide(context.Context) error {
+func (op *offlineProvider) Reprovide(context.Context, bool) error {
 	return nil
 }
+
+func (op *offlineProvider) Stat() (Stats, error) {
+	return Stats{}, nil
+}
+
+func (op *offlineProvider) ReprovideProgress() ReprovideProgress {
+	return ReprovideProgress{}
+}
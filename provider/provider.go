@@ -13,14 +13,50 @@ type Provider interface {
 	Provide(cid.Cid) error
 	// Close stops the provider
 	Close() error
+	// Stat returns statistics about the announcements
+	Stat() (Stats, error)
+}
+
+// Stats are statistics about the announcements of a provider
+type Stats struct {
+	// QueueLength is the number of CIDs waiting to be announced
+	QueueLength uint64
+	// Workers is the number of concurrent announce workers
+	Workers int
+	// Provided is the number of CIDs announced since the node started
+	Provided uint64
+	// Failed is the number of CIDs which could not be announced
+	Failed uint64
+	// Throughput is the number of CIDs announced per second over the last
+	// minute
+	Throughput float64
 }
 
 // Reprovider reannounces blocks to the network
 type Reprovider interface {
 	// Run is used to begin processing the reprovider work and waiting for reprovide triggers
 	Run()
-	// Trigger a reprovide
-	Trigger(context.Context) error
+	// Trigger a reprovide. With force, the keys whose provider records are
+	// not about to expire are announced again too.
+	Trigger(ctx context.Context, force bool) error
 	// Close stops the reprovider
 	Close() error
+	// Progress returns the progress of the current reprovide run, or the
+	// outcome of the last one
+	Progress() ReprovideProgress
+}
+
+// ReprovideProgress is the progress of a reprovide run
+type ReprovideProgress struct {
+	// Running is whether the run is still going on
+	Running bool
+	// Checked is the number of keys looked at so far
+	Checked uint64
+	// Provided is the number of keys announced again
+	Provided uint64
+	// Skipped is the number of keys whose provider records are not about to
+	// expire yet
+	Skipped uint64
+	// Failed is the number of keys which could not be announced
+	Failed uint64
 }
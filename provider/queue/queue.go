@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
@@ -21,12 +22,15 @@ var log = logging.Logger("provider.queue")
 // crash or shutdown occurs will still be in the queue when the node is
 // brought back online.
 type Queue struct {
+	// only written by the work goroutine, atomically so that Len can read
+	// them; first for 64-bit alignment
+	tail uint64
+	head uint64
+
 	// used to differentiate queues in datastore
 	// e.g. provider vs reprovider
 	name    string
 	ctx     context.Context
-	tail    uint64
-	head    uint64
 	ds      datastore.Datastore // Must be threadsafe
 	dequeue chan cid.Cid
 	enqueue chan cid.Cid
@@ -72,11 +76,34 @@ func (q *Queue) Enqueue(cid cid.Cid) {
 	}
 }
 
+// Requeue puts back cids which were dequeued but not handled, so that they
+// are dequeued again on the next start. It waits for the queue to be closed.
+func (q *Queue) Requeue(cids []cid.Cid) error {
+	<-q.closed
+	for _, c := range cids {
+		if err := q.ds.Put(q.queueKey(q.tail), c.Bytes()); err != nil {
+			return err
+		}
+		atomic.AddUint64(&q.tail, 1)
+	}
+	return nil
+}
+
 // Dequeue returns a channel that if listened to will remove entries from the queue
 func (q *Queue) Dequeue() <-chan cid.Cid {
 	return q.dequeue
 }
 
+// Len returns the number of cids in the queue
+func (q *Queue) Len() uint64 {
+	head := atomic.LoadUint64(&q.head)
+	tail := atomic.LoadUint64(&q.tail)
+	if tail < head {
+		return 0
+	}
+	return tail - head
+}
+
 // Look for next Cid in the queue and return it. Skip over gaps and mangled data
 func (q *Queue) nextEntry() (datastore.Key, cid.Cid) {
 	for {
@@ -93,14 +120,14 @@ func (q *Queue) nextEntry() (datastore.Key, cid.Cid) {
 			} else {
 				log.Errorf("Error fetching from queue: %s", err)
 			}
-			q.head++ // move on
+			atomic.AddUint64(&q.head, 1) // move on
 			continue
 		}
 
 		c, err := cid.Parse(value)
 		if err != nil {
 			log.Warningf("Error marshalling Cid from queue: ", err)
-			q.head++
+			atomic.AddUint64(&q.head, 1)
 			err = q.ds.Delete(key)
 			if err != nil {
 				log.Warningf("Provider queue failed to delete: %s", key)
@@ -142,7 +169,7 @@ func (q *Queue) work() {
 					continue
 				}
 
-				q.tail++
+				atomic.AddUint64(&q.tail, 1)
 			case dequeue <- c:
 				err := q.ds.Delete(k)
 
@@ -151,7 +178,7 @@ func (q *Queue) work() {
 					continue
 				}
 				c = cid.Undef
-				q.head++
+				atomic.AddUint64(&q.head, 1)
 			case <-q.ctx.Done():
 				return
 			}
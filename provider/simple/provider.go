@@ -5,8 +5,12 @@ package simple
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/provider"
 	q "github.com/ipfs/go-ipfs/provider/queue"
 	logging "github.com/ipfs/go-log"
 	routing "github.com/libp2p/go-libp2p-core/routing"
@@ -14,30 +18,159 @@ import (
 
 var logP = logging.Logger("provider.simple")
 
-const provideOutgoingWorkerLimit = 8
+// DefaultWorkers is the default number of concurrent announce workers
+const DefaultWorkers = 8
+
+// DefaultBatchSize is the default number of queued CIDs a worker announces at
+// once
+const DefaultBatchSize = 8
+
+// DefaultRetryBackoff is how long a failed announcement waits before it is
+// queued again. The wait doubles with every failure of the same CID.
+const DefaultRetryBackoff = time.Minute
+
+// maxRetries is the number of times a failed announcement is queued again
+// before the CID is left to the next reprovide
+const maxRetries = 6
+
+// ManyProvider is implemented by content routers which announce many CIDs at
+// once more efficiently than one at a time. Batches are handed to it whole,
+// other content routers are given the CIDs of a batch concurrently.
+type ManyProvider interface {
+	ProvideMany(ctx context.Context, keys []cid.Cid) error
+}
+
+// ExpandFunc returns the CIDs to announce along with the given one
+type ExpandFunc func(ctx context.Context, c cid.Cid) ([]cid.Cid, error)
 
 // Provider announces blocks to the network
 type Provider struct {
-	ctx context.Context
+	// counters, first for 64-bit alignment
+	provided uint64
+	failed   uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 	// the CIDs for which provide announcements should be made
 	queue *q.Queue
 	// used to announce providing to the network
 	contentRouting routing.ContentRouting
+
+	workers   int
+	batchSize int
+	limiter   *time.Ticker
+	expand    ExpandFunc
+
+	// failed announcements, by number of failures, and the ones waiting for
+	// their backoff before being queued again
+	retryLock    sync.Mutex
+	retries      map[cid.Cid]int
+	delayed      map[cid.Cid]struct{}
+	retryBackoff time.Duration
+	// dequeued CIDs left unannounced on shutdown, queued again on Close
+	unannounced []cid.Cid
+
+	// records when keys were provided, may be nil
+	tracker *Tracker
+
+	throughput rateCounter
+}
+
+// Option configures a Provider
+type Option func(*Provider)
+
+// Workers sets the number of concurrent announce workers
+func Workers(n int) Option {
+	return func(p *Provider) {
+		if n > 0 {
+			p.workers = n
+		}
+	}
+}
+
+// RateLimit limits the number of CIDs announced per second, across all
+// workers. Zero means no limit.
+func RateLimit(perSecond int) Option {
+	return func(p *Provider) {
+		if perSecond > 0 && perSecond <= int(time.Second) {
+			p.limiter = time.NewTicker(time.Second / time.Duration(perSecond))
+		}
+	}
+}
+
+// BatchSize sets how many queued CIDs a worker takes at once. Batches are
+// announced with a single call when the content router is a ManyProvider.
+func BatchSize(n int) Option {
+	return func(p *Provider) {
+		if n > 0 {
+			p.batchSize = n
+		}
+	}
+}
+
+// Expand makes the workers queue the CIDs returned by f for every CID they
+// take from the queue, so that they are announced, and expanded, in turn
+func Expand(f ExpandFunc) Option {
+	return func(p *Provider) {
+		p.expand = f
+	}
+}
+
+// RetryBackoff sets how long the first retry of a failed announcement waits
+func RetryBackoff(d time.Duration) Option {
+	return func(p *Provider) {
+		if d > 0 {
+			p.retryBackoff = d
+		}
+	}
+}
+
+// WithTracker records the provided keys in the given tracker, so that the
+// reprovider skips them until their provider records are about to expire
+func WithTracker(t *Tracker) Option {
+	return func(p *Provider) {
+		p.tracker = t
+	}
 }
 
 // NewProvider creates a provider that announces blocks to the network using a content router
-func NewProvider(ctx context.Context, queue *q.Queue, contentRouting routing.ContentRouting) *Provider {
-	return &Provider{
+func NewProvider(ctx context.Context, queue *q.Queue, contentRouting routing.ContentRouting, opts ...Option) *Provider {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Provider{
 		ctx:            ctx,
+		cancel:         cancel,
 		queue:          queue,
 		contentRouting: contentRouting,
+		workers:        DefaultWorkers,
+		batchSize:      DefaultBatchSize,
+		retries:        make(map[cid.Cid]int),
+		delayed:        make(map[cid.Cid]struct{}),
+		retryBackoff:   DefaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
-// Close stops the provider
+// Close stops the provider. The CIDs taken from the queue but not announced
+// yet are queued again, to be announced on the next start.
 func (p *Provider) Close() error {
+	p.cancel()
+	p.wg.Wait()
 	p.queue.Close()
-	return nil
+	if p.limiter != nil {
+		p.limiter.Stop()
+	}
+
+	p.retryLock.Lock()
+	left := p.unannounced
+	for c := range p.delayed {
+		left = append(left, c)
+	}
+	p.retryLock.Unlock()
+	return p.queue.Requeue(left)
 }
 
 // Run workers to handle provide requests.
@@ -51,22 +184,218 @@ func (p *Provider) Provide(root cid.Cid) error {
 	return nil
 }
 
+// Stat returns statistics about the announcements
+func (p *Provider) Stat() (provider.Stats, error) {
+	return provider.Stats{
+		QueueLength: p.queue.Len(),
+		Workers:     p.workers,
+		Provided:    atomic.LoadUint64(&p.provided),
+		Failed:      atomic.LoadUint64(&p.failed),
+		Throughput:  p.throughput.rate(),
+	}, nil
+}
+
 // Handle all outgoing cids by providing (announcing) them
 func (p *Provider) handleAnnouncements() {
-	for workers := 0; workers < provideOutgoingWorkerLimit; workers++ {
+	for workers := 0; workers < p.workers; workers++ {
+		p.wg.Add(1)
 		go func() {
-			for p.ctx.Err() == nil {
-				select {
-				case <-p.ctx.Done():
+			defer p.wg.Done()
+			for {
+				batch := p.nextBatch()
+				if batch == nil {
 					return
-				case c := <-p.queue.Dequeue():
-					logP.Info("announce - start - ", c)
-					if err := p.contentRouting.Provide(p.ctx, c, true); err != nil {
-						logP.Warningf("Unable to provide entry: %s, %s", c, err)
+				}
+				for range batch {
+					if !p.wait() {
+						p.keep(batch...)
+						return
 					}
-					logP.Info("announce - end - ", c)
 				}
+				p.expandBatch(batch)
+				p.announce(batch)
 			}
 		}()
 	}
 }
+
+// nextBatch waits for a queued cid, then takes the ones readily available
+// up to the batch size. It returns nil once the provider is closed.
+func (p *Provider) nextBatch() []cid.Cid {
+	var batch []cid.Cid
+	select {
+	case <-p.ctx.Done():
+		return nil
+	case c := <-p.queue.Dequeue():
+		batch = append(batch, c)
+	}
+
+	for len(batch) < p.batchSize {
+		select {
+		case c := <-p.queue.Dequeue():
+			batch = append(batch, c)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// expandBatch queues the CIDs to announce along with the batch. They are
+// queued before the batch is announced, so that a batch interrupted by Close
+// is expanded again on the next start.
+func (p *Provider) expandBatch(batch []cid.Cid) {
+	if p.expand == nil {
+		return
+	}
+	for _, c := range batch {
+		keys, err := p.expand(p.ctx, c)
+		if err != nil {
+			logP.Debugf("cannot expand %s: %s", c, err)
+			continue
+		}
+		for _, k := range keys {
+			p.queue.Enqueue(k)
+		}
+	}
+}
+
+func (p *Provider) announce(batch []cid.Cid) {
+	logP.Infof("announce - start - %d cids", len(batch))
+	errs := make([]error, len(batch))
+	if mp, ok := p.contentRouting.(ManyProvider); ok && len(batch) > 1 {
+		if err := mp.ProvideMany(p.ctx, batch); err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, c := range batch {
+			wg.Add(1)
+			go func(i int, c cid.Cid) {
+				defer wg.Done()
+				errs[i] = p.contentRouting.Provide(p.ctx, c, true)
+			}(i, c)
+		}
+		wg.Wait()
+	}
+
+	now := time.Now()
+	for i, c := range batch {
+		if err := errs[i]; err != nil {
+			logP.Warningf("Unable to provide entry: %s, %s", c, err)
+			atomic.AddUint64(&p.failed, 1)
+			p.retry(c)
+			continue
+		}
+		atomic.AddUint64(&p.provided, 1)
+		p.throughput.add(1)
+		p.track(c, now)
+		p.retryLock.Lock()
+		delete(p.retries, c)
+		p.retryLock.Unlock()
+	}
+	logP.Infof("announce - end - %d cids", len(batch))
+}
+
+// retry queues a failed announcement again after a backoff doubling with
+// every failure, up to maxRetries times
+func (p *Provider) retry(c cid.Cid) {
+	p.retryLock.Lock()
+	defer p.retryLock.Unlock()
+
+	if p.ctx.Err() != nil {
+		// the announcement was interrupted by Close
+		p.unannounced = append(p.unannounced, c)
+		return
+	}
+
+	n := p.retries[c]
+	if n >= maxRetries {
+		delete(p.retries, c)
+		logP.Errorf("giving up announcing %s after %d retries, it will be announced by the next reprovide", c, n)
+		return
+	}
+	p.retries[c] = n + 1
+	p.delayed[c] = struct{}{}
+
+	time.AfterFunc(p.retryBackoff<<uint(n), func() {
+		p.retryLock.Lock()
+		if p.ctx.Err() != nil {
+			// left for Close to queue again
+			p.retryLock.Unlock()
+			return
+		}
+		delete(p.delayed, c)
+		p.retryLock.Unlock()
+		p.queue.Enqueue(c)
+	})
+}
+
+// keep records dequeued CIDs which will not be announced before Close
+func (p *Provider) keep(keys ...cid.Cid) {
+	p.retryLock.Lock()
+	p.unannounced = append(p.unannounced, keys...)
+	p.retryLock.Unlock()
+}
+
+func (p *Provider) track(c cid.Cid, now time.Time) {
+	if p.tracker == nil {
+		return
+	}
+	if err := p.tracker.Provided(c, now); err != nil {
+		logP.Errorf("failed to record the provide time of %s: %s", c, err)
+	}
+}
+
+// wait blocks until the rate limit allows one more announcement. It returns
+// false if the provider was closed in the meantime.
+func (p *Provider) wait() bool {
+	if p.limiter == nil {
+		return p.ctx.Err() == nil
+	}
+	select {
+	case <-p.limiter.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// rateCounter counts events per second over the last rateWindow seconds
+type rateCounter struct {
+	lock    sync.Mutex
+	counts  [rateWindow]uint64
+	seconds [rateWindow]int64
+}
+
+// rateWindow is the number of seconds the throughput is measured over
+const rateWindow = 60
+
+func (r *rateCounter) add(n int) {
+	now := time.Now().Unix()
+	i := now % rateWindow
+
+	r.lock.Lock()
+	if r.seconds[i] != now {
+		r.seconds[i] = now
+		r.counts[i] = 0
+	}
+	r.counts[i] += uint64(n)
+	r.lock.Unlock()
+}
+
+func (r *rateCounter) rate() float64 {
+	now := time.Now().Unix()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var total uint64
+	for i := range r.counts {
+		if now-r.seconds[i] < rateWindow {
+			total += r.counts[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
@@ -2,7 +2,9 @@ package simple_test
 
 import (
 	"context"
+	"errors"
 	"math/rand"
+	gosync "sync"
 	"testing"
 	"time"
 
@@ -81,3 +83,182 @@ func TestAnnouncement(t *testing.T) {
 		}
 	}
 }
+
+// flakyRouting fails the first announcement of every cid
+type flakyRouting struct {
+	mockRouting
+	lock   gosync.Mutex
+	failed map[cid.Cid]bool
+}
+
+func (r *flakyRouting) Provide(ctx context.Context, c cid.Cid, recursive bool) error {
+	r.lock.Lock()
+	failed := r.failed[c]
+	r.failed[c] = true
+	r.lock.Unlock()
+	if !failed {
+		return errors.New("no peers")
+	}
+	return r.mockRouting.Provide(ctx, c, recursive)
+}
+
+func TestRetryAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := sync.MutexWrap(datastore.NewMapDatastore())
+	queue, err := q.NewQueue(ctx, "test", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &flakyRouting{failed: make(map[cid.Cid]bool)}
+	r.provided = make(chan cid.Cid)
+
+	cids := cid.NewSet()
+	for i := 0; i < 100; i++ {
+		c := blockGenerator.Next().Cid()
+		cids.Add(c)
+		queue.Enqueue(c)
+	}
+
+	prov := NewProvider(ctx, queue, r, Workers(2), RetryBackoff(time.Millisecond))
+	prov.Run()
+
+	for cids.Len() > 0 {
+		select {
+		case c := <-r.provided:
+			if !cids.Has(c) {
+				t.Fatal("Wrong CID provided")
+			}
+			cids.Remove(c)
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timeout waiting for cids to be provided.")
+		}
+	}
+
+	// the counters are updated right after the announcements
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		st, err := prov.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Provided == 100 {
+			if st.QueueLength != 0 || st.Failed != 100 || st.Workers != 2 {
+				t.Fatalf("unexpected stats: %+v", st)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 100 provided cids, got %d", st.Provided)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+type mockManyRouting struct {
+	mockRouting
+	batches chan []cid.Cid
+}
+
+func (r *mockManyRouting) ProvideMany(ctx context.Context, keys []cid.Cid) error {
+	r.batches <- keys
+	return nil
+}
+
+func TestBatchedAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := sync.MutexWrap(datastore.NewMapDatastore())
+	queue, err := q.NewQueue(ctx, "test", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &mockManyRouting{batches: make(chan []cid.Cid)}
+	r.provided = make(chan cid.Cid)
+
+	cids := cid.NewSet()
+	for i := 0; i < 100; i++ {
+		c := blockGenerator.Next().Cid()
+		cids.Add(c)
+		queue.Enqueue(c)
+	}
+
+	prov := NewProvider(ctx, queue, r, Workers(2), BatchSize(10))
+	prov.Run()
+
+	for cids.Len() > 0 {
+		select {
+		case batch := <-r.batches:
+			if len(batch) > 10 {
+				t.Fatalf("batch of %d cids is larger than the batch size", len(batch))
+			}
+			for _, c := range batch {
+				if !cids.Has(c) {
+					t.Fatal("Wrong CID provided")
+				}
+				cids.Remove(c)
+			}
+		case c := <-r.provided:
+			if !cids.Has(c) {
+				t.Fatal("Wrong CID provided")
+			}
+			cids.Remove(c)
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timeout waiting for cids to be provided.")
+		}
+	}
+}
+
+// blockingRouting never completes an announcement before it is canceled
+type blockingRouting struct {
+	mockRouting
+}
+
+func (r *blockingRouting) Provide(ctx context.Context, c cid.Cid, recursive bool) error {
+	r.provided <- c
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRequeueOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := sync.MutexWrap(datastore.NewMapDatastore())
+	queue, err := q.NewQueue(ctx, "test", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		queue.Enqueue(blockGenerator.Next().Cid())
+	}
+
+	r := &blockingRouting{}
+	r.provided = make(chan cid.Cid, 3)
+
+	prov := NewProvider(ctx, queue, r, Workers(1), BatchSize(1))
+	prov.Run()
+
+	select {
+	case <-r.provided:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timeout waiting for an announcement to start.")
+	}
+	if err := prov.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the interrupted announcement is queued again
+	queue, err = q.NewQueue(ctx, "test", ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if n := queue.Len(); n != 3 {
+		t.Fatalf("expected 3 queued cids, got %d", n)
+	}
+}
@@ -3,6 +3,7 @@ package simple
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	backoff "github.com/cenkalti/backoff"
@@ -10,6 +11,7 @@ import (
 	cidutil "github.com/ipfs/go-cidutil"
 	blocks "github.com/ipfs/go-ipfs-blockstore"
 	pin "github.com/ipfs/go-ipfs/pin"
+	"github.com/ipfs/go-ipfs/provider"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
 	merkledag "github.com/ipfs/go-merkledag"
@@ -23,27 +25,41 @@ var logR = logging.Logger("reprovider.simple")
 type KeyChanFunc func(context.Context) (<-chan cid.Cid, error)
 type doneFunc func(error)
 
+// trigger is a request to reprovide now
+type trigger struct {
+	force bool
+	done  doneFunc
+}
+
 // Reprovider reannounces blocks to the network
 type Reprovider struct {
 	ctx     context.Context
-	trigger chan doneFunc
+	trigger chan trigger
 
 	// The routing system to provide values through
 	rsys routing.ContentRouting
 
 	keyProvider KeyChanFunc
 
+	// records when keys were provided, may be nil
+	tracker *Tracker
+
 	tick time.Duration
+
+	lock     sync.Mutex
+	progress provider.ReprovideProgress
 }
 
-// NewReprovider creates new Reprovider instance.
-func NewReprovider(ctx context.Context, reprovideIniterval time.Duration, rsys routing.ContentRouting, keyProvider KeyChanFunc) *Reprovider {
+// NewReprovider creates new Reprovider instance. With a tracker, keys are
+// only reprovided when their provider records are about to expire.
+func NewReprovider(ctx context.Context, reprovideIniterval time.Duration, rsys routing.ContentRouting, keyProvider KeyChanFunc, tracker *Tracker) *Reprovider {
 	return &Reprovider{
 		ctx:     ctx,
-		trigger: make(chan doneFunc),
+		trigger: make(chan trigger),
 
 		rsys:        rsys,
 		keyProvider: keyProvider,
+		tracker:     tracker,
 		tick:        reprovideIniterval,
 	}
 }
@@ -59,16 +75,16 @@ func (rp *Reprovider) Run() {
 	// may have just started the daemon and shutting it down immediately.
 	// probability( up another minute | uptime ) increases with uptime.
 	after := time.After(time.Minute)
-	var done doneFunc
 	for {
 		if rp.tick == 0 {
 			after = make(chan time.Time)
 		}
 
+		var t trigger
 		select {
 		case <-rp.ctx.Done():
 			return
-		case done = <-rp.trigger:
+		case t = <-rp.trigger:
 		case <-after:
 		}
 
@@ -76,13 +92,13 @@ func (rp *Reprovider) Run() {
 		//a 'reprovider is already running' error is returned
 		unmute := rp.muteTrigger()
 
-		err := rp.Reprovide()
+		err := rp.Reprovide(t.force)
 		if err != nil {
 			logR.Debug(err)
 		}
 
-		if done != nil {
-			done(err)
+		if t.done != nil {
+			t.done(err)
 		}
 
 		unmute()
@@ -91,18 +107,48 @@ func (rp *Reprovider) Run() {
 	}
 }
 
-// Reprovide registers all keys given by rp.keyProvider to libp2p content routing
-func (rp *Reprovider) Reprovide() error {
+// Progress returns the progress of the current reprovide run, or the outcome
+// of the last one
+func (rp *Reprovider) Progress() provider.ReprovideProgress {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	return rp.progress
+}
+
+func (rp *Reprovider) updateProgress(f func(p *provider.ReprovideProgress)) {
+	rp.lock.Lock()
+	f(&rp.progress)
+	rp.lock.Unlock()
+}
+
+// Reprovide registers all keys given by rp.keyProvider to libp2p content routing.
+// Unless forced, keys whose provider records are not about to expire are
+// skipped.
+func (rp *Reprovider) Reprovide(force bool) error {
+	rp.updateProgress(func(p *provider.ReprovideProgress) {
+		*p = provider.ReprovideProgress{Running: true}
+	})
+	defer rp.updateProgress(func(p *provider.ReprovideProgress) {
+		p.Running = false
+	})
+
 	keychan, err := rp.keyProvider(rp.ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get key chan: %s", err)
 	}
+	now := time.Now()
 	for c := range keychan {
+		rp.updateProgress(func(p *provider.ReprovideProgress) { p.Checked++ })
+
 		// hash security
 		if err := verifcid.ValidateCid(c); err != nil {
 			logR.Errorf("insecure hash in reprovider, %s (%s)", c, err)
 			continue
 		}
+		if !force && rp.tracker != nil && !rp.tracker.Due(c, now, rp.tick) {
+			rp.updateProgress(func(p *provider.ReprovideProgress) { p.Skipped++ })
+			continue
+		}
 		op := func() error {
 			err := rp.rsys.Provide(rp.ctx, c, true)
 			if err != nil {
@@ -116,14 +162,29 @@ func (rp *Reprovider) Reprovide() error {
 		err := backoff.Retry(op, backoff.NewExponentialBackOff())
 		if err != nil {
 			logR.Debugf("Providing failed after number of retries: %s", err)
+			rp.updateProgress(func(p *provider.ReprovideProgress) { p.Failed++ })
 			return err
 		}
+		rp.updateProgress(func(p *provider.ReprovideProgress) { p.Provided++ })
+
+		if rp.tracker != nil {
+			if err := rp.tracker.Provided(c, time.Now()); err != nil {
+				logR.Errorf("failed to record the provide time of %s: %s", c, err)
+			}
+		}
+	}
+
+	if rp.tracker != nil {
+		if _, err := rp.tracker.Prune(now); err != nil {
+			logR.Errorf("failed to prune provide times: %s", err)
+		}
 	}
 	return nil
 }
 
-// Trigger starts reprovision process in rp.Run and waits for it
-func (rp *Reprovider) Trigger(ctx context.Context) error {
+// Trigger starts reprovision process in rp.Run and waits for it. With force,
+// the keys provided recently are announced again too.
+func (rp *Reprovider) Trigger(ctx context.Context, force bool) error {
 	progressCtx, done := context.WithCancel(ctx)
 
 	var err error
@@ -137,7 +198,7 @@ func (rp *Reprovider) Trigger(ctx context.Context) error {
 		return context.Canceled
 	case <-ctx.Done():
 		return context.Canceled
-	case rp.trigger <- df:
+	case rp.trigger <- trigger{force: force, done: df}:
 		<-progressCtx.Done()
 		return err
 	}
@@ -151,8 +212,8 @@ func (rp *Reprovider) muteTrigger() context.CancelFunc {
 			select {
 			case <-ctx.Done():
 				return
-			case done := <-rp.trigger:
-				done(fmt.Errorf("reprovider is already running"))
+			case t := <-rp.trigger:
+				t.done(fmt.Errorf("reprovider is already running"))
 			}
 		}
 	}()
@@ -169,7 +230,52 @@ func NewBlockstoreProvider(bstore blocks.Blockstore) KeyChanFunc {
 	}
 }
 
-// NewPinnedProvider returns provider supplying pinned keys
+// NewPrioritizedProvider returns a key provider supplying the keys of the
+// priority provider first, then the keys of the other one which were not
+// supplied yet. The priority keys are kept in memory.
+func NewPrioritizedProvider(priority, rest KeyChanFunc) KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		first, err := priority(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+
+			seen := cid.NewSet()
+			for c := range first {
+				seen.Add(c)
+				select {
+				case <-ctx.Done():
+					return
+				case outCh <- c:
+				}
+			}
+
+			then, err := rest(ctx)
+			if err != nil {
+				logR.Errorf("failed to get key chan: %s", err)
+				return
+			}
+			for c := range then {
+				if seen.Has(c) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case outCh <- c:
+				}
+			}
+		}()
+
+		return outCh, nil
+	}
+}
+
+// NewPinnedProvider returns provider supplying pinned keys, roots first
 func NewPinnedProvider(onlyRoots bool) func(pin.Pinner, ipld.DAGService) KeyChanFunc {
 	return func(pinning pin.Pinner, dag ipld.DAGService) KeyChanFunc {
 		return func(ctx context.Context) (<-chan cid.Cid, error) {
@@ -208,15 +314,19 @@ func pinSet(ctx context.Context, pinning pin.Pinner, dag ipld.DAGService, onlyRo
 			set.Visitor(ctx)(key)
 		}
 
-		for _, key := range pinning.RecursiveKeys() {
+		recursive := pinning.RecursiveKeys()
+		for _, key := range recursive {
 			set.Visitor(ctx)(key)
+		}
 
-			if !onlyRoots {
-				err := merkledag.EnumerateChildren(ctx, merkledag.GetLinksWithDAG(dag), key, set.Visitor(ctx))
-				if err != nil {
-					logR.Errorf("reprovide indirect pins: %s", err)
-					return
-				}
+		if onlyRoots {
+			return
+		}
+		for _, key := range recursive {
+			err := merkledag.EnumerateChildren(ctx, merkledag.GetLinksWithDAG(dag), key, set.Visitor(ctx))
+			if err != nil {
+				logR.Errorf("reprovide indirect pins: %s", err)
+				return
 			}
 		}
 	}()
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipfs/go-ipfs-blockstore"
@@ -37,8 +38,8 @@ func TestReprovide(t *testing.T) {
 	}
 
 	keyProvider := NewBlockstoreProvider(bstore)
-	reprov := NewReprovider(ctx, time.Hour, clA, keyProvider)
-	err = reprov.Reprovide()
+	reprov := NewReprovider(ctx, time.Hour, clA, keyProvider, nil)
+	err = reprov.Reprovide(false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,3 +60,98 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+func TestReprovideSkipsRecentlyProvided(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	recent := blocks.NewBlock([]byte("recently provided"))
+	old := blocks.NewBlock([]byte("provided long ago"))
+	unknown := blocks.NewBlock([]byte("never provided"))
+	for _, b := range []blocks.Block{recent, old, unknown} {
+		if err := bstore.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracker := NewTracker(dstore)
+	now := time.Now()
+	if err := tracker.Provided(recent.Cid(), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Provided(old.Cid(), now.Add(-20*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	reprov := NewReprovider(ctx, 12*time.Hour, clA, NewBlockstoreProvider(bstore), tracker)
+	if err := reprov.Reprovide(false); err != nil {
+		t.Fatal(err)
+	}
+
+	p := reprov.Progress()
+	if p.Running || p.Checked != 3 || p.Provided != 2 || p.Skipped != 1 || p.Failed != 0 {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+
+	for _, b := range []blocks.Block{old, unknown} {
+		last, err := tracker.LastProvided(b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if now.Sub(last) > time.Minute {
+			t.Fatalf("provide time of %s should be updated", b.Cid())
+		}
+	}
+
+	// a forced run announces all of them again
+	if err := reprov.Reprovide(true); err != nil {
+		t.Fatal(err)
+	}
+	p = reprov.Progress()
+	if p.Checked != 3 || p.Provided != 3 || p.Skipped != 0 {
+		t.Fatalf("unexpected progress of the forced run: %+v", p)
+	}
+}
+
+func TestPrioritizedProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	var all []blocks.Block
+	for _, s := range []string{"a", "b", "c", "d"} {
+		b := blocks.NewBlock([]byte(s))
+		if err := bstore.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, b)
+	}
+	first := all[2]
+
+	priority := func(ctx context.Context) (<-chan cid.Cid, error) {
+		ch := make(chan cid.Cid, 1)
+		ch <- first.Cid()
+		close(ch)
+		return ch, nil
+	}
+
+	keys, err := NewPrioritizedProvider(priority, NewBlockstoreProvider(bstore))(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []cid.Cid
+	for c := range keys {
+		got = append(got, c)
+	}
+	if len(got) != len(all) {
+		t.Fatalf("expected %d keys, got %d", len(all), len(got))
+	}
+	if !got[0].Equals(first.Cid()) {
+		t.Fatal("priority key should come first")
+	}
+}
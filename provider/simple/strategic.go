@@ -0,0 +1,108 @@
+package simple
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs/pin"
+	ipld "github.com/ipfs/go-ipld-format"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// DirectoryEntries returns an ExpandFunc giving the entries of unixfs
+// directories, and nothing for other nodes. A provider expanding the CIDs it
+// is given with it announces their roots and the entries of the directories
+// under them, but none of the blocks files are made of: a large file costs a
+// single provider record. The DAG service should not fetch from the network:
+// the content given to the provider is expected to be local.
+func DirectoryEntries(dag ipld.DAGService) ExpandFunc {
+	return func(ctx context.Context, c cid.Cid) ([]cid.Cid, error) {
+		dir := getDirectory(ctx, dag, c)
+		if dir == nil {
+			return nil, nil
+		}
+		var entries []cid.Cid
+		err := dir.ForEachLink(ctx, func(l *ipld.Link) error {
+			entries = append(entries, l.Cid)
+			return nil
+		})
+		return entries, err
+	}
+}
+
+// NewStrategicKeyProvider returns a key provider supplying the pinned roots,
+// then the entries of the unixfs directories under recursive pins
+func NewStrategicKeyProvider(pinning pin.Pinner, dag ipld.DAGService) KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+
+			send := func(c cid.Cid) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case outCh <- c:
+					return nil
+				}
+			}
+
+			seen := cid.NewSet()
+			recursive := pinning.RecursiveKeys()
+			for _, keys := range [][]cid.Cid{pinning.DirectKeys(), recursive} {
+				for _, c := range keys {
+					if !seen.Visit(c) {
+						continue
+					}
+					if err := send(c); err != nil {
+						return
+					}
+				}
+			}
+
+			for _, c := range recursive {
+				if err := directoryEntries(ctx, dag, c, seen, send); err != nil {
+					return
+				}
+			}
+		}()
+
+		return outCh, nil
+	}
+}
+
+// directoryEntries calls f with the entries of the unixfs directories under
+// root, recursively. Files are not descended into, and entries already in the
+// visited set are skipped.
+func directoryEntries(ctx context.Context, dag ipld.DAGService, root cid.Cid, visited *cid.Set, f func(cid.Cid) error) error {
+	dir := getDirectory(ctx, dag, root)
+	if dir == nil {
+		return nil
+	}
+
+	return dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		if !visited.Visit(l.Cid) {
+			return nil
+		}
+		if err := f(l.Cid); err != nil {
+			return err
+		}
+		return directoryEntries(ctx, dag, l.Cid, visited, f)
+	})
+}
+
+// getDirectory returns the unixfs directory with the given cid, or nil if it
+// is not one
+func getDirectory(ctx context.Context, dag ipld.DAGService, c cid.Cid) uio.Directory {
+	nd, err := dag.Get(ctx, c)
+	if err != nil {
+		logP.Debugf("strategic provide: cannot get %s: %s", c, err)
+		return nil
+	}
+	dir, err := uio.NewDirectoryFromNode(dag, nd)
+	if err != nil {
+		// not a directory, there is nothing more to announce
+		return nil
+	}
+	return dir
+}
@@ -0,0 +1,104 @@
+package simple_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	q "github.com/ipfs/go-ipfs/provider/queue"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+
+	. "github.com/ipfs/go-ipfs/provider/simple"
+)
+
+func TestStrategicProvider(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	// a file made of two chunks, in a subdirectory
+	file := dag.NodeWithData(ft.FilePBData(nil, 0))
+	var chunks []cid.Cid
+	for _, data := range []string{"chunk 1", "chunk 2"} {
+		chunk := dag.NewRawNode([]byte(data))
+		if err := dserv.Add(ctx, chunk); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.AddNodeLink("", chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk.Cid())
+	}
+	if err := dserv.Add(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := uio.NewDirectory(dserv)
+	if err := sub.AddChild(ctx, "file", file); err != nil {
+		t.Fatal(err)
+	}
+	subNode, err := sub.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, subNode); err != nil {
+		t.Fatal(err)
+	}
+
+	root := uio.NewDirectory(dserv)
+	if err := root.AddChild(ctx, "sub", subNode); err != nil {
+		t.Fatal(err)
+	}
+	rootNode, err := root.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, rootNode); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := q.NewQueue(ctx, "test", dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mockContentRouting()
+	r.provided = make(chan cid.Cid, 10)
+	sp := NewProvider(ctx, queue, r, Expand(DirectoryEntries(dserv)))
+	sp.Run()
+	defer sp.Close()
+
+	if err := sp.Provide(rootNode.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cid.NewSet()
+	for _, c := range []cid.Cid{rootNode.Cid(), subNode.Cid(), file.Cid()} {
+		expected.Add(c)
+	}
+	for expected.Len() > 0 {
+		select {
+		case c := <-r.provided:
+			if !expected.Has(c) {
+				t.Fatalf("unexpected provided key %s", c)
+			}
+			expected.Remove(c)
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timeout waiting for keys to be provided.")
+		}
+	}
+
+	// the file chunks are not provided
+	select {
+	case c := <-r.provided:
+		t.Fatalf("unexpected provided key %s, chunks are %s", c, chunks)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
@@ -0,0 +1,100 @@
+package simple
+
+import (
+	"strconv"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	query "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+// RecordLifetime is how long provider records stay valid in the routing
+// system, i.e. how long the DHT keeps them.
+const RecordLifetime = 24 * time.Hour
+
+// reprovideMargin is how long before expiry, on top of the reprovide
+// interval, records are reprovided, so that a run has time to complete.
+const reprovideMargin = time.Hour
+
+// Tracker records when keys were last provided, so that they are only
+// reprovided once their provider records are about to expire, even across
+// restarts.
+type Tracker struct {
+	ds datastore.Datastore
+}
+
+// NewTracker returns a tracker stored in the given datastore
+func NewTracker(ds datastore.Datastore) *Tracker {
+	return &Tracker{
+		ds: namespace.Wrap(ds, datastore.NewKey("/provider-v1/provided")),
+	}
+}
+
+// Provided records that c was provided at the given time
+func (t *Tracker) Provided(c cid.Cid, at time.Time) error {
+	v := strconv.FormatInt(at.Unix(), 10)
+	return t.ds.Put(dshelp.CidToDsKey(c), []byte(v))
+}
+
+// LastProvided returns when c was last provided, or the zero time if it
+// never was
+func (t *Tracker) LastProvided(c cid.Cid) (time.Time, error) {
+	v, err := t.ds.Get(dshelp.CidToDsKey(c))
+	if err == datastore.ErrNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseProvideTime(v)
+}
+
+// Due returns whether the provider record of c will expire before the next
+// reprovide run, given the reprovide interval. Keys whose provide time cannot
+// be read are due.
+func (t *Tracker) Due(c cid.Cid, now time.Time, interval time.Duration) bool {
+	last, err := t.LastProvided(c)
+	if err != nil {
+		logR.Errorf("failed to read the provide time of %s: %s", c, err)
+		return true
+	}
+	return now.Sub(last) > RecordLifetime-interval-reprovideMargin
+}
+
+// Prune removes the provide times of records which have expired, whether
+// their keys are still provided or not. It returns the number of removed
+// entries.
+func (t *Tracker) Prune(now time.Time) (int, error) {
+	res, err := t.ds.Query(query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	pruned := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			return pruned, r.Error
+		}
+		last, err := parseProvideTime(r.Value)
+		if err == nil && now.Sub(last) < RecordLifetime {
+			continue
+		}
+		if err := t.ds.Delete(datastore.RawKey(r.Key)); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+func parseProvideTime(v []byte) (time.Time, error) {
+	secs, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
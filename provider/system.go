@@ -11,7 +11,9 @@ type System interface {
 	Run()
 	Close() error
 	Provide(cid.Cid) error
-	Reprovide(context.Context) error
+	Reprovide(ctx context.Context, force bool) error
+	Stat() (Stats, error)
+	ReprovideProgress() ReprovideProgress
 }
 
 type system struct {
@@ -54,6 +56,17 @@ func (s *system) Provide(cid cid.Cid) error {
 }
 
 // Reprovide all the previously provided values
-func (s *system) Reprovide(ctx context.Context) error {
-	return s.reprovider.Trigger(ctx)
+func (s *system) Reprovide(ctx context.Context, force bool) error {
+	return s.reprovider.Trigger(ctx, force)
+}
+
+// Stat returns statistics about the announcements of the provider
+func (s *system) Stat() (Stats, error) {
+	return s.provider.Stat()
+}
+
+// ReprovideProgress returns the progress of the current reprovide run, or the
+// outcome of the last one
+func (s *system) ReprovideProgress() ReprovideProgress {
+	return s.reprovider.Progress()
 }
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The helpers below read settings which are not part of the config.Config
+// struct, and can only be set with 'ipfs config'. A setting that cannot be
+// read, usually because it is not set, yields the given default value.
+
+// ConfigBool reads a boolean setting from the repo config.
+func ConfigBool(r Repo, key string, def bool) (bool, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return def, nil
+	}
+
+	switch val := val.(type) {
+	case bool:
+		return val, nil
+	case string:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return def, fmt.Errorf("config setting %s is not a boolean: %q", key, val)
+		}
+		return b, nil
+	default:
+		return def, fmt.Errorf("config setting %s is not a boolean: %v", key, val)
+	}
+}
+
+// ConfigString reads a string setting from the repo config.
+func ConfigString(r Repo, key string, def string) (string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return def, nil
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return def, fmt.Errorf("config setting %s is not a string: %v", key, val)
+	}
+	return s, nil
+}
+
+// ConfigInt reads an integer setting from the repo config.
+func ConfigInt(r Repo, key string, def int) (int, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return def, nil
+	}
+
+	switch val := val.(type) {
+	case float64: // how JSON numbers are decoded
+		if val != float64(int(val)) {
+			return def, fmt.Errorf("config setting %s is not an integer: %v", key, val)
+		}
+		return int(val), nil
+	case int:
+		return val, nil
+	case string:
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return def, fmt.Errorf("config setting %s is not an integer: %q", key, val)
+		}
+		return i, nil
+	default:
+		return def, fmt.Errorf("config setting %s is not an integer: %v", key, val)
+	}
+}
+
+// ConfigDuration reads a duration setting, such as "12h", from the repo
+// config.
+func ConfigDuration(r Repo, key string, def time.Duration) (time.Duration, error) {
+	s, err := ConfigString(r, key, "")
+	if err != nil || s == "" {
+		return def, err
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def, fmt.Errorf("config setting %s is not a duration: %s", key, err)
+	}
+	return d, nil
+}
+
+// ConfigStringMap reads a setting mapping names to strings, such as
+// {"eth": "https://example.com/dns-query"}, from the repo config.
+func ConfigStringMap(r Repo, key string) (map[string]string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return nil, nil
+	}
+
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config setting %s is not a map of strings: %v", key, val)
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("config setting %s.%s is not a string: %v", key, k, v)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+// ConfigUnmarshal decodes an object setting from the repo config into v, as
+// encoding/json would. v is left untouched when the setting is not set.
+func ConfigUnmarshal(r Repo, key string, v interface{}) error {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("config setting %s is invalid: %s", key, err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -383,18 +384,78 @@ func (r *FSRepo) openConfig() error {
 	return nil
 }
 
+// KeystoreAgentConfigKey is the path of the Unix socket of a keystore agent
+// holding the keys, see keystore.AgentKeystore. The keystore of the repo is
+// not used when it is set.
+const KeystoreAgentConfigKey = "Keystore.AgentSocket"
+
+// openKeystore opens the keystore of the repo. When KeystoreAgentConfigKey
+// is set, the keys are held by the agent listening on that socket. An
+// encrypted keystore is unlocked with the passphrase in
+// keystore.PassphraseEnv when it is set, and stays locked otherwise.
 func (r *FSRepo) openKeystore() error {
+	socket, err := r.keystoreAgentSocket()
+	if err != nil {
+		return err
+	}
+	if socket != "" {
+		r.keystore = keystore.NewAgentKeystore(socket)
+		return nil
+	}
+
 	ksp := filepath.Join(r.path, "keystore")
-	ks, err := keystore.NewFSKeystore(ksp)
+	encrypted, err := keystore.IsEncryptedFSKeystore(ksp)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		ks, err := keystore.NewFSKeystore(ksp)
+		if err != nil {
+			return err
+		}
+
+		r.keystore = ks
+
+		return nil
+	}
+
+	ks, err := keystore.NewEncryptedFSKeystore(ksp)
 	if err != nil {
 		return err
 	}
+	if pass := os.Getenv(keystore.PassphraseEnv); pass != "" {
+		if err := ks.Unlock([]byte(pass)); err != nil {
+			return fmt.Errorf("failed to unlock the keystore with %s: %s", keystore.PassphraseEnv, err)
+		}
+	}
 
 	r.keystore = ks
 
 	return nil
 }
 
+// keystoreAgentSocket reads KeystoreAgentConfigKey, which is not part of
+// config.Config. The repo is being opened, so GetConfigKey cannot be used.
+func (r *FSRepo) keystoreAgentSocket() (string, error) {
+	filename, err := config.Filename(r.path)
+	if err != nil {
+		return "", err
+	}
+	var cfg map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &cfg); err != nil {
+		return "", err
+	}
+	val, err := common.MapGetKV(cfg, KeystoreAgentConfigKey)
+	if err != nil {
+		return "", nil
+	}
+	socket, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("config setting %s is not a string: %v", KeystoreAgentConfigKey, val)
+	}
+	return socket, nil
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	if r.config.Datastore.Type != "" || r.config.Datastore.Path != "" {
@@ -533,7 +594,7 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	}
 	// to avoid clobbering user-provided keys, must read the config from disk
 	// as a map, write the updated struct values to the map and write the map
-	// to disk.
+	// to disk. The keys unknown to the struct are kept, at any depth.
 	var mapconf map[string]interface{}
 	if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
 		return err
@@ -542,10 +603,8 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err != nil {
 		return err
 	}
-	for k, v := range m {
-		mapconf[k] = v
-	}
-	if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
+	keepUnknownKeys(m, mapconf, reflect.TypeOf(*updated))
+	if err := serialize.WriteConfigFile(configFilename, m); err != nil {
 		return err
 	}
 	// Do not use `*r.config = ...`. This will modify the *shared* config
@@ -554,6 +613,53 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	return nil
 }
 
+// keepUnknownKeys copies into dst the keys of src which are not fields of the
+// struct type t, and does the same for the nested structs. Such keys, as set
+// with SetConfigKey, would otherwise be lost when writing the struct.
+func keepUnknownKeys(dst, src map[string]interface{}, t reflect.Type) {
+	for k, v := range src {
+		f, known := jsonField(t, k)
+		if !known {
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		dm, ok := dst[f.Name].(map[string]interface{})
+		sm, sok := v.(map[string]interface{})
+		if ok && sok && ft.Kind() == reflect.Struct {
+			keepUnknownKeys(dm, sm, ft)
+		}
+	}
+}
+
+// jsonField returns the field of the struct type t serialized under the given
+// key. The name of the returned field is the key it is serialized under.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		if strings.EqualFold(name, key) {
+			f.Name = name
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
 // SetConfig updates the FSRepo's config. The user must not modify the config
 // object after calling this method.
 func (r *FSRepo) SetConfig(updated *config.Config) error {
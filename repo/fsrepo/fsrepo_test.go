@@ -116,3 +116,40 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestSetConfigKeepsUnknownKeys(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("config", t)
+	defer Remove(path)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	// settings of the node which the config struct does not know about
+	assert.Nil(r.SetConfigKey("Datastore.GCEviction", "lru"), t)
+	policies := map[string]interface{}{"self": map[string]interface{}{"Interval": "1h"}}
+	assert.Nil(r.SetConfigKey("Ipns.KeyPolicies", policies), t)
+
+	cur, err := r.Config()
+	assert.Nil(err, t)
+	cfg := *cur
+	cfg.Bootstrap = []string{"/ip4/127.0.0.1/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"}
+	cfg.Datastore.StorageMax = "1GB"
+	assert.Nil(r.SetConfig(&cfg), t)
+
+	for key, expected := range map[string]interface{}{
+		"Datastore.GCEviction":           "lru",
+		"Ipns.KeyPolicies.self.Interval": "1h",
+		"Datastore.StorageMax":           "1GB",
+	} {
+		v, err := r.GetConfigKey(key)
+		if err != nil {
+			t.Fatalf("%s: %s", key, err)
+		}
+		if v != expected {
+			t.Fatalf("%s: expected %v, got %v", key, expected, v)
+		}
+	}
+}
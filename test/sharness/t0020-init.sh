@@ -181,6 +181,47 @@ test_expect_success "clean up ipfs dir" '
   rm -rf "$IPFS_PATH"
 '
 
+test_expect_success "'ipfs init --new-mnemonic' succeeds" '
+  ipfs init --new-mnemonic > new_mnemonic_out &&
+  grep "write it down" new_mnemonic_out &&
+  test $(sed -n "3p" new_mnemonic_out | wc -w) = 24
+'
+
+test_expect_success "clean up ipfs dir" '
+  rm -rf "$IPFS_PATH"
+'
+
+test_expect_success "'ipfs init --mnemonic' succeeds" '
+  export IPFS_MNEMONIC="abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about" &&
+  ipfs init --mnemonic=- &&
+  ipfs config Identity.PeerID > mnemonic_peerid
+'
+
+test_expect_success "'ipfs init --mnemonic' gives the same identity again" '
+  rm -rf "$IPFS_PATH" &&
+  ipfs init --mnemonic=- &&
+  ipfs config Identity.PeerID > mnemonic_peerid_again &&
+  test_cmp mnemonic_peerid mnemonic_peerid_again
+'
+
+test_expect_success "'ipfs init --derivation-path' gives another identity" '
+  rm -rf "$IPFS_PATH" &&
+  ipfs init --mnemonic=- --derivation-path="m/2'"'"'" &&
+  ipfs config Identity.PeerID > mnemonic_peerid_other &&
+  ! test_cmp mnemonic_peerid mnemonic_peerid_other
+'
+
+test_expect_success "'ipfs init --mnemonic' fails with an invalid phrase" '
+  rm -rf "$IPFS_PATH" &&
+  test_must_fail ipfs init --mnemonic="abandon about" 2> invalid_mnemonic_out &&
+  grep "invalid mnemonic seed phrase" invalid_mnemonic_out
+'
+
+test_expect_success "clean up ipfs dir" '
+  unset IPFS_MNEMONIC &&
+  rm -rf "$IPFS_PATH"
+'
+
 test_init_ipfs
 
 test_launch_ipfs_daemon
@@ -47,6 +47,17 @@ test_expect_success "'ipfs pin rm' output looks good" '
   test_cmp expected1 actual1
 '
 
+test_expect_success "'ipfs repo gc --dry-run' reports the unpinned file" '
+  ipfs repo gc --dry-run >dryrun_actual &&
+  grep "^would remove [1-9][0-9]* blocks" dryrun_actual &&
+  grep "^  dag-pb: " dryrun_actual
+'
+
+test_expect_success "'ipfs repo gc --dry-run' does not remove it" '
+  ipfs cat "$HASH" >out &&
+  test_cmp out afile
+'
+
 test_expect_success "ipfs repo gc fully reverse ipfs add (part 1)" '
   ipfs repo gc &&
   random 100000 41 >gcfile &&
@@ -160,6 +160,76 @@ test_pin_progress() {
   '
 }
 
+test_pin_migrate() {
+  test_expect_success "pin a file before migrating" '
+    echo "migrated pin" > migrated &&
+    MIGRATED=`ipfs add -q migrated` &&
+    ipfs pin ls --type=recursive > before
+  '
+
+  test_expect_success "'ipfs repo migrate-pins' succeeds" '
+    ipfs repo migrate-pins > migrate_out &&
+    grep -q "^Converted [0-9]* pins" migrate_out
+  '
+
+  test_expect_success "the pins are kept" '
+    ipfs pin ls --type=recursive > after &&
+    test_sort_cmp before after
+  '
+
+  test_expect_success "'ipfs pin ls --stream' lists the pins" '
+    ipfs pin ls --stream --type=recursive > streamed &&
+    test_sort_cmp before streamed
+  '
+
+  test_expect_success "'ipfs repo migrate-pins' is idempotent" '
+    ipfs repo migrate-pins > migrate_out &&
+    grep -q "already uses the datastore pinner" migrate_out
+  '
+}
+
+test_pin_repair() {
+  test_expect_success "set up a two node testbed" '
+    iptb testbed create -type localipfs -count 2 -force -init
+  '
+
+  startup_cluster 2
+
+  test_expect_success "pin a DAG added on the other node" '
+    random-files -depth=1 -dirs=1 -files=4 -seed=85 repairdir > /dev/null &&
+    REPAIR_HASH=$(ipfsi 0 add -r -q --raw-leaves --cid-version=1 repairdir | tail -n1) &&
+    ipfsi 1 pin add $REPAIR_HASH &&
+    LEAF=$(ipfsi 1 refs -r $REPAIR_HASH | tail -n1)
+  '
+
+  test_expect_success "stop the nodes" '
+    iptb stop && iptb_wait_stop
+  '
+
+  test_expect_success "remove a block of the pinned DAG from the repo" '
+    LEAF_FILE=$(echo ${LEAF#b} | tr a-z A-Z).data &&
+    find "$IPTB_ROOT/testbeds/default/1/blocks" -name "$LEAF_FILE" -delete &&
+    test_must_fail ipfsi 1 block stat $LEAF
+  '
+
+  startup_cluster 2
+
+  test_expect_success "'ipfs pin verify --repair' fetches the block again" '
+    ipfsi 1 pin verify --repair > verify_out &&
+    grep -q "^$REPAIR_HASH repaired" verify_out &&
+    grep -q "$LEAF: fetched" verify_out
+  '
+
+  test_expect_success "the block is back in the repo" '
+    ipfsi 1 refs local > local_refs &&
+    grep -q "$LEAF" local_refs
+  '
+
+  test_expect_success "stop the nodes" '
+    iptb stop && iptb_wait_stop
+  '
+}
+
 test_init_ipfs
 
 test_pins
@@ -174,6 +244,8 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_migrate
+
 test_launch_ipfs_daemon --offline
 
 test_pins
@@ -190,4 +262,6 @@ test_pin_progress
 
 test_kill_ipfs_daemon
 
+test_pin_repair
+
 test_done
@@ -176,6 +176,57 @@ test_expect_success "resolve output looks good" '
   test_cmp expected4 output
 '
 
+# test the publish history
+
+test_expect_success "publish two values with a new key" '
+  HIST_ID=`ipfs key gen --type=rsa --size=2048 histkey` &&
+  ipfs name publish --allow-offline --key=histkey "/ipfs/$HASH_WELCOME_DOCS" &&
+  ipfs name publish --allow-offline --key=histkey --resolve=false "/ipfs/$OBJECT_HASH"
+'
+
+test_expect_success "'ipfs name history' lists both values, newest first" '
+  ipfs name history histkey | cut -f1,2 >history_out &&
+  printf "1\t/ipfs/%s\n0\t/ipfs/%s\n" "$OBJECT_HASH" "$HASH_WELCOME_DOCS" >expected_history &&
+  test_cmp expected_history history_out
+'
+
+test_expect_success "'ipfs name rollback' to the current value fails" '
+  test_expect_code 1 ipfs name rollback --allow-offline --to=1 histkey
+'
+
+test_expect_success "'ipfs name rollback' succeeds" '
+  ipfs name rollback --allow-offline --to=0 histkey >rollback_out &&
+  echo "Published to ${HIST_ID}: /ipfs/$HASH_WELCOME_DOCS" >expected_rollback &&
+  test_cmp expected_rollback rollback_out
+'
+
+test_expect_success "the rolled back value has a higher sequence number" '
+  ipfs name history histkey | head -n1 | cut -f1,2 >history_out &&
+  printf "2\t/ipfs/%s\n" "$HASH_WELCOME_DOCS" >expected_history &&
+  test_cmp expected_history history_out &&
+  ipfs name resolve --offline "$HIST_ID" >output &&
+  printf "/ipfs/%s\n" "$HASH_WELCOME_DOCS" >expected_resolve &&
+  test_cmp expected_resolve output
+'
+
+# test inspecting records
+
+test_expect_success "'ipfs name inspect --dump' exports the record" '
+  ipfs name inspect --key=histkey --dump >record.bin
+'
+
+test_expect_success "'ipfs name inspect' verifies the exported record" '
+  ipfs name inspect --verify="$HIST_ID" <record.bin >inspect_out &&
+  grep "^Value: /ipfs/$HASH_WELCOME_DOCS$" inspect_out &&
+  grep "^Sequence: 2$" inspect_out &&
+  grep "^Signature: valid for $HIST_ID$" inspect_out
+'
+
+test_expect_success "'ipfs name inspect' does not verify the record for another name" '
+  ipfs name inspect --verify="$PEERID" <record.bin >inspect_out &&
+  grep "^Signature: invalid for $PEERID" inspect_out
+'
+
 test_launch_ipfs_daemon
 
 test_expect_success "'ipfs name resolve --offline' succeeds" '
@@ -74,8 +74,126 @@ test_key_cmd() {
     test_must_fail ipfs key rename -f fooed self 2>&1 | tee key_rename_out &&
     grep -q "Error: cannot overwrite key with name" key_rename_out
   '
+
+  test_expect_success "key export and import move a key" '
+    ipfs key export fooed > fooed.key &&
+    ipfs key rm fooed &&
+    ipfs key import fooed fooed.key > import_out &&
+    echo $edhash > import_exp &&
+    test_cmp import_exp import_out
+  '
+
+  test_expect_success "key import refuses to overwrite a key" '
+    test_must_fail ipfs key import fooed fooed.key 2>&1 | tee key_import_out &&
+    grep -q "Error: key by that name already exists" key_import_out
+  '
+
+  test_expect_success "key export and import an encrypted PEM key" '
+    echo secret > export_passphrase &&
+    ipfs key export --format=pem-pkcs8 --passphrase-fd=3 fooed 3<export_passphrase > fooed.pem &&
+    grep -q "BEGIN ENCRYPTED PRIVATE KEY" fooed.pem &&
+    test_must_fail ipfs key import fooedpem fooed.pem &&
+    ipfs key import --passphrase-fd=3 fooedpem fooed.pem 3<export_passphrase > import_out &&
+    test_cmp import_exp import_out &&
+    ipfs key rm fooedpem
+  '
 }
 
 test_key_cmd
 
+test_expect_success "key gen derives the same key from a mnemonic" '
+  MNEMONIC="abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about" &&
+  ipfs key gen --mnemonic="$MNEMONIC" --derivation-path="m/1'"'"'/0'"'"'" derived > derived_id &&
+  ipfs key rm derived &&
+  IPFS_MNEMONIC="$MNEMONIC" ipfs key gen --mnemonic=- --derivation-path="m/1'"'"'/0'"'"'" derived > derived_id_again &&
+  test_cmp derived_id derived_id_again &&
+  ipfs key gen --mnemonic="$MNEMONIC" --derivation-path="m/1'"'"'/1'"'"'" derived_other > derived_other_id &&
+  ! test_cmp derived_id derived_other_id &&
+  ipfs key rm derived derived_other
+'
+
+test_expect_success "key gen needs a derivation path and an ed25519 type with a mnemonic" '
+  test_must_fail ipfs key gen --mnemonic="$MNEMONIC" derived &&
+  test_must_fail ipfs key gen --type=rsa --mnemonic="$MNEMONIC" --derivation-path="m/1'"'"'/0'"'"'" derived &&
+  test_must_fail ipfs key gen --mnemonic="$MNEMONIC" --derivation-path="m/1/0" derived
+'
+
+test_expect_success "key rotate-identity rotates the identity" '
+  OLDID=$(ipfs id --format="<id>") &&
+  ipfs name publish --allow-offline "/ipfs/$HASH_WELCOME_DOCS" &&
+  ipfs config --json Provider.Workers 4 &&
+  ipfs key rotate-identity --type=ed25519 > rotate_out &&
+  NEWID=$(ipfs id --format="<id>") &&
+  test "$OLDID" != "$NEWID" &&
+  grep -q "Identity rotated from $OLDID to $NEWID" rotate_out &&
+  ipfs key list -l | grep -q "$OLDID *identity-$OLDID" &&
+  ipfs key list > keys_out &&
+  test_must_fail grep -q "identity-$NEWID" keys_out
+'
+
+test_expect_success "key rotate-identity keeps the other config settings" '
+  echo 4 > workers_exp &&
+  ipfs config Provider.Workers > workers_out &&
+  test_cmp workers_exp workers_out
+'
+
+test_expect_success "the old name points to the new one" '
+  ipfs name resolve --recursive=false "$OLDID" > resolve_out &&
+  echo "/ipns/$NEWID" > resolve_exp &&
+  test_cmp resolve_exp resolve_out &&
+  ipfs name resolve "$OLDID" > resolve_out &&
+  echo "/ipfs/$HASH_WELCOME_DOCS" > resolve_exp &&
+  test_cmp resolve_exp resolve_out
+'
+
+test_expect_success "key rotate-identity refuses to overwrite the old key" '
+  test_must_fail ipfs key rotate-identity --old-key="identity-$OLDID"
+'
+
+test_expect_success "repo encrypt-keystore encrypts the keys" '
+  ipfs key list | sort > list_exp &&
+  IPFS_KEYSTORE_PASSPHRASE=secret ipfs repo encrypt-keystore &&
+  test -f "$IPFS_PATH/keystore/.encryption"
+'
+
+test_expect_success "the encrypted keys need the passphrase" '
+  test_must_fail ipfs key list 2>&1 | tee key_list_out &&
+  grep -q "keystore is encrypted" key_list_out &&
+  test_must_fail env IPFS_KEYSTORE_PASSPHRASE=wrong ipfs key list
+'
+
+test_expect_success "the encrypted keys are unlocked by the passphrase" '
+  IPFS_KEYSTORE_PASSPHRASE=secret ipfs key list | sort > list_out &&
+  test_cmp list_exp list_out &&
+  echo secret > passphrase &&
+  IPFS_KEYSTORE_PASSPHRASE=secret ipfs key gen --type=ed25519 encrypted &&
+  IPFS_KEYSTORE_PASSPHRASE=secret ipfs key rm encrypted
+'
+
+exec 6<passphrase
+test_launch_ipfs_daemon --offline --keystore-passphrase-fd=6
+
+test_expect_success "the daemon unlocked the keystore" '
+  ipfs key list | sort > list_out &&
+  test_cmp list_exp list_out
+'
+
+test_expect_success "key export cannot run on the daemon" '
+  test_must_fail ipfs key export self 2>&1 | tee key_export_out &&
+  grep -q "ipfs daemon is running" key_export_out
+'
+
+test_expect_success "key import cannot run on the daemon" '
+  test_must_fail ipfs key import imported fooed.key 2>&1 | tee key_import_out &&
+  grep -q "ipfs daemon is running" key_import_out
+'
+
+test_expect_success "key gen does not send a mnemonic to the daemon" '
+  test_must_fail ipfs key gen --mnemonic="$MNEMONIC" --derivation-path="m/1'"'"'/2'"'"'" derived 2>&1 | tee key_gen_out &&
+  grep -q "ipfs daemon is running" key_gen_out
+'
+
+test_kill_ipfs_daemon
+exec 6<&-
+
 test_done
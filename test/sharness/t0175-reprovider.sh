@@ -41,6 +41,17 @@ findprovs_empty '$HASH_0'
 reprovide
 findprovs_expect '$HASH_0' '$PEERID_0'
 
+test_expect_success 'reprovide again skips the keys just provided' '
+  ipfsi 0 bitswap reprovide >reprovide_out &&
+  grep "^reprovided 0 of" reprovide_out
+'
+
+test_expect_success 'reprovide --force announces them again' '
+  ipfsi 0 bitswap reprovide --force >reprovide_out &&
+  grep "^reprovided [1-9][0-9]* of" reprovide_out &&
+  grep " 0 skipped" reprovide_out
+'
+
 test_expect_success 'Stop iptb' '
   iptb stop
 '